@@ -0,0 +1,14 @@
+// smartedudl-cli 只包含命令行模式，不链接图形界面（fyne/GLFW），可在没有图形库的服务器或定时任务中运行：
+//
+//	CGO_ENABLED=0 go build -o smartedudl-cli ./cmd/smartedudl-cli
+package main
+
+import (
+	"os"
+
+	"github.com/hantang/smartedudlgo/internal/cli"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:]))
+}
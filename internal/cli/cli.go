@@ -0,0 +1,476 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hantang/smartedudlgo/internal/dl"
+	"github.com/hantang/smartedudlgo/internal/util"
+)
+
+const usageText = `用法: smartedudl <命令> [参数] [URL...]
+
+命令:
+  get     下载教材、课件、音频等资源
+  video   仅下载视频（m3u8）
+  resume  继续上次未完成或下载失败的文件
+  clean   清理中断后遗留的视频分段缓存和隔离的无效文件
+  verify  按索引文件重新校验已下载的文件（需下载时开启元数据）
+  bundle  将目录中的课程资源打包为带 index.html 的 ZIP，便于离线使用
+  help    显示帮助
+
+不带命令运行 smartedudl 时启动图形界面；smartedudl-cli 只包含命令行模式，不依赖图形库。
+使用 "smartedudl <命令> -h" 查看命令参数。
+参数默认值读取自设置文件（与图形界面共用），命令行参数优先。
+`
+
+// IsCommand 判断是否为命令行子命令
+func IsCommand(name string) bool {
+	switch name {
+	case "get", "video", "resume", "clean", "verify", "bundle", "help", "-h", "--help":
+		return true
+	}
+	return false
+}
+
+// Run 命令行模式入口，返回进程退出码
+func Run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usageText)
+		return 2
+	}
+	switch args[0] {
+	case "get":
+		return runDownload(args[0], args[1:], false)
+	case "video":
+		return runDownload(args[0], args[1:], true)
+	case "resume":
+		return runResume(args[0], args[1:])
+	case "clean":
+		return runClean(args[0], args[1:])
+	case "verify":
+		return runVerify(args[0], args[1:])
+	case "bundle":
+		return runBundle(args[0], args[1:])
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usageText)
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "未知命令：%s\n\n%s", args[0], usageText)
+	return 2
+}
+
+// loadSettings 读取设置文件作为参数默认值，文件有误时提示并使用默认设置
+func loadSettings() *dl.Settings {
+	settings, err := dl.LoadSettings()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return settings
+}
+
+// templateFieldsHelp 保存路径模板的字段说明
+func templateFieldsHelp() string {
+	var fields []string
+	for _, field := range dl.NAME_TEMPLATE_FIELDS {
+		fields = append(fields, fmt.Sprintf("{%s} %s", field.Name, field.Desc))
+	}
+	return strings.Join(fields, "、")
+}
+
+// defaultOutputDir 设置中的下载目录，未设置时为用户下载目录
+func defaultOutputDir(settings *dl.Settings) string {
+	if settings.DownloadsDir != "" {
+		return settings.DownloadsDir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, "Downloads")
+	}
+	return "Downloads"
+}
+
+func runDownload(name string, args []string, isVideo bool) int {
+	settings := loadSettings()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	outputDir := fs.String("o", defaultOutputDir(settings), "Output directory")
+	nameTemplate := fs.String("name", settings.NameTemplate, "Save path template relative to output directory, e.g. {stage}/{subject}/{edition}/{grade}/{title}.{ext} or {id}.{ext}")
+	inputFile := fs.String("i", "", "Read URLs from file (one per line, # for comments)")
+	formats := fs.String("f", strings.Join(settings.Formats, ","), "Comma separated formats, e.g. pdf,mp3 (ignored by video)")
+	token := fs.String("token", "", "X-Nd-Auth value or Access Token (default: $SMARTEDU_TOKEN or keyring)")
+	threads := fs.Int("threads", settings.MaxConcurrency, "Max concurrency")
+	retries := fs.Int("retries", settings.Retries, "Max attempts per request, including the first")
+	limit := fs.String("limit", settings.RateLimit, "Global download rate limit in bytes/s, e.g. 500k or 2m (0: unlimited)")
+	hostConns := fs.Int("host-conns", settings.HostConns, "Max concurrent requests per host (0: unlimited)")
+	conflictValue := fs.String("conflict", string(settings.Conflict), "When file exists: rename, skip, overwrite or verify")
+	containerValue := fs.String("container", string(settings.Container), "Video output container: mp4 or ts (ignored by get)")
+	qualityValue := fs.String("quality", settings.Quality, "Video quality: highest, lowest, height like 720p, or max bitrate like 2m/800k (ignored by get)")
+	useBackup := fs.Bool("backup", settings.UseBackup, "Enable backup parsing")
+	enableLog := fs.Bool("log", settings.EnableLog, "Save download log to output directory")
+	writeMetadata := fs.Bool("meta", settings.WriteMetadata, "Write a metadata JSON next to each file and a per-folder index")
+	mergePDF := fs.Bool("merge-pdf", settings.MergePDF, "Merge the PDFs of each book into one bookmarked PDF (ignored by video)")
+	removeMerged := fs.Bool("merge-remove", settings.RemoveMerged, "Remove the original PDFs after merging")
+	isDebug := fs.Bool("debug", false, "Enable debug logging")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: smartedudl %s [参数] [URL...]\n\n", name)
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\n保存路径模板字段：%s\n", templateFieldsHelp())
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *isDebug {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
+
+	links := fs.Args()
+	if *inputFile != "" {
+		fileLinks, err := readLinks(*inputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取URL文件失败：%v\n", err)
+			return 2
+		}
+		links = append(links, fileLinks...)
+	}
+
+	var validLinks []string
+	for _, link := range links {
+		if dl.ValidURL(link) {
+			validLinks = append(validLinks, link)
+		} else {
+			fmt.Fprintf(os.Stderr, "忽略无效URL：%s\n", link)
+		}
+	}
+	if len(validLinks) == 0 {
+		fmt.Fprintln(os.Stderr, "没有有效的URL")
+		fs.Usage()
+		return 2
+	}
+
+	// 新的队列会替换上次的队列，有未完成或下载失败的文件时不开始新的下载
+	if queue, err := dl.LoadQueue(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	} else if queue != nil && queue.Unfinished() > 0 {
+		fmt.Fprintf(os.Stderr, "上次有 %d 个文件未完成或下载失败（保存至 %s），"+
+			"请先运行 smartedudl resume 继续，或 smartedudl resume -discard 放弃\n", queue.Unfinished(), queue.DownloadsDir)
+		return 1
+	}
+
+	if err := applyLimits(*limit, *hostConns); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	conflict, err := dl.ParseConflictPolicy(*conflictValue)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	videoContainer, err := dl.ParseVideoContainer(*containerValue)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	quality, err := dl.ParseQualityPolicy(*qualityValue)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if _, err := dl.ParseNameTemplate(*nameTemplate); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var formatList []string
+	if isVideo {
+		formatList = dl.FORMAT_VIDEO
+	} else {
+		for _, format := range strings.Split(*formats, ",") {
+			format = strings.ToLower(strings.TrimSpace(format))
+			if format != "" {
+				formatList = append(formatList, format)
+			}
+		}
+		if len(formatList) == 0 {
+			fmt.Fprintln(os.Stderr, "请指定至少1个资源类型")
+			return 2
+		}
+	}
+
+	if *token == "" {
+		if saved, err := util.GetToken(); err == nil {
+			*token = saved
+		}
+	}
+
+	// Ctrl+C 取消解析和下载，解析资源的请求同样使用 -retries
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx = dl.WithRetries(ctx, *retries)
+
+	fmt.Fprintln(os.Stderr, "正在解析资源...")
+	resources := dl.ExtractResources(ctx, validLinks, formatList, true, *useBackup, true)
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "已取消")
+		return 130
+	}
+	if len(resources) == 0 {
+		fmt.Fprintln(os.Stderr, "未解析到有效资源")
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, dl.SummarizeResources(resources))
+
+	opts := dl.DownloadOptions{
+		Headers:        dl.NewHeaders(*token),
+		EnableLog:      *enableLog,
+		IsVideo:        isVideo,
+		MaxConcurrency: *threads,
+		Conflict:       conflict,
+		Container:      videoContainer,
+		Quality:        quality,
+		NameTemplate:   *nameTemplate,
+		WriteMetadata:  *writeMetadata,
+		MergePDF:       *mergePDF && !isVideo,
+		RemoveMerged:   *removeMerged,
+		Retries:        *retries,
+	}
+	return startQueue(ctx, dl.NewQueue(*outputDir, resources, opts), opts)
+}
+
+// startQueue 下载队列中的文件，进度保存到队列，中断后可用 resume 继续；ctx 取消（Ctrl+C）时删除未完成的文件
+func startQueue(ctx context.Context, queue *dl.Queue, opts dl.DownloadOptions) int {
+	reporter := newTermReporter(os.Stderr)
+	downloadManager := dl.NewDownloadManager(queue.DownloadsDir, queue.Links())
+	downloadManager.Subscribe(queue)
+	downloadManager.Subscribe(reporter)
+	if stdinIsTerminal() {
+		fmt.Fprintln(os.Stderr, controlHelp)
+		go readControls(ctx, os.Stdin, os.Stderr, downloadManager)
+	}
+	result := downloadManager.StartDownload(ctx, opts)
+	if result.Canceled > 0 {
+		return 130
+	}
+	if result.Err != nil || result.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runResume 继续上次中断（崩溃、重启或取消）的下载，使用当时的下载参数
+func runResume(name string, args []string) int {
+	settings := loadSettings()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	token := fs.String("token", "", "X-Nd-Auth value or Access Token (default: $SMARTEDU_TOKEN or keyring)")
+	discard := fs.Bool("discard", false, "Discard the unfinished queue instead of resuming")
+	retries := fs.Int("retries", settings.Retries, "Max attempts per request, including the first")
+	limit := fs.String("limit", settings.RateLimit, "Global download rate limit in bytes/s, e.g. 500k or 2m (0: unlimited)")
+	hostConns := fs.Int("host-conns", settings.HostConns, "Max concurrent requests per host (0: unlimited)")
+	isDebug := fs.Bool("debug", false, "Enable debug logging")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: smartedudl %s [参数]\n\n队列文件：%s\n\n", name, dl.QueuePath())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *isDebug {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
+	if err := applyLimits(*limit, *hostConns); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	queue, err := dl.LoadQueue()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if queue == nil || queue.Unfinished() == 0 {
+		fmt.Fprintln(os.Stderr, "没有未完成的下载")
+		return 0
+	}
+	if *discard {
+		if err := dl.DiscardQueue(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "已放弃 %d 个未完成的文件\n", queue.Unfinished())
+		return 0
+	}
+
+	if *token == "" {
+		if saved, err := util.GetToken(); err == nil {
+			*token = saved
+		}
+	}
+	queue = queue.Remaining()
+	fmt.Fprintf(os.Stderr, "继续下载 %d 个文件至 %s\n", len(queue.Items), queue.DownloadsDir)
+	opts := queue.Options.DownloadOptions(dl.NewHeaders(*token))
+	opts.Retries = *retries
+	// Ctrl+C 取消下载并删除未完成的文件
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return startQueue(ctx, queue, opts)
+}
+
+// runClean 删除视频分段工作目录和下载目录中的隔离文件
+func runClean(name string, args []string) int {
+	settings := loadSettings()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	days := fs.Int("days", 0, "Only remove work dirs and quarantined files older than this many days (0: all)")
+	outputDir := fs.String("o", defaultOutputDir(settings), "Output directory whose "+dl.QUARANTINE_DIR+" is cleaned")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: smartedudl %s [参数]\n\n缓存目录：%s\n隔离目录：下载目录中的 %s\n\n", name, dl.HLSWorkRoot(), dl.QUARANTINE_DIR)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	olderThan := time.Duration(*days) * 24 * time.Hour
+	code := 0
+	removed, freed, err := dl.CleanHLSWorkDirs(olderThan)
+	fmt.Fprintf(os.Stderr, "已清理 %d 个视频缓存目录，释放 %.1f MB\n", removed, float64(freed)/1024/1024)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "部分目录清理失败：%v\n", err)
+		code = 1
+	}
+	removed, freed, err = dl.CleanQuarantine(*outputDir, olderThan)
+	fmt.Fprintf(os.Stderr, "已清理 %d 个隔离文件，释放 %.1f MB\n", removed, float64(freed)/1024/1024)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "部分隔离文件清理失败：%v\n", err)
+		code = 1
+	}
+	return code
+}
+
+// runVerify 按目录中的索引文件重新计算摘要，有文件不一致或缺失时返回 1
+func runVerify(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	verbose := fs.Bool("v", false, "Also list files that passed")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: smartedudl %s [参数] [目录]\n\n目录默认为下载目录，包括其中的子目录。\n\n", name)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	dir := fs.Arg(0)
+	if dir == "" {
+		dir = defaultOutputDir(loadSettings())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "校验 %s\n", dir)
+	summary, err := dl.VerifyFolder(ctx, dir, func(r dl.VerifyResult) {
+		switch r.Status {
+		case dl.VerifyOK:
+			if *verbose {
+				fmt.Fprintf(os.Stdout, "通过  %s\n", r.Path)
+			}
+		case dl.VerifyMissing:
+			fmt.Fprintf(os.Stdout, "缺失  %s\n", r.Path)
+		case dl.VerifyMismatch:
+			fmt.Fprintf(os.Stdout, "不一致  %s：%s\n", r.Path, r.Detail)
+		default:
+			fmt.Fprintf(os.Stdout, "出错  %s：%s\n", r.Path, r.Detail)
+		}
+	})
+	if summary.Indexes > 0 {
+		fmt.Fprintln(os.Stderr, summary)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if !summary.Passed() {
+		return 1
+	}
+	return 0
+}
+
+// readLinks 从文件读取URL列表
+func readLinks(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var links []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		links = append(links, line)
+	}
+	return links, scanner.Err()
+}
+
+// runBundle 将目录打包为离线课程包
+func runBundle(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	output := fs.String("o", "", "Output ZIP file (default: <dir>.zip next to the directory, <dir>-<course>.zip with -course)")
+	course := fs.String("course", "", "Only include the course (lesson) with this ID or whose title contains this text")
+	title := fs.String("title", "", "Title of index.html (default: directory name)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: smartedudl %s [参数] 目录\n\n课程、学校、教师和教材信息来自下载时写入的元数据（-meta）。\n\n", name)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	dir := fs.Arg(0)
+	opts := dl.BundleOptions{Title: *title, Course: *course}
+	zipPath := *output
+	if zipPath == "" {
+		zipPath = dl.DefaultBundlePath(dir, opts)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "打包 %s\n", dir)
+	summary, err := dl.BundleFolder(ctx, dir, zipPath, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%s\n已保存至 %s\n", summary, zipPath)
+	return 0
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hantang/smartedudlgo/internal/dl"
+)
+
+const controlHelp = "运行中可输入：rate <速度>（如 2m、0 不限速）、conns <数量>（0 不限制）、pause、resume"
+
+// applyLimits 设置限速和每个服务器的并发数
+func applyLimits(limit string, hostConns int) error {
+	rate, err := dl.ParseRate(limit)
+	if err != nil {
+		return err
+	}
+	if hostConns < 0 {
+		return fmt.Errorf("invalid host connections: %d", hostConns)
+	}
+	dl.SetRateLimit(rate)
+	dl.SetHostConcurrency(hostConns)
+	return nil
+}
+
+// stdinIsTerminal 只在交互终端中读取运行时命令
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// readControls 读取运行时命令，调整限速、并发数或暂停下载，直到 ctx 结束或输入关闭
+func readControls(ctx context.Context, in io.Reader, out io.Writer, manager *dl.DownloadManager) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch cmd := strings.ToLower(fields[0]); {
+		case cmd == "rate" && len(fields) == 2:
+			rate, err := dl.ParseRate(fields[1])
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			dl.SetRateLimit(rate)
+			fmt.Fprintf(out, "限速：%s\n", dl.FormatRate(rate))
+		case cmd == "conns" && len(fields) == 2:
+			conns, err := strconv.Atoi(fields[1])
+			if err != nil || conns < 0 {
+				fmt.Fprintf(out, "无效的数量：%s\n", fields[1])
+				continue
+			}
+			dl.SetHostConcurrency(conns)
+			fmt.Fprintf(out, "每个服务器并发数：%s\n", formatHostConns(conns))
+		case cmd == "pause":
+			manager.Pause()
+			fmt.Fprintln(out, "已暂停，进行中的文件完成后停止")
+		case cmd == "resume":
+			manager.Resume()
+			fmt.Fprintln(out, "继续下载")
+		default:
+			fmt.Fprintln(out, controlHelp)
+		}
+	}
+}
+
+func formatHostConns(conns int) string {
+	if conns <= 0 {
+		return "不限制"
+	}
+	return strconv.Itoa(conns)
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hantang/smartedudlgo/internal/dl"
+)
+
+const progressWidth = 30
+
+// termReporter 订阅下载事件，在终端展示下载进度
+type termReporter struct {
+	mu        sync.Mutex
+	out       io.Writer
+	isTTY     bool
+	lastFiles int64
+}
+
+func newTermReporter(out *os.File) *termReporter {
+	isTTY := false
+	if info, err := out.Stat(); err == nil {
+		isTTY = info.Mode()&os.ModeCharDevice != 0
+	}
+	return &termReporter{out: out, isTTY: isTTY, lastFiles: -1}
+}
+
+func (r *termReporter) OnEvent(e dl.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch e := e.(type) {
+	case dl.BatchStarted:
+		fmt.Fprintf(r.out, "开始下载 %d 个文件\n", e.Total)
+	case dl.BatchProgress:
+		r.progress(e)
+	case dl.JobFinished:
+		if e.Status == dl.JobFailed {
+			r.clearLine()
+			fmt.Fprintf(r.out, "✗ %s：%v\n", e.Link.Title, e.Err)
+		}
+	case dl.BatchFinished:
+		r.finish(e.Result)
+	}
+}
+
+func (r *termReporter) clearLine() {
+	if r.isTTY {
+		fmt.Fprint(r.out, "\r\033[K")
+	}
+}
+
+func (r *termReporter) progress(e dl.BatchProgress) {
+	statusText := fmt.Sprintf("下载中... %d/%d 个文件", e.FilesDone, e.Total)
+	if e.Retries > 0 {
+		statusText += fmt.Sprintf(" (重试: %d次)", e.Retries)
+	}
+
+	if !r.isTTY {
+		// 非终端（如重定向到文件）仅在文件数变化时输出
+		if e.FilesDone != r.lastFiles {
+			r.lastFiles = e.FilesDone
+			fmt.Fprintln(r.out, statusText)
+		}
+		return
+	}
+
+	progress := min(max(e.Progress, 0), 1)
+	filled := int(progress * progressWidth)
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressWidth-filled)
+	fmt.Fprintf(r.out, "\r[%s] %5.1f%% %s", bar, progress*100, statusText)
+}
+
+func (r *termReporter) finish(result dl.DownloadResult) {
+	if r.isTTY {
+		fmt.Fprintln(r.out)
+	}
+	if result.Err != nil {
+		fmt.Fprintln(r.out, result.Err)
+		return
+	}
+
+	title := "下载完成"
+	if result.Canceled > 0 {
+		title = "下载已取消"
+	}
+	fmt.Fprintf(r.out, "%s：成功/失败 = %d/%d\n%s\n", title, result.Success, result.Failed, result.Summary())
+	if result.Canceled > 0 {
+		return
+	}
+	if result.TokenInvalid || result.Success+result.Skipped == 0 {
+		fmt.Fprintln(r.out, "⚠️  【登录信息】可能错误或者失效")
+	}
+}
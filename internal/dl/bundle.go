@@ -0,0 +1,507 @@
+package dl
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 离线课程包中的首页
+const bundleIndexFile = "index.html"
+
+// 已压缩的格式直接存储，不再压缩
+var storedFormats = []string{"mp4", "ts", "mp3", "ogg", "m4a", "jpg", "jpeg", "png", "gif", "webp", "zip", "superboard"}
+
+// BundleSummary 打包结果
+type BundleSummary struct {
+	Lessons int
+	Files   int
+	Bytes   int64
+}
+
+func (s BundleSummary) String() string {
+	return fmt.Sprintf("课程 %d 节，文件 %d 个，共 %s", s.Lessons, s.Files, FormatBytes(s.Bytes))
+}
+
+// bundleFile 课程包中的一个文件，Path 为相对打包目录的路径（/ 分隔）
+type bundleFile struct {
+	Path   string
+	Href   string
+	Title  string
+	Format string
+	Type   string // 资源类型，如 课件、教学设计
+	Kind   string // 首页中的展示方式：video、audio、image 或 link
+	Size   string
+	order  int
+	bytes  int64
+}
+
+// bundleLesson 一节课（课程包），没有元数据的文件按所在目录归为一节
+type bundleLesson struct {
+	ID       string
+	Title    string
+	Book     string
+	BookID   string
+	School   string
+	Teachers string
+	Files    []bundleFile
+}
+
+// BundleOptions 打包参数
+type BundleOptions struct {
+	Title    string      // 首页标题，为空时使用目录名
+	Course   string      // 只打包课程ID或标题包含该文本的课程，为空时打包全部
+	Chapters []CourseToc // 只打包这些章节中的课程（按课程ID匹配），并按目录顺序排列；为空时不限制
+}
+
+// BundleBook 目录中已下载课程所属的教材，用于选择按章节打包
+type BundleBook struct {
+	ID    string
+	Title string
+}
+
+type bundlePage struct {
+	Title     string
+	CreatedAt string
+	Summary   BundleSummary
+	Lessons   []bundleLesson
+}
+
+// BundleFolder 将 dir 中下载的文件打包为 zipPath，包含按课程列出全部文件的 index.html（视频、音频可直接播放），
+// 课程、学校、教师和教材信息来自下载时写入的元数据文件
+func BundleFolder(ctx context.Context, dir string, zipPath string, opts BundleOptions) (BundleSummary, error) {
+	var summary BundleSummary
+	lessons, err := collectBundle(dir, zipPath)
+	if err != nil {
+		return summary, err
+	}
+	if opts.Course != "" {
+		lessons = slices.DeleteFunc(lessons, func(lesson bundleLesson) bool {
+			return lesson.ID != opts.Course && !strings.Contains(lesson.Title, opts.Course)
+		})
+	}
+	if len(opts.Chapters) > 0 {
+		lessons = filterChapters(lessons, opts.Chapters)
+	}
+	if len(lessons) == 0 {
+		if opts.Course != "" {
+			return summary, fmt.Errorf("%s 中没有课程 %q 的文件", dir, opts.Course)
+		}
+		if len(opts.Chapters) > 0 {
+			return summary, fmt.Errorf("%s 中没有所选章节的课程文件", dir)
+		}
+		return summary, fmt.Errorf("%s 中没有可打包的文件", dir)
+	}
+	summary.Lessons = len(lessons)
+	for _, lesson := range lessons {
+		for _, file := range lesson.Files {
+			summary.Files++
+			summary.Bytes += file.bytes
+		}
+	}
+	title := opts.Title
+	if title == "" {
+		title = filepath.Base(dir)
+		if opts.Course != "" && len(lessons) == 1 {
+			title = lessons[0].Title
+		} else if len(opts.Chapters) == 1 {
+			title = opts.Chapters[0].Title
+		}
+	}
+
+	tmpPath := zipPath + ".tmp"
+	if err := writeBundle(ctx, dir, tmpPath, bundlePage{
+		Title:     title,
+		CreatedAt: time.Now().Format("2006-01-02 15:04"),
+		Summary:   summary,
+		Lessons:   lessons,
+	}); err != nil {
+		os.Remove(tmpPath)
+		return summary, err
+	}
+	if err := os.Rename(tmpPath, zipPath); err != nil {
+		os.Remove(tmpPath)
+		return summary, err
+	}
+	return summary, nil
+}
+
+// filterChapters 只保留章节中的课程，按章节目录顺序排列
+func filterChapters(lessons []bundleLesson, chapters []CourseToc) []bundleLesson {
+	order := make(map[string]int)
+	for _, chapter := range chapters {
+		for _, item := range chapter.Children {
+			if _, ok := order[item.CourseID]; !ok && item.CourseID != "" {
+				order[item.CourseID] = len(order)
+			}
+		}
+	}
+	lessons = slices.DeleteFunc(lessons, func(lesson bundleLesson) bool {
+		_, ok := order[lesson.ID]
+		return !ok
+	})
+	slices.SortStableFunc(lessons, func(a, b bundleLesson) int {
+		return cmp.Compare(order[a.ID], order[b.ID])
+	})
+	return lessons
+}
+
+// BundleBooks 目录中已下载课程所属的教材（来自元数据），按标题排序
+func BundleBooks(dir string) ([]BundleBook, error) {
+	lessons, err := collectBundle(dir, "")
+	if err != nil {
+		return nil, err
+	}
+	var books []BundleBook
+	for _, lesson := range lessons {
+		if lesson.BookID != "" && !slices.ContainsFunc(books, func(book BundleBook) bool { return book.ID == lesson.BookID }) {
+			books = append(books, BundleBook{ID: lesson.BookID, Title: cmp.Or(lesson.Book, lesson.BookID)})
+		}
+	}
+	slices.SortFunc(books, func(a, b BundleBook) int {
+		return compareTitles(a.Title, b.Title)
+	})
+	return books, nil
+}
+
+// DefaultBundlePath 默认与目录同级的 目录名.zip；只打包部分章节或课程时为 目录名-章节名.zip，不覆盖其他打包结果
+func DefaultBundlePath(dir string, opts BundleOptions) string {
+	dir = filepath.Clean(dir)
+	name := filepath.Base(dir)
+	var parts []string
+	switch {
+	case len(opts.Chapters) == 1:
+		parts = append(parts, opts.Chapters[0].Title)
+	case len(opts.Chapters) > 1:
+		parts = append(parts, cmp.Or(opts.Title, opts.Chapters[0].Title+"等"))
+	}
+	if opts.Course != "" {
+		parts = append(parts, opts.Course)
+	}
+	for _, part := range parts {
+		name += "-" + sanitizeFilename(part)
+	}
+	return filepath.Join(filepath.Dir(dir), name+".zip")
+}
+
+// compareTitles 按标题排序，其中的数字和“第”后的中文数字按数值比较，如“第2课”在“第10课”之前、“第二课”在“第三课”之前
+func compareTitles(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		na, endA := titleNumber(ra, i)
+		nb, endB := titleNumber(rb, j)
+		if endA > i && endB > j {
+			if c := cmp.Compare(na, nb); c != 0 {
+				return c
+			}
+			i, j = endA, endB
+			continue
+		}
+		if c := cmp.Compare(ra[i], rb[j]); c != 0 {
+			return c
+		}
+		i, j = i+1, j+1
+	}
+	return cmp.Or(cmp.Compare(len(ra)-i, len(rb)-j), cmp.Compare(a, b))
+}
+
+var (
+	chineseDigits = map[rune]int{'零': 0, '〇': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+	chineseUnits  = map[rune]int{'十': 10, '百': 100, '千': 1000}
+)
+
+// titleNumber 解析 r[i:] 开头的数字，返回数值和结束位置；不是数字时结束位置为 i
+func titleNumber(r []rune, i int) (int, int) {
+	end := i
+	if r[i] >= '0' && r[i] <= '9' {
+		n := 0
+		for ; end < len(r) && r[end] >= '0' && r[end] <= '9'; end++ {
+			n = min(n*10+int(r[end]-'0'), 1<<53)
+		}
+		return n, end
+	}
+	if i == 0 || r[i-1] != '第' {
+		return 0, i
+	}
+	// 中文数字只处理“第”之后的，如 第十二课、第一百零五页
+	total, digit := 0, 0
+	for ; end < len(r); end++ {
+		if d, ok := chineseDigits[r[end]]; ok {
+			digit = d
+		} else if unit, ok := chineseUnits[r[end]]; ok {
+			total += max(digit, 1) * unit // 十二
+			digit = 0
+		} else {
+			break
+		}
+	}
+	return total + digit, end
+}
+
+// isBundleSkipped 下载过程中生成的文件（报告、索引、临时文件）不打包
+func isBundleSkipped(name string) bool {
+	switch name {
+	case LOG_FILE, REPORT_JSONL_FILE, REPORT_CSV_FILE, INDEX_FILE, MERGED_FILE, bundleIndexFile:
+		return true
+	}
+	return strings.HasPrefix(name, ".") ||
+		strings.HasSuffix(name, partSuffix) ||
+		strings.HasSuffix(name, partSuffix+".json") ||
+		strings.HasSuffix(name, ".tmp")
+}
+
+// collectBundle 查找要打包的文件并读取元数据，按课程分组排序
+func collectBundle(dir string, zipPath string) ([]bundleLesson, error) {
+	var absZip string
+	if zipPath != "" {
+		absZip, _ = filepath.Abs(zipPath)
+	}
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == QUARANTINE_DIR {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); abs == absZip || !d.Type().IsRegular() || isBundleSkipped(d.Name()) {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 已有对应文件的 .json 为元数据文件
+	sidecars := make(map[string]bool)
+	for _, path := range paths {
+		sidecars[path+metadataSuffix] = true
+	}
+	var lessons []bundleLesson
+	lessonIndex := make(map[string]int)
+	for _, path := range paths {
+		if sidecars[path] {
+			continue
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		folder := filepath.ToSlash(filepath.Dir(rel))
+		rel = filepath.ToSlash(rel)
+		format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+		file := bundleFile{
+			Path:   rel,
+			Href:   (&url.URL{Path: rel}).String(),
+			Title:  strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+			Format: format,
+			Kind:   bundleKind(format),
+			Size:   FormatBytes(info.Size()),
+			bytes:  info.Size(),
+		}
+
+		// 没有元数据时按目录分组
+		key := "dir:" + folder
+		lesson := bundleLesson{Title: folder}
+		if folder == "." {
+			lesson.Title = filepath.Base(dir)
+		}
+		if meta, ok := loadResourceMetadata(path + metadataSuffix); ok {
+			if meta.Title != "" {
+				file.Title = meta.Title
+			}
+			file.Type = meta.ResourceType
+			file.order = meta.Order
+			if meta.CourseID != "" {
+				key = "course:" + meta.CourseID
+				lesson.ID = meta.CourseID
+				lesson.Title = cmp.Or(meta.CourseTitle, meta.Folder, lesson.Title)
+			}
+			lesson.Book = cmp.Or(meta.BookTitle, meta.Folder)
+			lesson.BookID = meta.BookID
+			lesson.School = meta.School
+			lesson.Teachers = strings.Join(meta.Teachers, "、")
+		}
+
+		i, ok := lessonIndex[key]
+		if !ok {
+			i = len(lessons)
+			lessonIndex[key] = i
+			lessons = append(lessons, lesson)
+		}
+		// 同一节课中先出现的文件可能没有元数据，补充课程信息
+		current := &lessons[i]
+		current.Book = cmp.Or(current.Book, lesson.Book)
+		current.BookID = cmp.Or(current.BookID, lesson.BookID)
+		current.School = cmp.Or(current.School, lesson.School)
+		current.Teachers = cmp.Or(current.Teachers, lesson.Teachers)
+		current.Files = append(current.Files, file)
+	}
+
+	// 元数据中没有课程在教材目录中的位置，按标题中的序号排序；选择章节时由 filterChapters 按目录顺序排列
+	slices.SortStableFunc(lessons, func(a, b bundleLesson) int {
+		return cmp.Or(compareTitles(a.Book, b.Book), compareTitles(a.Title, b.Title))
+	})
+	for _, lesson := range lessons {
+		// 按课程包中的顺序（视频、课件、教学设计……）
+		slices.SortStableFunc(lesson.Files, func(a, b bundleFile) int {
+			return cmp.Or(cmp.Compare(a.order, b.order), cmp.Compare(a.Path, b.Path))
+		})
+	}
+	return lessons, nil
+}
+
+func loadResourceMetadata(path string) (ResourceMetadata, bool) {
+	var meta ResourceMetadata
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return meta, false
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, false
+	}
+	return meta, true
+}
+
+// bundleKind 浏览器可直接播放的格式使用播放器，其余为链接（TS 视频浏览器不能直接播放）
+func bundleKind(format string) string {
+	switch format {
+	case "mp4", "webm":
+		return "video"
+	case "mp3", "ogg", "m4a", "wav":
+		return "audio"
+	case "jpg", "jpeg", "png", "gif", "webp":
+		return "image"
+	}
+	return "link"
+}
+
+func writeBundle(ctx context.Context, dir string, zipPath string, page bundlePage) (err error) {
+	var index bytes.Buffer
+	if err := bundleTemplate.Execute(&index, page); err != nil {
+		return err
+	}
+
+	f, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	zw := zip.NewWriter(f)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: bundleIndexFile, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(index.Bytes()); err != nil {
+		return err
+	}
+	for _, lesson := range page.Lessons {
+		for _, file := range lesson.Files {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := addBundleFile(zw, filepath.Join(dir, filepath.FromSlash(file.Path)), file); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+func addBundleFile(zw *zip.Writer, path string, file bundleFile) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = file.Path
+	header.Method = zip.Deflate
+	if slices.Contains(storedFormats, file.Format) {
+		header.Method = zip.Store
+	}
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
+
+var bundleTemplate = template.Must(template.New(bundleIndexFile).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 0 auto; padding: 16px; color: #222; }
+header p, .info { color: #666; font-size: 14px; }
+nav ol { padding-left: 24px; }
+section { border-top: 1px solid #ddd; margin-top: 24px; padding-top: 8px; }
+.file { margin: 12px 0; }
+.file .meta { color: #888; font-size: 13px; margin-left: 8px; }
+video, img { display: block; max-width: 100%; margin-top: 8px; }
+audio { display: block; width: 100%; margin-top: 8px; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<p>{{.Summary}}，打包于 {{.CreatedAt}}。请解压后打开本页面，视频和音频可直接播放，文档点击链接打开。</p>
+</header>
+{{if gt (len .Lessons) 1}}<nav>
+<h2>目录</h2>
+<ol>
+{{range $i, $lesson := .Lessons}}<li><a href="#lesson-{{$i}}">{{$lesson.Title}}</a></li>
+{{end}}</ol>
+</nav>
+{{end}}{{range $i, $lesson := .Lessons}}<section id="lesson-{{$i}}">
+<h2>{{$lesson.Title}}</h2>
+{{if or $lesson.Book $lesson.School $lesson.Teachers}}<p class="info">
+{{- if $lesson.Book}}教材：{{$lesson.Book}}　{{end}}
+{{- if $lesson.School}}学校：{{$lesson.School}}　{{end}}
+{{- if $lesson.Teachers}}教师：{{$lesson.Teachers}}{{end}}</p>
+{{end}}{{range $lesson.Files}}<div class="file">
+<a href="{{.Href}}">{{.Title}}</a><span class="meta">{{if .Type}}{{.Type}} · {{end}}{{.Format}} · {{.Size}}</span>
+{{if eq .Kind "video"}}<video controls preload="metadata" src="{{.Href}}"></video>
+{{else if eq .Kind "audio"}}<audio controls preload="none" src="{{.Href}}"></audio>
+{{else if eq .Kind "image"}}<img loading="lazy" alt="{{.Title}}" src="{{.Href}}">
+{{end}}</div>
+{{end}}</section>
+{{end}}</body>
+</html>
+`))
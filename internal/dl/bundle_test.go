@@ -0,0 +1,178 @@
+package dl
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeDownloaded 在 dir/Folder 中保存文件并写入元数据，与下载完成时一致
+func writeDownloaded(t *testing.T, dir string, link LinkData, name string) {
+	t.Helper()
+	path := filepath.Join(dir, link.Folder, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newMetadataWriter().write(JobFinished{Link: link, Status: JobSucceeded, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// zipNames 压缩包中的文件名
+func zipNames(t *testing.T, zipPath string) []string {
+	t.Helper()
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestBundleChapters(t *testing.T) {
+	dir := t.TempDir()
+	for _, course := range []struct{ id, title string }{{"c1", "第一课"}, {"c2", "第二课"}, {"c3", "第三课"}} {
+		link := LinkData{
+			Title:  course.title + "课件",
+			Format: "pdf",
+			Folder: "数学",
+			Meta:   ResourceMeta{BookID: "book", BookTitle: "数学", CourseID: course.id, CourseTitle: course.title},
+		}
+		writeDownloaded(t, dir, link, course.id+".pdf")
+	}
+
+	books, err := BundleBooks(dir)
+	if err != nil || len(books) != 1 || books[0] != (BundleBook{ID: "book", Title: "数学"}) {
+		t.Fatalf("BundleBooks = %v, %v", books, err)
+	}
+
+	chapter := CourseToc{Title: "第一单元", Children: []CourseItem{{CourseID: "c3"}, {CourseID: "c1"}, {CourseID: "other"}}}
+	lessons, err := collectBundle(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lessons = filterChapters(lessons, []CourseToc{chapter})
+	var ids []string
+	for _, lesson := range lessons {
+		ids = append(ids, lesson.ID)
+	}
+	if !slices.Equal(ids, []string{"c3", "c1"}) {
+		t.Fatalf("lessons = %v, want chapter order [c3 c1]", ids)
+	}
+
+	zipPath := filepath.Join(t.TempDir(), "bundle.zip")
+	summary, err := BundleFolder(context.Background(), dir, zipPath, BundleOptions{Chapters: []CourseToc{chapter}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Lessons != 2 || summary.Files != 2 {
+		t.Fatalf("summary = %+v, want 2 lessons, 2 files", summary)
+	}
+	if names := zipNames(t, zipPath); slices.Contains(names, "数学/c2.pdf") || !slices.Contains(names, "数学/c1.pdf") {
+		t.Fatalf("zip files = %v", names)
+	}
+
+	_, err = BundleFolder(context.Background(), dir, zipPath, BundleOptions{Chapters: []CourseToc{{Title: "空", Children: []CourseItem{{CourseID: "other"}}}}})
+	if err == nil {
+		t.Fatal("expected error for chapter without downloaded courses")
+	}
+}
+
+// 视频合集中的视频与课程包中的课件保存在不同目录，按课程ID归为同一节课
+func TestBundleCourseVideoAndDocuments(t *testing.T) {
+	activities := []byte(`{
+		"activity_set_name": "第一课",
+		"nodes": [{"relations": {"activity": {"activity_resources": [
+			{"resource_id": "v1", "video_extend": {"title": "课堂视频", "urls": [{"height": 720, "urls": ["https://example.com/v1.m3u8"]}]}}
+		]}}}]
+	}`)
+	videos := parseCourseActivities(activities, "c1")
+	if len(videos) != 1 {
+		t.Fatalf("got %d videos", len(videos))
+	}
+	if meta := videos[0].Meta; meta.CourseID != "c1" || meta.CourseTitle != "第一课" || meta.Order != 0 {
+		t.Fatalf("video meta = %+v", meta)
+	}
+
+	dir := t.TempDir()
+	writeDownloaded(t, dir, videos[0], "课堂视频.mp4")
+	for i, name := range []string{"课件", "学习任务单"} {
+		link := LinkData{
+			Title:  name,
+			Format: "pdf",
+			Folder: "数学",
+			Meta:   ResourceMeta{BookID: "book", BookTitle: "数学", CourseID: "c1", CourseTitle: "第一课", Order: i + 1},
+		}
+		writeDownloaded(t, dir, link, name+".pdf")
+	}
+
+	lessons, err := collectBundle(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lessons) != 1 {
+		t.Fatalf("got %d lessons, want 1", len(lessons))
+	}
+	var files []string
+	for _, file := range lessons[0].Files {
+		files = append(files, file.Path)
+	}
+	want := []string{"第一课/课堂视频.mp4", "数学/课件.pdf", "数学/学习任务单.pdf"}
+	if lessons[0].ID != "c1" || lessons[0].Book != "数学" || !slices.Equal(files, want) {
+		t.Fatalf("lesson = %s %s %v, want c1 数学 %v", lessons[0].ID, lessons[0].Book, files, want)
+	}
+}
+
+func TestBundleLessonOrder(t *testing.T) {
+	dir := t.TempDir()
+	for i, title := range []string{"第10课", "第2课", "第十一课", "第二课", "第1课"} {
+		link := LinkData{
+			Title:  title + "课件",
+			Format: "pdf",
+			Folder: "数学",
+			Meta:   ResourceMeta{BookID: "book", BookTitle: "数学", CourseID: fmt.Sprintf("c%d", i), CourseTitle: title},
+		}
+		writeDownloaded(t, dir, link, link.Meta.CourseID+".pdf")
+	}
+	lessons, err := collectBundle(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, lesson := range lessons {
+		titles = append(titles, lesson.Title)
+	}
+	if want := []string{"第1课", "第2课", "第二课", "第10课", "第十一课"}; !slices.Equal(titles, want) {
+		t.Fatalf("lessons = %v, want %v", titles, want)
+	}
+}
+
+func TestDefaultBundlePath(t *testing.T) {
+	dir := filepath.Join("out", "数学")
+	chapter := CourseToc{Title: "第一单元 数与代数"}
+	tests := []struct {
+		opts BundleOptions
+		want string
+	}{
+		{BundleOptions{}, "数学.zip"},
+		{BundleOptions{Chapters: []CourseToc{chapter}}, "数学-第一单元 数与代数.zip"},
+		{BundleOptions{Title: "数学 一年级", Chapters: []CourseToc{chapter, {Title: "第二单元"}}}, "数学-数学 一年级.zip"},
+		{BundleOptions{Course: "c1/2"}, "数学-c1_2.zip"},
+	}
+	for _, tt := range tests {
+		if got := DefaultBundlePath(dir, tt.opts); got != filepath.Join("out", tt.want) {
+			t.Errorf("DefaultBundlePath(%+v) = %q, want %q", tt.opts, got, filepath.Join("out", tt.want))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package dl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// hostHealth 记录本次运行中请求失败的服务器，之后优先使用其他服务器
+type hostHealth struct {
+	mu        sync.RWMutex
+	unhealthy map[string]bool
+}
+
+var cdnHealth = &hostHealth{unhealthy: make(map[string]bool)}
+
+func (h *hostHealth) markUnhealthy(host string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.unhealthy[host] {
+		slog.Info(fmt.Sprintf("服务器 %s 异常，本次运行中优先使用其他服务器", host))
+	}
+	h.unhealthy[host] = true
+}
+
+func (h *hostHealth) isHealthy(host string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return !h.unhealthy[host]
+}
+
+func linkHost(link string) string {
+	parsedURL, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return parsedURL.Hostname()
+}
+
+// cdnCandidates 同一路径在 SERVER_LIST 或 BDCS_SERVER_LIST 其他服务器上的链接，原链接在前
+func cdnCandidates(link string) []string {
+	candidates := []string{link}
+	parsedURL, err := url.Parse(link)
+	if err != nil || !strings.HasSuffix(parsedURL.Hostname(), CDN_DOMAIN) {
+		return candidates
+	}
+
+	prefix := strings.TrimSuffix(parsedURL.Hostname(), CDN_DOMAIN)
+	for _, serverList := range [][]string{SERVER_LIST, BDCS_SERVER_LIST} {
+		if !slices.Contains(serverList, prefix) {
+			continue
+		}
+		for _, server := range serverList {
+			if server == prefix {
+				continue
+			}
+			mirrorURL := *parsedURL
+			mirrorURL.Host = server + CDN_DOMAIN
+			if port := parsedURL.Port(); port != "" {
+				mirrorURL.Host += ":" + port
+			}
+			candidates = append(candidates, mirrorURL.String())
+		}
+	}
+	return candidates
+}
+
+// failoverCandidates 展开CDN备选服务器并去重，异常服务器排在最后
+func failoverCandidates(links []string) []string {
+	var healthy, unhealthy []string
+	seen := make(map[string]bool)
+	for _, link := range links {
+		for _, candidate := range cdnCandidates(link) {
+			if candidate == "" || seen[candidate] {
+				continue
+			}
+			seen[candidate] = true
+			if cdnHealth.isHealthy(linkHost(candidate)) {
+				healthy = append(healthy, candidate)
+			} else {
+				unhealthy = append(unhealthy, candidate)
+			}
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// shouldFailover 网络错误或服务器错误（5xx）时切换服务器
+func shouldFailover(err error) bool {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	// 域名解析失败、连接失败等
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	if errors.As(err, &dnsErr) || errors.As(err, &opErr) {
+		return true
+	}
+	return isNetworkError(err)
+}
+
+// tryNextCandidate 无权限、文件不存在、内容无效或校验失败、需要切换服务器时尝试下一个候选链接
+func tryNextCandidate(err error) bool {
+	if errors.Is(err, errIntegrity) || errors.Is(err, errInvalidContent) {
+		return true
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+			return true
+		}
+	}
+	return shouldFailover(err)
+}
+
+// withFailover 依次在候选链接（含CDN备选服务器）上执行 fn，直到成功或遇到无需切换的错误
+func withFailover(ctx context.Context, links []string, fn func(link string) error) error {
+	candidates := failoverCandidates(links)
+	if len(candidates) == 0 {
+		return fmt.Errorf("没有可用的下载链接")
+	}
+
+	var err error
+	for i, candidate := range candidates {
+		err = fn(candidate)
+		if isCanceled(ctx, err) {
+			return err
+		}
+		if err == nil {
+			if i > 0 {
+				slog.Info(fmt.Sprintf("已切换至 %s", candidate))
+			}
+			return nil
+		}
+		if !tryNextCandidate(err) {
+			return err
+		}
+		if shouldFailover(err) {
+			cdnHealth.markUnhealthy(linkHost(candidate))
+		}
+		if i < len(candidates)-1 {
+			slog.Debug("request failed, trying next candidate", "url", candidate, "err", err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// ConflictPolicy 保存文件已存在时的处理方式
+type ConflictPolicy string
+
+const (
+	ConflictRename    ConflictPolicy = "rename"    // 自动重命名，如“教材 (1).pdf”
+	ConflictSkip      ConflictPolicy = "skip"      // 已存在且大小一致则跳过
+	ConflictOverwrite ConflictPolicy = "overwrite" // 覆盖已存在文件
+	ConflictVerify    ConflictPolicy = "verify"    // 校验通过则跳过，否则重新下载覆盖
+)
+
+type ConflictPolicyData struct {
+	Name   string
+	Policy ConflictPolicy
+}
+
+var CONFLICT_POLICY_LIST = []ConflictPolicyData{
+	{"自动重命名", ConflictRename},
+	{"跳过已存在", ConflictSkip},
+	{"覆盖", ConflictOverwrite},
+	{"校验后跳过", ConflictVerify},
+}
+
+// ParseConflictPolicy 解析命令行等输入的处理方式，默认自动重命名
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+	if value == "" {
+		return ConflictRename, nil
+	}
+	for _, item := range CONFLICT_POLICY_LIST {
+		if string(item.Policy) == value || item.Name == value {
+			return item.Policy, nil
+		}
+	}
+	return ConflictRename, fmt.Errorf("invalid conflict policy: %s", value)
+}
+
+// errFileSkipped 文件已存在，按处理方式跳过下载
+var errFileSkipped = errors.New("文件已存在，跳过")
+
+// checkExisting 检查保存路径是否已有文件，返回是否跳过下载以及下载时是否覆盖
+func (dm *DownloadManager) checkExisting(file LinkData, policy ConflictPolicy) (existingPath string, skip bool, overwrite bool) {
+	existingPath = dm.buildSavePath(file, file.Format, 0)
+	info, err := os.Stat(existingPath)
+	if err != nil || !info.Mode().IsRegular() {
+		if mergedPath, ok := checkMerged(existingPath, file, policy); ok {
+			return mergedPath, true, false
+		}
+		return existingPath, false, policy == ConflictOverwrite
+	}
+
+	switch policy {
+	case ConflictSkip:
+		// 大小未知时只要求文件非空
+		if sizeMatches(info.Size(), file.Size) {
+			return existingPath, true, false
+		}
+		slog.Info(fmt.Sprintf("%s 大小不一致（%d/%d），重命名保存", existingPath, info.Size(), file.Size))
+		return existingPath, false, false
+	case ConflictVerify:
+		err := verifyExisting(existingPath, info, file)
+		if err == nil {
+			return existingPath, true, false
+		}
+		slog.Info(fmt.Sprintf("%s 校验失败（%v），重新下载", existingPath, err))
+		return existingPath, false, true
+	case ConflictOverwrite:
+		return existingPath, false, true
+	}
+	return existingPath, false, false
+}
+
+// checkMerged 原文件合并后已删除（-merge-remove）时，按合并时记录的大小和 MD5 跳过或校验，返回合并文件
+func checkMerged(path string, file LinkData, policy ConflictPolicy) (string, bool) {
+	if policy != ConflictSkip && policy != ConflictVerify {
+		return "", false
+	}
+	mergedPath, source, ok := findMerged(path)
+	if !ok {
+		return "", false
+	}
+	if !sizeMatches(source.Size, file.Size) {
+		slog.Info(fmt.Sprintf("%s 已合并到 %s，但大小不一致（%d/%d），重新下载", path, mergedPath, source.Size, file.Size))
+		return "", false
+	}
+	if policy == ConflictVerify {
+		if file.MD5 != "" && !strings.EqualFold(source.MD5, file.MD5) {
+			slog.Info(fmt.Sprintf("%s 已合并到 %s，但MD5不一致，重新下载", path, mergedPath))
+			return "", false
+		}
+		if err := validateContent(mergedPath, "pdf"); err != nil {
+			slog.Info(fmt.Sprintf("%s 校验失败（%v），重新下载 %s", mergedPath, err, path))
+			return "", false
+		}
+	}
+	return mergedPath, true
+}
+
+func sizeMatches(actual int64, expected int64) bool {
+	if expected > 0 {
+		return actual == expected
+	}
+	return actual > 0
+}
+
+// verifyExisting 校验已存在文件是否完整
+func verifyExisting(path string, info os.FileInfo, file LinkData) error {
+	if !sizeMatches(info.Size(), file.Size) {
+		return fmt.Errorf("大小不一致：%d/%d", info.Size(), file.Size)
+	}
+	// 检查内容格式，资源信息提供 MD5 时比较 MD5
+	if err := validateContent(path, file.Format); err != nil {
+		return err
+	}
+	if file.MD5 != "" {
+		_, err := checkDownloaded(path, file)
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// 确认文件可读
+	buf := make([]byte, 1)
+	if _, err := f.Read(buf); err != nil {
+		return fmt.Errorf("读取失败：%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package dl
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 资源信息中的大小和 MD5 对应 m3u8 列表，已存在的视频文件不应因此重新下载或重命名保存
+func TestExistingVideoSkipped(t *testing.T) {
+	tsData := bytes.Repeat(append([]byte{tsSyncByte}, make([]byte, tsPacketSize-1)...), 4)
+	tests := []struct {
+		name      string
+		conflict  ConflictPolicy
+		container VideoContainer
+		data      []byte
+	}{
+		{"skip mp4", ConflictSkip, ContainerMP4, []byte("existing video")},
+		{"verify ts", ConflictVerify, ContainerTS, tsData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// 链接无法访问，重新下载时会失败
+			link := LinkData{
+				Format:    "m3u8",
+				Title:     "视频",
+				Size:      123456,
+				MD5:       "d41d8cd98f00b204e9800998ecf8427e",
+				BackupURL: "http://127.0.0.1:1/video.m3u8",
+			}
+			dm := NewDownloadManager(dir, []LinkData{link})
+			existing := dm.buildSavePath(link, tt.container.suffix(), 0)
+			if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(existing, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			result := dm.StartDownload(context.Background(), DownloadOptions{
+				IsVideo:   true,
+				Conflict:  tt.conflict,
+				Container: tt.container,
+			})
+			if result.Skipped != 1 {
+				t.Fatalf("result = %+v, want 1 skipped", result)
+			}
+			entries, _ := os.ReadDir(filepath.Dir(existing))
+			if len(entries) != 1 {
+				t.Fatalf("got %d files in %s, want only the existing one", len(entries), filepath.Dir(existing))
+			}
+		})
+	}
+}
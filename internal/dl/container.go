@@ -0,0 +1,75 @@
+package dl
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/hantang/smartedudlgo/internal/remux"
+)
+
+// VideoContainer 视频保存格式
+type VideoContainer string
+
+const (
+	ContainerMP4 VideoContainer = "mp4" // 转封装为MP4（H.264/AAC），失败时保留TS
+	ContainerTS  VideoContainer = "ts"  // 直接保存合并后的TS
+)
+
+type VideoContainerData struct {
+	Name      string
+	Container VideoContainer
+}
+
+var VIDEO_CONTAINER_LIST = []VideoContainerData{
+	{"MP4", ContainerMP4},
+	{"TS", ContainerTS},
+}
+
+// ParseVideoContainer 解析命令行等输入的视频格式，默认MP4
+func ParseVideoContainer(value string) (VideoContainer, error) {
+	if value == "" {
+		return ContainerMP4, nil
+	}
+	for _, item := range VIDEO_CONTAINER_LIST {
+		if string(item.Container) == value || item.Name == value {
+			return item.Container, nil
+		}
+	}
+	return ContainerMP4, fmt.Errorf("invalid video container: %s", value)
+}
+
+// suffix 保存文件后缀
+func (c VideoContainer) suffix() string {
+	if c == ContainerTS {
+		return "ts"
+	}
+	return "mp4"
+}
+
+// remuxToMP4 将下载的TS转为MP4；失败时改为保存TS，返回最终保存路径
+func (dm *DownloadManager) remuxToMP4(tsPath string, outputPath string, file LinkData, overwrite bool) (string, error) {
+	err := remux.Remux(tsPath, outputPath)
+	if err == nil {
+		if removeErr := os.Remove(tsPath); removeErr != nil {
+			slog.Warn(fmt.Sprintf("删除临时文件 %s 出错：%v", tsPath, removeErr))
+		}
+		return outputPath, nil
+	}
+
+	slog.Warn(fmt.Sprintf("%s 转换MP4失败，保存为TS：%v", file.Title, err))
+	tsOutput, reservedFile, reserveErr := dm.reserveSavePath(file, string(ContainerTS), overwrite)
+	if reserveErr != nil {
+		return tsOutput, fmt.Errorf("创建文件 %s 出错：%w", tsOutput, reserveErr)
+	}
+	if err := reservedFile.Close(); err != nil {
+		return tsOutput, err
+	}
+	if err := os.Rename(tsPath, tsOutput); err != nil {
+		return tsOutput, fmt.Errorf("保存文件 %s 出错：%w", tsOutput, err)
+	}
+	if err := os.Remove(outputPath); err != nil && !os.IsNotExist(err) {
+		slog.Warn(fmt.Sprintf("删除文件 %s 出错：%v", outputPath, err))
+	}
+	return tsOutput, nil
+}
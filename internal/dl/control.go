@@ -0,0 +1,72 @@
+package dl
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseGate 暂停时阻塞新任务（文件、视频分段）的分发，进行中的任务继续完成
+type pauseGate struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{} // 暂停期间打开，继续时关闭
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		g.paused = true
+		g.resumed = make(chan struct{})
+	}
+}
+
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		g.paused = false
+		close(g.resumed)
+	}
+}
+
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// wait 暂停时等待继续，取消时返回 ctx 的错误
+func (g *pauseGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	paused, resumed := g.paused, g.resumed
+	g.mu.Unlock()
+	if paused {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+		}
+	}
+	return ctx.Err()
+}
+
+type pauseGateKey struct{}
+
+// withPauseGate 随 ctx 传递暂停状态，视频分段下载同样在暂停时停止分发
+func withPauseGate(ctx context.Context, gate *pauseGate) context.Context {
+	return context.WithValue(ctx, pauseGateKey{}, gate)
+}
+
+// waitIfPaused 分发下一个任务前调用
+func waitIfPaused(ctx context.Context) error {
+	if gate, ok := ctx.Value(pauseGateKey{}).(*pauseGate); ok {
+		return gate.wait(ctx)
+	}
+	return ctx.Err()
+}
+
+// isCanceled 错误是否由取消下载引起：只看下载的 ctx 是否已结束，
+// 请求超时等包含 context.DeadlineExceeded 的错误仍可重试或切换链接
+func isCanceled(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() != nil
+}
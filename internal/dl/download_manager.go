@@ -1,21 +1,18 @@
 package dl
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-
-	"fyne.io/fyne/v2"
-	"fyne.io/fyne/v2/dialog"
-	"fyne.io/fyne/v2/widget"
 )
 
 // DownloadStats 线程安全的下载统计
@@ -24,6 +21,8 @@ type DownloadStats struct {
 	downloadedFiles atomic.Int64
 	successCount    atomic.Int64
 	retryCount      atomic.Int64
+	skippedCount    atomic.Int64
+	canceledCount   atomic.Int64
 	statsMu         sync.RWMutex
 }
 
@@ -41,33 +40,127 @@ func (ds *DownloadStats) GetProgress(totalSize int64, totalFiles int) (progress
 	return
 }
 
-// DownloadManager 处理下载逻辑
+// DownloadOptions 下载参数
+type DownloadOptions struct {
+	Headers        map[string]string
+	EnableLog      bool
+	IsVideo        bool
+	MaxConcurrency int
+	Conflict       ConflictPolicy
+	Container      VideoContainer // 视频保存格式，默认MP4
+	Quality        QualityPolicy  // 视频清晰度，默认最高
+	NameTemplate   string         // 保存路径模板，为空时使用 DefaultNameTemplate
+	WriteMetadata  bool           // 文件旁写入元数据文件并更新目录索引
+	MergePDF       bool           // 全部结束后将同一 Folder 的多个 PDF 合并为一个带书签的文件
+	RemoveMerged   bool           // 合并成功后删除原文件
+	Retries        int            // 每个请求最多尝试次数（含第一次），为0时使用默认值
+}
+
+// DownloadResult 下载结果统计
+type DownloadResult struct {
+	Total        int
+	Success      int
+	Failed       int
+	Skipped      int
+	Canceled     int
+	Retries      int64
+	TokenInvalid bool
+	DownloadsDir string
+	Err          error
+}
+
+// Summary 下载结果摘要文本
+func (r DownloadResult) Summary() string {
+	statsInfo := fmt.Sprintf("- 成功：%d\n- 失败：%d", r.Success, r.Failed)
+	if r.Skipped > 0 {
+		statsInfo += fmt.Sprintf("\n- 跳过：%d", r.Skipped)
+	}
+	if r.Canceled > 0 {
+		statsInfo += fmt.Sprintf("\n- 取消：%d", r.Canceled)
+	}
+	if r.Retries > 0 {
+		statsInfo += fmt.Sprintf("\n- 重试：%d次", r.Retries)
+	}
+	if r.Success+r.Skipped > 0 {
+		statsInfo += fmt.Sprintf("\n(已保存至%v)", r.DownloadsDir)
+	}
+	return statsInfo
+}
+
+// DownloadManager 处理下载逻辑，通过 Observer 通知下载事件
 type DownloadManager struct {
-	window       fyne.Window
-	progressBar  *widget.ProgressBar
-	statusLabel  *widget.Label
-	downloadsDir string
-	links        []LinkData
-	savePathMu   sync.Mutex
+	downloadsDir  string
+	links         []LinkData
+	savePathMu    sync.Mutex
+	activeParts   map[string]bool
+	reservedPaths map[string]bool
+	nameTemplate  *NameTemplate
+	observersMu   sync.RWMutex
+	observers     []Observer
+	gate          pauseGate
 }
 
-func NewDownloadManager(window fyne.Window, progressBar *widget.ProgressBar, statusLabel *widget.Label, downloadsDir string, links []LinkData) *DownloadManager {
+func NewDownloadManager(downloadsDir string, links []LinkData) *DownloadManager {
 	return &DownloadManager{
-		window:       window,
-		progressBar:  progressBar,
-		statusLabel:  statusLabel,
 		downloadsDir: downloadsDir,
 		links:        links,
 	}
 }
 
-func (dm *DownloadManager) StartDownload(downloadButton *widget.Button, downloadVideoButton *widget.Button, headers map[string]string, enableLog bool, isVideo bool, maxConcurrency int) {
+// Subscribe 注册下载事件订阅者
+func (dm *DownloadManager) Subscribe(observer Observer) {
+	dm.observersMu.Lock()
+	defer dm.observersMu.Unlock()
+	dm.observers = append(dm.observers, observer)
+}
+
+// unsubscribe 取消订阅
+func (dm *DownloadManager) unsubscribe(observers ...Observer) {
+	dm.observersMu.Lock()
+	defer dm.observersMu.Unlock()
+	dm.observers = slices.DeleteFunc(dm.observers, func(observer Observer) bool {
+		return slices.Contains(observers, observer)
+	})
+}
+
+// Pause 暂停：不再开始新的文件和视频分段，进行中的继续完成
+func (dm *DownloadManager) Pause() {
+	dm.gate.pause()
+}
+
+// Resume 继续暂停的下载
+func (dm *DownloadManager) Resume() {
+	dm.gate.resume()
+}
+
+func (dm *DownloadManager) Paused() bool {
+	return dm.gate.isPaused()
+}
+
+func (dm *DownloadManager) emit(e Event) {
+	dm.observersMu.RLock()
+	defer dm.observersMu.RUnlock()
+	for _, observer := range dm.observers {
+		observer.OnEvent(e)
+	}
+}
+
+// StartDownload 阻塞执行下载，直到全部文件完成或 ctx 取消；取消时删除未完成的文件
+func (dm *DownloadManager) StartDownload(ctx context.Context, opts DownloadOptions) DownloadResult {
+	result := DownloadResult{Total: len(dm.links), DownloadsDir: dm.downloadsDir}
+	nameTemplate, err := ParseNameTemplate(opts.NameTemplate)
+	if err != nil {
+		result.Failed = len(dm.links)
+		result.Err = err
+		dm.emit(BatchFinished{Result: result})
+		return result
+	}
+	dm.nameTemplate = nameTemplate
 	if err := os.MkdirAll(dm.downloadsDir, 0755); err != nil {
-		dialog.ShowError(fmt.Errorf("下载目录创建失败：%v", err), dm.window)
-		dm.statusLabel.SetText("创建下载目录失败")
-		downloadButton.Enable()
-		downloadVideoButton.Enable()
-		return
+		result.Failed = len(dm.links)
+		result.Err = fmt.Errorf("下载目录创建失败：%v", err)
+		dm.emit(BatchFinished{Result: result})
+		return result
 	}
 
 	// 计算文件大小
@@ -82,6 +175,7 @@ func (dm *DownloadManager) StartDownload(downloadButton *widget.Button, download
 	stats := &DownloadStats{}
 	var tokenInvalid atomic.Bool
 	var wg sync.WaitGroup
+	maxConcurrency := opts.MaxConcurrency
 	if maxConcurrency < 1 {
 		maxConcurrency = 1
 	}
@@ -89,11 +183,18 @@ func (dm *DownloadManager) StartDownload(downloadButton *widget.Button, download
 		maxConcurrency = len(dm.links)
 	}
 
-	// 初始化：禁用下载按钮
-	downloadButton.Disable()
-	downloadVideoButton.Disable()
-	dm.statusLabel.SetText("正在准备下载...")
-	dm.progressBar.SetValue(0)
+	dm.emit(BatchStarted{Total: len(dm.links), TotalSize: totalSize})
+	batchProgress := func() BatchProgress {
+		progress, numFiles := stats.GetProgress(totalSize, len(dm.links))
+		return BatchProgress{
+			Progress:        progress,
+			FilesDone:       numFiles,
+			Total:           len(dm.links),
+			DownloadedBytes: stats.downloadedBytes.Load(),
+			Retries:         stats.retryCount.Load(),
+			Paused:          dm.gate.isPaused(),
+		}
+	}
 
 	// Update progress in a separate goroutine
 	done := make(chan struct{})
@@ -105,194 +206,229 @@ func (dm *DownloadManager) StartDownload(downloadButton *widget.Button, download
 			case <-done:
 				return
 			case <-ticker.C:
-				progress, numFiles := stats.GetProgress(totalSize, len(dm.links))
-				retries := stats.retryCount.Load()
-
-				fyne.DoAndWait(func() {
-					dm.progressBar.SetValue(progress)
-					statusText := fmt.Sprintf("下载中... %d/%d 个文件", numFiles, len(dm.links))
-					if retries > 0 {
-						statusText += fmt.Sprintf(" (重试: %d次)", retries)
-					}
-					dm.statusLabel.SetText(statusText)
-				})
+				dm.emit(batchProgress())
 			}
 		}
 	}()
 
+	// 本批的报告、合并和元数据订阅者在结束后取消订阅，重试失败文件时复用 DownloadManager 不会重复订阅
+	var batchObservers []Observer
+	subscribeBatch := func(observer Observer) {
+		dm.Subscribe(observer)
+		batchObservers = append(batchObservers, observer)
+	}
+	defer func() {
+		dm.unsubscribe(batchObservers...)
+	}()
+
+	// 记录日志时每个文件结束即写入报告
+	var report *reportWriter
+	if opts.EnableLog {
+		report = newReportWriter(dm.downloadsDir)
+		subscribeBatch(report)
+	}
+	// 文件旁写入元数据，结束后更新目录索引
+	var meta *metadataWriter
+	if opts.WriteMetadata {
+		meta = newMetadataWriter()
+	}
+	// 合并 PDF 先于更新目录索引，索引中包含合并文件并去掉已删除的原文件
+	if opts.MergePDF {
+		subscribeBatch(newPDFMerger(opts.RemoveMerged, meta))
+	}
+	if meta != nil {
+		subscribeBatch(meta)
+	}
+
 	// Start downloads
-	resultCh := make(chan string, len(dm.links))
-	jobs := make(chan LinkData)
+	ctx = withPauseGate(ctx, &dm.gate)
+	// 开始时复制重试策略，下载过程中修改设置不影响本批
+	ctx = withRetryPolicy(ctx, defaultRetryPolicy.withAttempts(opts.Retries))
+	jobs := make(chan int)
 	for range maxConcurrency {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for file := range jobs {
-				isSuccess, statusCode, outputPath := false, 0, ""
-				if isVideo {
-					isSuccess, statusCode, outputPath = dm.downloadVideoFile(file, &stats.downloadedBytes, headers, maxConcurrency, &stats.retryCount)
+			for index := range jobs {
+				file := dm.links[index]
+				// 暂停时等待继续
+				if waitIfPaused(ctx) != nil {
+					// 已取消，剩余任务不再下载
+					stats.canceledCount.Add(1)
+					dm.emit(JobFinished{Index: index, Link: file, Status: JobCanceled, Err: ctx.Err()})
+					continue
+				}
+				tracker := newJobTracker(dm, stats, index, file.Size)
+				dm.emit(JobStarted{Index: index, Link: file})
+
+				var (
+					statusCode int
+					outputPath string
+					sourceURL  string
+					digest     FileDigest
+					err        error
+				)
+				if opts.IsVideo {
+					statusCode, outputPath, sourceURL, err = dm.downloadVideoFile(ctx, file, opts, maxConcurrency, tracker)
 				} else {
-					isSuccess, statusCode, outputPath = dm.downloadFile(file, &stats.downloadedBytes, headers)
+					statusCode, outputPath, sourceURL, digest, err = dm.downloadFile(ctx, &file, opts, tracker)
+				}
+				isSkipped := errors.Is(err, errFileSkipped)
+				isSuccess := err == nil
+				canceled := err != nil && ctx.Err() != nil
+				if isSkipped {
+					slog.Info(fmt.Sprintf("跳过已存在文件 %s", outputPath))
+					err = nil
+				} else if canceled {
+					slog.Info(fmt.Sprintf("已取消下载 %s", file.Title))
+					stats.canceledCount.Add(1)
+					dm.emit(JobFinished{Index: index, Link: file, Status: JobCanceled, Bytes: tracker.bytes.Load(), Err: err})
+					continue
+				} else if err != nil {
+					slog.Warn(fmt.Sprintf("下载 %s 出错：%v", file.Title, err))
 				}
 				stats.downloadedFiles.Add(1)
 				if isSuccess {
 					stats.successCount.Add(1)
 				}
+				if isSkipped {
+					stats.skippedCount.Add(1)
+					// 计入整体进度
+					if file.Size > 0 {
+						stats.downloadedBytes.Add(file.Size)
+					}
+				}
 				if statusCode == http.StatusUnauthorized { // token 失效
 					tokenInvalid.Store(true)
 				}
 
-				// TODO 更好的日志格式，目前是csv
-				now := time.Now().Format("2006-01-02 15:04:05 MST")
-				resultCh <- fmt.Sprintf("%s,%v,%d,%s,%s,%s", now, isSuccess, file.Size, outputPath, file.RawURL, file.BackupURL)
+				// 报告和元数据使用保存文件的摘要，校验 MD5 时已计算的不再重复读取文件
+				if isSuccess && digest.SHA256 == "" && (opts.EnableLog || opts.WriteMetadata) {
+					var hashErr error
+					if digest, _, hashErr = hashFile(outputPath); hashErr != nil {
+						slog.Debug("failed to hash file", "path", outputPath, "err", hashErr)
+					}
+				}
+
+				status := JobSucceeded
+				if isSkipped {
+					status = JobSkipped
+				} else if !isSuccess {
+					status = JobFailed
+				}
+				dm.emit(JobFinished{
+					Index:      index,
+					Link:       file,
+					Status:     status,
+					StatusCode: statusCode,
+					Path:       outputPath,
+					URL:        sourceURL,
+					Bytes:      tracker.bytes.Load(),
+					Digest:     digest,
+					Err:        err,
+				})
 			}
 		}()
 	}
 	go func() {
-		for _, file := range dm.links {
-			jobs <- file
+		for index := range dm.links {
+			jobs <- index
 		}
 		close(jobs)
 	}()
 
-	// Wait for completion in a goroutine
-	go func() {
-		wg.Wait()
-		close(done)
-		close(resultCh)
-		results := []string{"\nlog-time,success,file-size,save-path,raw-url,extra-url"}
-		for result := range resultCh {
-			results = append(results, result)
-		}
+	wg.Wait()
+	close(done)
 
-		// Update progress bar on main thread
-		fyne.DoAndWait(func() {
-			dm.progressBar.SetValue(1.0)
-		})
+	result.Success = int(stats.successCount.Load())
+	result.Skipped = int(stats.skippedCount.Load())
+	result.Canceled = int(stats.canceledCount.Load())
+	result.Failed = len(dm.links) - result.Success - result.Skipped - result.Canceled
+	result.Retries = stats.retryCount.Load()
+	result.TokenInvalid = tokenInvalid.Load()
 
-		successes := int(stats.successCount.Load())
-		failedCount := len(dm.links) - successes
-		retries := stats.retryCount.Load()
-		statsInfo := fmt.Sprintf("- 成功：%d\n- 失败：%d", successes, failedCount)
-		if retries > 0 {
-			statsInfo += fmt.Sprintf("\n- 重试：%d次", retries)
-		}
-		if successes > 0 {
-			statsInfo += fmt.Sprintf("\n(已保存至%v)", dm.downloadsDir)
-		}
-
-		if enableLog {
-			now := time.Now().Format("2006-01-02 15:04:05 MST")
-			more := []string{
-				"",
-				"===============================================================",
-				fmt.Sprintf("## %s 下载统计：成功/失败 = %d/%d", now, successes, failedCount),
-				"---------------------------------------------------------------",
-				"**详细信息：**",
-			}
-			results = append(more, results...)
-			saveLogFile(dm.downloadsDir, results)
-		}
+	if report != nil {
+		report.saveSummary(result)
+	}
 
-		fyne.DoAndWait(func() {
-			dm.statusLabel.SetText(fmt.Sprintf("下载完成：成功/失败 = %d/%d", successes, failedCount))
-			if !tokenInvalid.Load() && successes > 0 {
-				dialog.NewInformation("结果", "文件下载完成：\n"+statsInfo, dm.window).Show()
-			} else {
-				dialog.ShowError(fmt.Errorf("⚠️  【登录信息】可能错误或者失效\n\n文件下载结果：\n%s", statsInfo), dm.window)
-			}
-			downloadButton.Enable()
-			downloadVideoButton.Enable()
-		})
-	}()
+	finalProgress := batchProgress()
+	finalProgress.Progress = 1.0
+	dm.emit(finalProgress)
+	dm.emit(BatchFinished{Result: result})
+	return result
 }
 
-func saveLogFile(downloadsDir string, results []string) {
-	filename := LOG_FILE
-	savePath := filepath.Join(downloadsDir, filename)
-	content := strings.Join(append(results, ""), "\n")
-	slog.Info(fmt.Sprintf("Save log to %s", savePath))
+// buildSavePath 构建保存路径：downloadsDir/模板生成的目录/stem (index).suffix
+func (dm *DownloadManager) buildSavePath(file LinkData, suffix string, index int) string {
+	// 修正后缀 m3u8 -> ts
+	if suffix == "m3u8" {
+		suffix = "ts"
+	}
 
-	file, err := os.OpenFile(savePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		slog.Error(fmt.Sprintf("Error opening file: %v", err))
-		return
+	// 按模板生成目录和文件名，并去除特殊字符
+	tmpl := dm.nameTemplate
+	if tmpl == nil {
+		tmpl, _ = ParseNameTemplate(DefaultNameTemplate)
 	}
-	defer file.Close()
-	_, err = file.WriteString(content)
-	if err != nil {
-		slog.Error(fmt.Sprintf("Error writing file: %v", err))
-		return
+	dirs, stem := tmpl.render(file, suffix)
+
+	name := stem
+	if index > 0 {
+		if suffix != "" {
+			name = fmt.Sprintf("%s (%d).%s", stem, index, suffix)
+		} else {
+			name = fmt.Sprintf("%s (%d)", stem, index)
+		}
+	} else {
+		if suffix != "" {
+			name = fmt.Sprintf("%s.%s", stem, suffix)
+		}
 	}
+
+	// 构建路径（目录可选）
+	parts := append([]string{dm.downloadsDir}, dirs...)
+	parts = append(parts, name)
+	return filepath.Join(parts...)
 }
 
+// reserveSavePath 创建保存文件：overwrite 时覆盖同名文件，否则自动重命名
 func (dm *DownloadManager) reserveSavePath(
-	folder string,
-	stem string,
+	file LinkData,
 	suffix string,
-	autoRename bool,
+	overwrite bool,
 ) (string, *os.File, error) {
 
 	dm.savePathMu.Lock()
 	defer dm.savePathMu.Unlock()
 
-	// 修正后缀 m3u8 -> ts
-	if suffix == "m3u8" {
-		suffix = "ts"
-	}
-
-	// 去除文件中特殊字符
-	if folder != "" {
-		folder = sanitizeFilename(folder)
+	if dm.reservedPaths == nil {
+		dm.reservedPaths = make(map[string]bool)
 	}
-	stem = sanitizeFilename(stem)
 
 	index := 0
 	for {
-		name := stem
-
-		if index > 0 {
-			if suffix != "" {
-				name = fmt.Sprintf("%s (%d).%s", stem, index, suffix)
-			} else {
-				name = fmt.Sprintf("%s (%d)", stem, index)
-			}
-		} else {
-			if suffix != "" {
-				name = fmt.Sprintf("%s.%s", stem, suffix)
-			}
-		}
-
-		// 构建路径（folder 可选）
-		parts := []string{dm.downloadsDir}
-
-		if folder != "" {
-			parts = append(parts, folder)
-		}
-
-		parts = append(parts, name)
-		outputPath := filepath.Join(parts...)
+		outputPath := dm.buildSavePath(file, suffix, index)
 
 		dir := filepath.Dir(outputPath)
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			// 目录创建失败
 			return "", nil, err
 		}
-		file, err := os.OpenFile(
-			outputPath,
-			os.O_WRONLY|os.O_CREATE|os.O_EXCL,
-			0644,
-		)
+
+		// 覆盖模式下，本批次已保存的同名文件不覆盖
+		flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		if overwrite && !dm.reservedPaths[outputPath] {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+		file, err := os.OpenFile(outputPath, flag, 0644)
 
 		if err == nil {
+			dm.reservedPaths[outputPath] = true
 			return outputPath, file, nil
 		}
 
 		// 文件已存在
 		if os.IsExist(err) {
-			if !autoRename {
-				return "", nil, fmt.Errorf("file exists: %s", outputPath)
-			}
 			index++
 			continue
 		}
@@ -301,6 +437,35 @@ func (dm *DownloadManager) reserveSavePath(
 		return "", nil, err
 	}
 }
+
+// acquirePartPath 获取下载临时文件（.part）路径。
+// 路径不随已存在文件变化，便于再次运行时续传；同一批次内同名任务使用不同路径。
+func (dm *DownloadManager) acquirePartPath(file LinkData, suffix string) (string, error) {
+	dm.savePathMu.Lock()
+	defer dm.savePathMu.Unlock()
+
+	if dm.activeParts == nil {
+		dm.activeParts = make(map[string]bool)
+	}
+	for index := 0; ; index++ {
+		partPath := dm.buildSavePath(file, suffix, index) + partSuffix
+		if dm.activeParts[partPath] {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(partPath), 0755); err != nil {
+			return "", err
+		}
+		dm.activeParts[partPath] = true
+		return partPath, nil
+	}
+}
+
+func (dm *DownloadManager) releasePartPath(partPath string) {
+	dm.savePathMu.Lock()
+	defer dm.savePathMu.Unlock()
+	delete(dm.activeParts, partPath)
+}
+
 func sanitizeWindowsFilename(name string) string {
 	// 替换所有 Windows 非法字符
 	// 删除路径遍历尝试
@@ -354,105 +519,206 @@ func sanitizeFilename(name string) string {
 	return name
 }
 
-func (dm *DownloadManager) downloadFile(file LinkData, downloadedBytes *atomic.Int64, headers map[string]string) (bool, int, string) {
-	url := file.BackupURL
+// downloadURLs 候选下载链接：有登录信息时原始链接在前，否则备用链接在前、需要登录的 ndr-private 链接在后
+func downloadURLs(file LinkData, headers map[string]string) []string {
+	useRaw := false
 	for _, v := range headers {
 		if v != "" {
-			url = file.RawURL
+			useRaw = true
 			break
 		}
 	}
-	slog.Debug(fmt.Sprintf("Title = %s, URL = %s", file.Title, url))
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		slog.Warn(fmt.Sprintf("创建下载请求 %s 出错: %v", file.Title, err))
-		return false, -1, ""
+	if useRaw {
+		return append([]string{file.RawURL}, file.URLs...)
 	}
-	for k, v := range headers {
-		if v != "" {
-			req.Header.Set(k, v)
+	urls := []string{file.BackupURL}
+	var privateURLs []string
+	for _, link := range file.URLs {
+		if strings.Contains(link, "ndr-private.") {
+			privateURLs = append(privateURLs, link)
+		} else {
+			urls = append(urls, link)
 		}
 	}
+	return append(urls, privateURLs...)
+}
 
-	resp, err := defaultHTTPClient.Do(req)
-	// resp, err := http.Get(file.URL)
-	if err != nil {
-		slog.Warn(fmt.Sprintf("下载 %s 出错: %v", file.Title, err))
-		return false, -1, ""
+// downloadFile 下载单个文件，返回状态码、保存路径、最终使用的下载链接和校验 MD5 时计算的摘要（未计算时为空）；
+// 按响应类型和文件头修正 file.Format
+func (dm *DownloadManager) downloadFile(ctx context.Context, file *LinkData, opts DownloadOptions, counter ProgressCounter) (int, string, string, FileDigest, error) {
+	existingPath, skip, overwrite := dm.checkExisting(*file, opts.Conflict)
+	if skip {
+		return 0, existingPath, "", FileDigest{}, errFileSkipped
 	}
-	defer resp.Body.Close()
-	statusCode := resp.StatusCode
-	if statusCode != 200 {
-		slog.Warn(fmt.Sprintf("下载 %s 状态异常: %v", file.Title, resp.StatusCode))
-		return false, statusCode, ""
-	}
-	outputPath, reservedFile, err := dm.reserveSavePath(file.Folder, file.Title, file.Format, true)
+
+	headers := opts.Headers
+	urls := downloadURLs(*file, headers)
+	slog.Debug(fmt.Sprintf("Title = %s, URL = %s", file.Title, urls[0]))
+
+	partPath, err := dm.acquirePartPath(*file, file.Format)
 	if err != nil {
-		slog.Warn(fmt.Sprintf("创建文件 %s 出错：%v\n", outputPath, err))
-		return false, statusCode, outputPath
+		return -1, "", "", FileDigest{}, fmt.Errorf("创建目录出错：%w", err)
 	}
-	defer reservedFile.Close()
-
-	isSuccess := true
-	buffer := make([]byte, 32*1024) // 32KB大小
-	for {
-		n, err := resp.Body.Read(buffer)
-		if err == io.EOF {
-			break
+	defer dm.releasePartPath(partPath)
+
+	var (
+		statusCode   int
+		sourceURL    string
+		unauthorized bool
+		detected     LinkData
+		digest       FileDigest
+	)
+	progress := newPartCounter(counter)
+	quarantined := false // 只隔离第一次校验失败的内容，之后的重试和其他链接失败时直接删除
+	err = withRetry(ctx, retryPolicyFrom(ctx), file.Title, counter.AddRetry, func() error {
+		// 依次尝试候选链接和其他CDN服务器
+		return withFailover(ctx, urls, func(link string) error {
+			var fetchErr error
+			sourceURL = link
+			statusCode, fetchErr = fetchToPart(ctx, link, partPath, headers, progress)
+			if statusCode == http.StatusUnauthorized {
+				unauthorized = true
+			}
+			if fetchErr != nil {
+				return fetchErr
+			}
+			// 按响应类型和文件头确定实际格式
+			detected = *file
+			detected.Format = detectFormat(partPath, file.Format)
+			// 内容与格式不符（如错误页面）或与资源信息中的大小、MD5 不一致时隔离，尝试其他链接
+			var err error
+			if digest, err = checkPart(partPath, detected); err != nil {
+				slog.Warn(fmt.Sprintf("%s 下载自 %s，%v", file.Title, link, err))
+				if !quarantined {
+					dm.quarantine(partPath, detected, link, err)
+					quarantined = true
+				}
+				removePart(partPath)
+				progress.set(0)
+				return err
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			// 取消下载时不保留临时文件
+			removePart(partPath)
 		}
-		if err != nil {
-			slog.Warn(fmt.Sprintf("读取 %s 出错：%v\n", file.Title, err))
-			isSuccess = false
-			break
-
+		if unauthorized {
+			// 其他候选链接的状态码不能掩盖登录信息失效
+			statusCode = http.StatusUnauthorized
 		}
-		if n > 0 {
-			// Write to file
-			if _, err := reservedFile.Write(buffer[:n]); err != nil {
-				slog.Warn(fmt.Sprintf("写入文件 %s 出错：%v\n", file.Title, err))
-				isSuccess = false
-				break
-			}
-			downloadedBytes.Add(int64(n))
+		return statusCode, "", sourceURL, FileDigest{}, err
+	}
+	slog.Debug(fmt.Sprintf("Title = %s, downloaded from %s", file.Title, sourceURL))
+
+	// 后缀改变时按新的保存路径重新检查已存在文件
+	if detected.Format != file.Format {
+		file.Format = detected.Format
+		existingPath, skip, overwrite = dm.checkExisting(*file, opts.Conflict)
+		if skip {
+			removePart(partPath)
+			return statusCode, existingPath, sourceURL, FileDigest{}, errFileSkipped
 		}
 	}
-	return isSuccess, statusCode, outputPath
+
+	outputPath, reservedFile, err := dm.reserveSavePath(*file, file.Format, overwrite)
+	if err != nil {
+		return statusCode, outputPath, sourceURL, FileDigest{}, fmt.Errorf("创建文件 %s 出错：%w", outputPath, err)
+	}
+	if err := reservedFile.Close(); err != nil {
+		return statusCode, outputPath, sourceURL, FileDigest{}, err
+	}
+	if err := finishPart(partPath, outputPath); err != nil {
+		return statusCode, outputPath, sourceURL, FileDigest{}, fmt.Errorf("保存文件 %s 出错：%w", outputPath, err)
+	}
+	return statusCode, outputPath, sourceURL, digest, nil
 }
 
 func (dm *DownloadManager) downloadVideoFile(
+	ctx context.Context,
 	file LinkData,
-	downloadedBytes *atomic.Int64,
-	headers map[string]string,
+	opts DownloadOptions,
 	maxConcurrency int,
-	retryStats *atomic.Int64,
-) (bool, int, string) {
-	url := file.BackupURL
-	for _, v := range headers {
-		if v != "" {
-			url = file.RawURL
-			break
+	counter ProgressCounter,
+) (int, string, string, error) {
+	// 多种清晰度时按策略选择
+	if index := opts.Quality.Choose(file.Variants); index >= 0 {
+		variant := file.Variants[index]
+		file.RawURL, file.BackupURL, file.URLs = variant.URLs[0], variant.URLs[0], variant.URLs
+		if len(file.Variants) > 1 {
+			slog.Info(fmt.Sprintf("%s 选择清晰度 %s：%dp", file.Title, opts.Quality, variant.Height))
 		}
 	}
 
-	slog.Debug(fmt.Sprintf("URL = %s", url))
-	outputPath, reservedFile, err := dm.reserveSavePath(file.Folder, file.Title, file.Format, true)
+	// 按保存格式检查已存在文件和预留保存路径；资源信息中的大小和 MD5 对应 m3u8 列表，不用于校验
+	file.Format = opts.Container.suffix()
+	file.Size = -1
+	file.MD5 = ""
+	existingPath, skip, overwrite := dm.checkExisting(file, opts.Conflict)
+	if skip {
+		return 0, existingPath, "", errFileSkipped
+	}
+
+	headers := opts.Headers
+	urls := downloadURLs(file, headers)
+
+	slog.Debug(fmt.Sprintf("URL = %s", urls[0]))
+	outputPath, reservedFile, err := dm.reserveSavePath(file, file.Format, overwrite)
 	if err != nil {
-		slog.Warn(fmt.Sprintf("创建文件 %s 出错：%v\n", outputPath, err))
-		return false, -1, outputPath
+		return -1, outputPath, "", fmt.Errorf("创建文件 %s 出错：%w", outputPath, err)
 	}
 	if err := reservedFile.Close(); err != nil {
-		return false, -1, outputPath
+		return -1, outputPath, "", err
+	}
+
+	// MP4 先合并为临时TS文件，再转封装
+	tsPath := outputPath
+	if opts.Container != ContainerTS {
+		tsPath = outputPath + ".ts" + partSuffix
 	}
 
-	statusCode, err := DownloadM3U8(url, outputPath, headers, downloadedBytes, maxConcurrency, retryStats)
-	isSuccess := true
-	if err != nil || statusCode != 200 {
-		slog.Warn(fmt.Sprintf("下载出错 %v", err))
-		isSuccess = false
-		if removeErr := os.Remove(outputPath); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
-			slog.Warn(fmt.Sprintf("删除失败视频文件 %s 出错：%v", outputPath, removeErr))
+	var (
+		statusCode  int
+		sourceURL   string
+		quarantined bool
+	)
+	err = withFailover(ctx, urls, func(link string) error {
+		var m3u8Err error
+		sourceURL = link
+		statusCode, m3u8Err = DownloadM3U8(ctx, link, tsPath, headers, maxConcurrency, opts.Quality, counter)
+		if m3u8Err == nil && statusCode != 200 {
+			m3u8Err = fmt.Errorf("状态异常: %v", statusCode)
+		}
+		if m3u8Err != nil {
+			return m3u8Err
+		}
+		// 合并后的TS不完整时隔离，尝试其他链接
+		if err := validateContent(tsPath, "ts"); err != nil {
+			slog.Warn(fmt.Sprintf("%s 下载自 %s，%v", file.Title, link, err))
+			if !quarantined {
+				dm.quarantine(tsPath, file, link, err)
+				quarantined = true
+			}
+			os.Remove(tsPath)
+			return err
+		}
+		return nil
+	})
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err == nil && tsPath != outputPath {
+		outputPath, err = dm.remuxToMP4(tsPath, outputPath, file, overwrite)
+	}
+	if err != nil {
+		for _, path := range []string{outputPath, tsPath} {
+			if removeErr := os.Remove(path); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+				slog.Warn(fmt.Sprintf("删除失败视频文件 %s 出错：%v", path, removeErr))
+			}
 		}
 	}
-	return isSuccess, statusCode, outputPath
+	return statusCode, outputPath, sourceURL, err
 }
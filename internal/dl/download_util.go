@@ -1,13 +1,18 @@
 package dl
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"path"
+	"slices"
 	"strings"
+
+	"github.com/hantang/smartedudlgo/internal/util"
 )
 
 func getFilename(savePath string) string {
@@ -30,42 +35,117 @@ func getFilename(savePath string) string {
 	return dest
 }
 
-func DownloadFile(url, savePath string) error {
+func DownloadFile(ctx context.Context, url, savePath string) error {
 	slog.Debug("URL = " + url)
 	dest := getFilename(savePath)
 	slog.Info("Save file to " + dest)
 
-	resp, err := defaultHTTPClient.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	slog.Debug(fmt.Sprintf("Download file status code %v", resp.StatusCode))
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("failed to download file: status code %d", resp.StatusCode)
-	}
-
-	out, err := os.Create(dest)
+	// 先写入 .part 文件，中断后再次调用可续传
+	partPath := dest + partSuffix
+	var statusCode int
+	progress := newPartCounter(nopCounter{})
+	err := withRetry(ctx, retryPolicyFrom(ctx), url, nil, func() error {
+		return withFailover(ctx, []string{url}, func(link string) error {
+			var fetchErr error
+			statusCode, fetchErr = fetchToPart(ctx, link, partPath, nil, progress)
+			return fetchErr
+		})
+	})
+	slog.Debug(fmt.Sprintf("Download file status code %v", statusCode))
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to download file: %w", err)
 	}
-	defer out.Close()
-
-	slog.Debug("Downloading file...")
-	_, err = io.Copy(out, resp.Body)
 	slog.Debug("Download finished...")
-	return err
+	return finishPart(partPath, dest)
 }
 
-func FetchJsonData(url string) ([]byte, error, bool) {
-	resp, err := defaultHTTPClient.Get(url)
+func FetchJsonData(ctx context.Context, url string) ([]byte, error, bool) {
+	var (
+		body       []byte
+		statusCode int
+	)
+	err := withRetry(ctx, retryPolicyFrom(ctx), url, nil, func() error {
+		// CDN服务器异常时切换其他服务器
+		return withFailover(ctx, []string{url}, func(link string) error {
+			req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := defaultHTTPClient.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			statusCode = resp.StatusCode
+			slog.Debug(fmt.Sprintf("Fetch JSON status code %v", statusCode))
+
+			body, err = io.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			// 可重试的状态码返回错误，其他状态由调用方判断
+			if slices.Contains(retryPolicyFrom(ctx).RetryStatus, statusCode) {
+				return newStatusError(resp)
+			}
+			return nil
+		})
+	})
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		// 重试后仍失败，与非重试状态码一致处理
+		err = nil
+	}
 	if err != nil {
 		slog.Warn(fmt.Sprintf("Error fetching JSON data: %s", err))
 		return nil, err, false
 	}
-	slog.Debug(fmt.Sprintf("Fetch JSON status code %v", resp.StatusCode))
-	defer resp.Body.Close()
+	return body, nil, statusCode == http.StatusOK
+}
+
+// NewHeaders 根据登录信息构建请求头
+func NewHeaders(token string) map[string]string {
+	headers := map[string]string{}
+	authInfo := util.FulfillToken(token)
+	if authInfo != "" {
+		headers["x-nd-auth"] = authInfo
+	}
+	slog.Debug("headers initialized", "hasAuth", headers["x-nd-auth"] != "")
+	return headers
+}
+
+// SummarizeResources 按格式统计解析到的资源
+func SummarizeResources(links []LinkData) string {
+	resourceStats := make(map[string]int)
+	formatDict := make(map[string]string)
+	for _, item := range FORMAT_LIST {
+		formatDict[item.Suffix] = item.Name
+	}
+	for _, item := range links {
+		resourceStats[item.Format]++
+	}
+	var resultStrBuilder strings.Builder
+	for key, value := range resourceStats {
+		name := formatDict[key]
+		if name == "" {
+			name = key
+		}
+		resultStrBuilder.WriteString(fmt.Sprintf("%s=%d ", name, value))
+	}
+	return fmt.Sprintf("共解析到%d个资源：%s", len(links), resultStrBuilder.String())
+}
 
-	body, err := io.ReadAll(resp.Body)
-	return body, err, resp.StatusCode == http.StatusOK
+// FormatBytes 文件大小文本，未知（<0）时为空
+func FormatBytes(n int64) string {
+	switch {
+	case n < 0:
+		return ""
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	case n < 1024*1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/1024/1024)
+	}
+	return fmt.Sprintf("%.2f GB", float64(n)/1024/1024/1024)
 }
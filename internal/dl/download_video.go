@@ -1,25 +1,23 @@
 package dl
 
 import (
+	"context"
 	"crypto/aes"
-	"crypto/cipher"
 	"crypto/md5"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"hash/fnv"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
-	"time"
 
 	"github.com/Eyevinn/hls-m3u8/m3u8"
 )
@@ -29,39 +27,49 @@ func encryptMD5(text string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-func GetResponseBody(url string, headers map[string]string) ([]byte, error) {
-	// 创建请求
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %v", err)
-	}
+func GetResponseBody(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	return getResponseBody(ctx, url, headers, nil)
+}
 
-	// 添加请求头
-	for key, value := range headers {
-		req.Header.Add(key, value)
-	}
+// getResponseBody 按重试策略请求数据，onRetry 用于统计重试次数
+func getResponseBody(ctx context.Context, url string, headers map[string]string, onRetry func(err error)) ([]byte, error) {
+	var body []byte
+	err := withRetry(ctx, retryPolicyFrom(ctx), url, onRetry, func() error {
+		return withFailover(ctx, []string{url}, func(link string) error {
+			// 创建请求
+			req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+			if err != nil {
+				return fmt.Errorf("创建请求失败: %v", err)
+			}
 
-	// 发送请求
-	resp, err := defaultHTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("请求失败: %v", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("请求状态异常: %d", resp.StatusCode)
-	}
+			// 添加请求头
+			for key, value := range headers {
+				req.Header.Add(key, value)
+			}
 
-	// 读取响应体
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("读取响应体失败: %v", err)
-	}
+			// 发送请求
+			resp, err := defaultHTTPClient.Do(req)
+			if err != nil {
+				return fmt.Errorf("请求失败: %w", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("请求%w", newStatusError(resp))
+			}
 
-	return body, nil
+			// 读取响应体
+			body, err = io.ReadAll(resp.Body)
+			if err != nil {
+				return fmt.Errorf("读取响应体失败: %w", err)
+			}
+			return nil
+		})
+	})
+	return body, err
 }
 
-func getKeyFromURL(url, key string, headers map[string]string) (string, error) {
-	body, err := GetResponseBody(url, headers)
+func getKeyFromURL(ctx context.Context, url, key string, headers map[string]string, counter ProgressCounter) (string, error) {
+	body, err := getResponseBody(ctx, url, headers, counter.AddRetry)
 	if err != nil {
 		return "", err
 	}
@@ -77,13 +85,13 @@ func getKeyFromURL(url, key string, headers map[string]string) (string, error) {
 	return "", fmt.Errorf("key=%s not found", key)
 }
 
-func getDecryptionKey(keyURL, keyID string, headers map[string]string) ([]byte, error) {
+func getDecryptionKey(ctx context.Context, keyURL, keyID string, headers map[string]string, counter ProgressCounter) ([]byte, error) {
 	// ts视频解码部分参考
 	// - https://github.com/52beijixing/smartedu-download/blob/main/utils/download.py
 	// - https://basic.smartedu.cn/fish/video/videoplayer.min.js
 
 	signURL := keyURL + "/signs"
-	nonce, err := getKeyFromURL(signURL, "nonce", headers)
+	nonce, err := getKeyFromURL(ctx, signURL, "nonce", headers, counter)
 	if err != nil {
 		return nil, err
 	}
@@ -91,7 +99,7 @@ func getDecryptionKey(keyURL, keyID string, headers map[string]string) ([]byte,
 
 	sign := encryptMD5(nonce + keyID)[:16]
 	keyIDURL := fmt.Sprintf("%s?nonce=%s&sign=%s", keyURL, nonce, sign)
-	keyData, err := getKeyFromURL(keyIDURL, "key", headers)
+	keyData, err := getKeyFromURL(ctx, keyIDURL, "key", headers, counter)
 	if err != nil {
 		return nil, err
 	}
@@ -119,30 +127,6 @@ func PKCS7Unpadding(data []byte) []byte {
 	return data[:(length - unpadding)]
 }
 
-// decryptAES_CBC AES-CBC模式解密
-func decryptAES_CBC(ciphertext, key, iv []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("创建AES cipher失败: %v", err)
-	}
-
-	if len(ciphertext)%aes.BlockSize != 0 {
-		return nil, fmt.Errorf("密文长度必须是块大小(%d)的倍数", aes.BlockSize)
-	}
-
-	if len(iv) != aes.BlockSize {
-		return nil, fmt.Errorf("IV长度必须是%d字节", aes.BlockSize)
-	}
-
-	plaintext := make([]byte, len(ciphertext))
-	mode := cipher.NewCBCDecrypter(block, iv)
-	mode.CryptBlocks(plaintext, ciphertext)
-
-	// 去除填充
-	plaintext = PKCS7Unpadding(plaintext)
-	return plaintext, nil
-}
-
 // decryptAES_ECB AES-ECB模式解密
 func decryptAES_ECB(ciphertext, key []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
@@ -248,37 +232,93 @@ func GetM3U8Size(m3u8URL string, headers map[string]string) (int64, error) {
 	return totalSize, nil
 }
 
-func extractM3u8Info(mediaPlaylist m3u8.MediaPlaylist) (keyURL, keyID string, iv []byte, err error) {
-	if len(mediaPlaylist.Keys) == 0 {
-		return "", "", nil, nil // 没有加密(无EXT-X-KEY标签)
-	}
+// segmentKey 分段的解密参数，Key 为 nil 表示未加密
+type segmentKey struct {
+	Key []byte
+	IV  []byte
+}
 
-	// 取第一把 key（METHOD=NONE 的情况下 URI 通常为空，可按需跳过）
-	key := mediaPlaylist.Keys[0]
-	for _, k := range mediaPlaylist.Keys {
-		if k.Method != "" && k.Method != "NONE" {
-			key = k
-			break
-		}
+// parseKeyIV 解析 EXT-X-KEY 的 IV；没有时按 HLS 规范使用分段序号（128位大端）
+func parseKeyIV(value string, seqNo uint64) ([]byte, error) {
+	if value == "" {
+		iv := make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], seqNo)
+		return iv, nil
+	}
+	// 去除0x 0X前缀
+	hexStr := strings.TrimPrefix(value, "0x")
+	hexStr = strings.TrimPrefix(hexStr, "0X")
+	iv, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode IV: %w", err)
 	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("IV长度必须是%d字节", aes.BlockSize)
+	}
+	return iv, nil
+}
 
-	slog.Debug("检测到加密密钥配置", "keyLen", len(key.URI))
-
-	keyURL = key.URI
-	parts := strings.Split(keyURL, "/")
-	keyID = parts[len(parts)-1]
+// resolveSegmentKeys 按每个分段生效的 EXT-X-KEY 确定解密参数，密钥按 URI 缓存只获取一次
+func resolveSegmentKeys(
+	ctx context.Context,
+	m3u8URL string,
+	mediaPlaylist *m3u8.MediaPlaylist,
+	headers map[string]string,
+	counter ProgressCounter,
+) ([]segmentKey, error) {
+	baseURL, err := url.Parse(m3u8URL)
+	if err != nil {
+		return nil, err
+	}
+	keyCache := make(map[string][]byte)
+	var (
+		current *m3u8.Key // 当前生效的 EXT-X-KEY，直到下一个 EXT-X-KEY
+		keys    []segmentKey
+	)
+	for i, segment := range mediaPlaylist.Segments {
+		if segment == nil {
+			continue
+		}
+		for _, k := range segment.Keys {
+			// 同时存在多个 KEYFORMAT 时只使用标准格式
+			if k.Keyformat == "" || k.Keyformat == "identity" {
+				current = &k
+				break
+			}
+		}
+		if current == nil || current.Method == "" || current.Method == "NONE" {
+			keys = append(keys, segmentKey{})
+			continue
+		}
+		if current.Method != "AES-128" {
+			return nil, fmt.Errorf("不支持的视频加密方式: %s", current.Method)
+		}
 
-	if key.IV != "" {
-		// 去除0x 0X前缀
-		hexStr := strings.TrimPrefix(key.IV, "0x")
-		hexStr = strings.TrimPrefix(hexStr, "0X")
-		iv, err = hex.DecodeString(hexStr)
+		keyURL := current.URI
+		if ref, err := url.Parse(keyURL); err == nil {
+			keyURL = baseURL.ResolveReference(ref).String()
+		}
+		key, ok := keyCache[keyURL]
+		if !ok {
+			parts := strings.Split(keyURL, "/")
+			keyID := parts[len(parts)-1]
+			key, err = getDecryptionKey(ctx, keyURL, keyID, headers, counter)
+			if err != nil {
+				return nil, fmt.Errorf("获取视频解密 key 失败: %w", err)
+			}
+			slog.Debug("获取视频解密 key 成功", "keyLen", len(key))
+			keyCache[keyURL] = key
+		}
+		iv, err := parseKeyIV(current.IV, mediaPlaylist.SeqNo+uint64(i))
 		if err != nil {
-			return "", "", nil, fmt.Errorf("failed to decode IV: %w", err)
+			return nil, err
 		}
-		slog.Debug("成功提取加密参数", "ivLen", len(iv))
+		keys = append(keys, segmentKey{Key: key, IV: iv})
+	}
+	if len(keyCache) > 1 {
+		slog.Debug(fmt.Sprintf("视频使用 %d 个解密 key", len(keyCache)))
 	}
-	return keyURL, keyID, iv, nil
+	return keys, nil
 }
 
 // isNetworkError 判断是否为网络相关错误，这类错误适合重试
@@ -286,8 +326,13 @@ func isNetworkError(err error) bool {
 	if err == nil {
 		return false
 	}
-	if netErr, ok := err.(net.Error); ok {
-		return netErr.Timeout()
+	// 超时（含读取空闲超时）和响应未读完时连接断开，可续传或重试
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
 	}
 	errStr := err.Error()
 	return strings.Contains(errStr, "connection") ||
@@ -299,9 +344,9 @@ func isNetworkError(err error) bool {
 }
 
 // 下载单个TS文件，增加header信息，更新进度条
-func downloadTSFile(segmentURL, filename string, headers map[string]string, downloadedBytes *atomic.Int64) error {
+func downloadTSFile(ctx context.Context, segmentURL, filename string, headers map[string]string, counter ProgressCounter) error {
 	// 创建HTTP请求
-	segmentReq, err := http.NewRequest("GET", segmentURL, nil)
+	segmentReq, err := http.NewRequestWithContext(ctx, "GET", segmentURL, nil)
 	if err != nil {
 		return fmt.Errorf("request error: %w", err)
 	}
@@ -316,225 +361,132 @@ func downloadTSFile(segmentURL, filename string, headers map[string]string, down
 	}
 	defer segmentResp.Body.Close()
 	if segmentResp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download segment (%s): status code %d", segmentURL, segmentResp.StatusCode)
+		return fmt.Errorf("failed to download segment (%s): %w", segmentURL, newStatusError(segmentResp))
 	}
 
-	outFile, err := os.Create(filename)
+	// 先写入 .part，完整下载后再改名，避免中断留下不完整的分段
+	partPath := filename + partSuffix
+	outFile, err := os.Create(partPath)
 	if err != nil {
 		return err
 	}
-	defer outFile.Close()
 
 	n, err := io.Copy(outFile, segmentResp.Body)
 	if n > 0 {
-		downloadedBytes.Add(n)
+		counter.AddBytes(n)
 	}
-	return err
-}
-
-// downloadTSFileWithRetry 带重试机制的TS文件下载（指数退避）
-func downloadTSFileWithRetry(segmentURL, filename string, headers map[string]string, downloadedBytes *atomic.Int64, retryStats *atomic.Int64) error {
-	const maxRetries = 3
-	var lastErr error
-
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		err := downloadTSFile(segmentURL, filename, headers, downloadedBytes)
-		if err == nil {
-			return nil
-		}
-
-		// 只重试网络错误，不重试HTTP 4xx/5xx
-		if !isNetworkError(err) {
-			return err
-		}
-
-		lastErr = err
-		if attempt < maxRetries-1 {
-			// 指数退避：1s, 2s, 4s
-			backoff := time.Duration(1<<uint(attempt)) * time.Second
-			slog.Debug("download segment failed, retrying",
-				"url", segmentURL[:min(30, len(segmentURL))],
-				"attempt", attempt+1,
-				"backoff", backoff.String())
-			time.Sleep(backoff)
-			retryStats.Add(1)
-		}
+	if closeErr := outFile.Close(); err == nil {
+		err = closeErr
 	}
-
-	return fmt.Errorf("download failed after %d retries: %w", maxRetries, lastErr)
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
+	if err == nil && segmentResp.ContentLength > 0 && n != segmentResp.ContentLength {
+		err = fmt.Errorf("segment size mismatch (%s) %d/%d: %w", segmentURL, n, segmentResp.ContentLength, io.ErrUnexpectedEOF)
 	}
-	return b
-}
-
-func getDecryptedData(tsFile string, key []byte, iv []byte) ([]byte, error) {
-	// 读取加密的TS数据
-	// encryptedData, err := io.ReadAll(segmentResp.Body)
-	encryptedData, err := os.ReadFile(tsFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read segment data: %w", err)
-	}
-
-	// 解密数据
-	var decryptedData []byte
-	if key != nil {
-		decryptedData, err = decryptAES_CBC(encryptedData, key, iv)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decrypt segment: %w", err)
-		}
-	} else {
-		decryptedData = encryptedData // 未加密直接使用原始数据
+		// 已计入的字节在重试时会重新下载
+		counter.AddBytes(-n)
+		os.Remove(partPath)
+		return err
 	}
-	return decryptedData, nil
-
+	return os.Rename(partPath, filename)
 }
 
-type segmentJob struct {
-	index int
-	url   string
+// downloadTSFileWithRetry 带重试机制的TS文件下载（重试策略随 ctx 传递）
+func downloadTSFileWithRetry(ctx context.Context, segmentURL, filename string, headers map[string]string, counter ProgressCounter) error {
+	name := segmentURL[:min(30, len(segmentURL))]
+	return withRetry(ctx, retryPolicyFrom(ctx), name, counter.AddRetry, func() error {
+		return downloadTSFile(ctx, segmentURL, filename, headers, counter)
+	})
 }
 
-func downloadAllTSWithRetry(tempDir string, urls []string, headers map[string]string, maxConcurrency int, downloadedBytes *atomic.Int64, retryStats *atomic.Int64) error {
-	var wg sync.WaitGroup
-	downloadChan := make(chan segmentJob, len(urls))
-	errChan := make(chan error, len(urls))
-	if maxConcurrency < 1 {
-		maxConcurrency = 1
-	}
-	if maxConcurrency > len(urls) {
-		maxConcurrency = len(urls)
-	}
-
-	if retryStats == nil {
-		retryStats = &atomic.Int64{}
-	}
-
-	// 控制并发数
-	for i := 0; i < maxConcurrency; i++ {
-		go func() {
-			for job := range downloadChan {
-				filename := filepath.Join(tempDir, fmt.Sprintf("%05d.ts", job.index))
-				err := downloadTSFileWithRetry(job.url, filename, headers, downloadedBytes, retryStats)
-				if err != nil {
-					select {
-					case errChan <- err:
-					default:
-					}
-				}
-				wg.Done()
-			}
-		}()
+// fetchPlaylist 获取并解析 M3U8 播放列表
+func fetchPlaylist(ctx context.Context, m3u8URL string, headers map[string]string) (m3u8.Playlist, m3u8.ListType, int, error) {
+	statusCode := -1
+	req, err := http.NewRequestWithContext(ctx, "GET", m3u8URL, nil)
+	if err != nil {
+		return nil, 0, statusCode, fmt.Errorf("创建 GET 请求失败: %w", err)
 	}
-
-	// 分发任务
-	for index, url := range urls {
-		wg.Add(1)
-		downloadChan <- segmentJob{index: index, url: url}
+	for k, v := range headers {
+		req.Header.Set(k, v)
 	}
-	close(downloadChan)
-
-	// 等待下载完成
-	go func() {
-		wg.Wait()
-		close(errChan)
-	}()
 
-	// 检查是否有错误
-	if err := <-errChan; err != nil {
-		return err
+	// 发送 GET 请求
+	resp, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, statusCode, fmt.Errorf("获取 M3U8 播放列表失败: %w", err)
+	}
+	slog.Debug(fmt.Sprintf("Fetch Video status code %v", resp.StatusCode))
+	statusCode = resp.StatusCode
+	defer resp.Body.Close()
+	if statusCode != http.StatusOK {
+		return nil, 0, statusCode, fmt.Errorf("获取 M3U8 播放列表%w", newStatusError(resp))
 	}
-	return nil
-}
 
-// 按顺序合并 ts 文件
-func mergeTSFiles(tempDir, outFile string, urls []string, key []byte, iv []byte) error {
-	// 合并前先检查文件
-	for i := 0; i < len(urls); i++ {
-		tsFile := filepath.Join(tempDir, fmt.Sprintf("%05d.ts", i))
-		info, err := os.Stat(tsFile)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return fmt.Errorf("segment %d not found: %s", i, tsFile)
-			}
-			return fmt.Errorf("segment %d stat error: %w", i, err)
-		}
-		if info.Size() == 0 {
-			return fmt.Errorf("segment %d is empty: %s", i, tsFile)
-		}
+	playlist, listType, err := m3u8.DecodeFrom(resp.Body, true)
+	if err != nil {
+		return nil, 0, statusCode, fmt.Errorf("解析 M3U8 播放列表失败: %w", err)
 	}
+	return playlist, listType, statusCode, nil
+}
 
-	outFileHandle, err := os.Create(outFile)
+// chooseVariant 按清晰度策略选择主播放列表中的子播放列表，返回其链接
+func chooseVariant(masterURL string, master *m3u8.MasterPlaylist, quality QualityPolicy) (string, error) {
+	base, err := url.Parse(masterURL)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer outFileHandle.Close()
 
-	for i := 0; i < len(urls); i++ {
-		tsFile := filepath.Join(tempDir, fmt.Sprintf("%05d.ts", i))
-		tsData, err := getDecryptedData(tsFile, key, iv)
-		if err != nil {
-			return err
+	var variants []VideoVariant
+	for _, variant := range master.Variants {
+		if variant == nil || variant.Iframe || variant.URI == "" {
+			continue
 		}
-		if _, err := outFileHandle.Write(tsData); err != nil {
-			return err
+		ref, err := url.Parse(variant.URI)
+		if err != nil {
+			continue
 		}
+		variants = append(variants, VideoVariant{
+			Height:    parseHeight(variant.Resolution),
+			Bandwidth: int64(variant.Bandwidth),
+			URLs:      []string{base.ResolveReference(ref).String()},
+		})
 	}
 
-	return nil
-}
-
-func getTempDirFromHash(input string, prefix string) (string, error) {
-	// hash作为临时目录
-	h := fnv.New32a()
-	h.Write([]byte(input))
-	hashValue := h.Sum32()
-	hashStr := strconv.FormatUint(uint64(hashValue), 16)
-	tempDir := filepath.Join(os.TempDir(), prefix, "video_"+hashStr)
-
-	if err := os.RemoveAll(tempDir); err != nil {
-		return "", err
+	index := quality.Choose(variants)
+	if index < 0 {
+		return "", fmt.Errorf("主播放列表中没有可用的清晰度")
 	}
-	if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
-		return "", err
-	}
-
-	return tempDir, nil
+	chosen := variants[index]
+	slog.Info(fmt.Sprintf("选择清晰度 %s：%dp %dkbps", quality, chosen.Height, chosen.Bandwidth/1000))
+	return chosen.URLs[0], nil
 }
 
 // downloads a M3U8 video and save it to MP4 file
-func DownloadM3U8(m3u8URL, savePath string, headers map[string]string, downloadedBytes *atomic.Int64, maxConcurrency int, retryStats *atomic.Int64) (int, error) {
-	if retryStats == nil {
-		retryStats = &atomic.Int64{}
-	}
-	statusCode := -1
-	req, err := http.NewRequest("GET", m3u8URL, nil)
-	if err != nil {
-		return statusCode, fmt.Errorf("创建 GET 请求失败: %w", err)
-	}
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
-
-	// 发送 GET 请求
-	resp, err := defaultHTTPClient.Do(req)
+func DownloadM3U8(
+	ctx context.Context,
+	m3u8URL, savePath string,
+	headers map[string]string,
+	maxConcurrency int,
+	quality QualityPolicy,
+	counter ProgressCounter,
+) (int, error) {
+	if counter == nil {
+		counter = nopCounter{}
+	}
+	playlist, listType, statusCode, err := fetchPlaylist(ctx, m3u8URL, headers)
 	if err != nil {
-		return statusCode, fmt.Errorf("获取 M3U8 播放列表失败: %w", err)
-	}
-	slog.Debug(fmt.Sprintf("Fetch Video status code %v", resp.StatusCode))
-	statusCode = resp.StatusCode
-	defer resp.Body.Close()
-	if statusCode != http.StatusOK {
-		return statusCode, fmt.Errorf("获取 M3U8 播放列表状态异常: %d", statusCode)
+		return statusCode, err
 	}
 
-	playlist, listType, err := m3u8.DecodeFrom(resp.Body, true)
-	_ = playlist.DecodeFrom(resp.Body, true)
-	if err != nil {
-		return statusCode, fmt.Errorf("解析 M3U8 播放列表失败: %w", err)
+	// 主播放列表：选择一个清晰度后获取其媒体播放列表
+	if listType == m3u8.MASTER {
+		m3u8URL, err = chooseVariant(m3u8URL, playlist.(*m3u8.MasterPlaylist), quality)
+		if err != nil {
+			return statusCode, err
+		}
+		playlist, listType, statusCode, err = fetchPlaylist(ctx, m3u8URL, headers)
+		if err != nil {
+			return statusCode, err
+		}
 	}
 
 	var segments []*m3u8.MediaSegment
@@ -544,21 +496,12 @@ func DownloadM3U8(m3u8URL, savePath string, headers map[string]string, downloade
 
 	mediaPlaylist := playlist.(*m3u8.MediaPlaylist)
 	segments = mediaPlaylist.Segments
-	keyURL, keyID, iv, err := extractM3u8Info(*mediaPlaylist)
+	keys, err := resolveSegmentKeys(ctx, m3u8URL, mediaPlaylist, headers, counter)
 	if err != nil {
 		return statusCode, err
 	}
 
-	var key []byte
-	if keyURL != "" {
-		key, err = getDecryptionKey(keyURL, keyID, headers)
-		if err != nil {
-			return statusCode, fmt.Errorf("获取视频解密 key 失败: %w", err)
-		}
-		slog.Debug("获取视频解密 key 成功")
-	}
-
-	// 并发下载，临时目录保存单个ts片段，之后再合并
+	// 并发下载，临时目录保存单个ts片段，按顺序边下载边合并
 	baseURL := m3u8URL[:strings.LastIndex(m3u8URL, "/")+1]
 	segmentURLList := []string{}
 	for _, segment := range segments {
@@ -572,22 +515,27 @@ func DownloadM3U8(m3u8URL, savePath string, headers map[string]string, downloade
 		segmentURLList = append(segmentURLList, segmentURL)
 	}
 
-	tempDir, err := getTempDirFromHash(baseURL, APP_NAME)
+	// 工作目录在下载失败或中断时保留，再次下载时只获取缺少的分段
+	tempDir, manifest, err := openHLSWorkDir(m3u8URL, segmentURLList)
 	if err != nil {
 		return statusCode, err
 	}
-	defer func() {
-		if err := os.RemoveAll(tempDir); err != nil {
-			slog.Warn("failed to cleanup temp dir", "path", tempDir, "err", err)
-		}
-	}()
+	defer releaseHLSWorkDir(tempDir)
 	slog.Debug(fmt.Sprintf("tempDir: %s\nmaxConcurrency: %d\nTS count: %d", tempDir, maxConcurrency, len(segmentURLList)))
 
-	if err := downloadAllTSWithRetry(tempDir, segmentURLList, headers, maxConcurrency, downloadedBytes, retryStats); err != nil {
+	mergedPath, err := downloadAndMergeTS(ctx, tempDir, segmentURLList, headers, maxConcurrency, manifest, keys, counter)
+	if err != nil {
+		if isCanceled(ctx, err) {
+			// 取消下载时不保留分段
+			os.RemoveAll(tempDir)
+		}
 		return statusCode, err
 	}
-	if err := mergeTSFiles(tempDir, savePath, segmentURLList, key, iv); err != nil {
-		return statusCode, err
+	if err := moveFile(mergedPath, savePath); err != nil {
+		return statusCode, fmt.Errorf("保存文件 %s 出错：%w", savePath, err)
+	}
+	if err := os.RemoveAll(tempDir); err != nil {
+		slog.Warn("failed to cleanup temp dir", "path", tempDir, "err", err)
 	}
 	return statusCode, nil
 }
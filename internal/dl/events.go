@@ -0,0 +1,147 @@
+package dl
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// JobStatus 单个文件的下载结果
+type JobStatus string
+
+const (
+	JobSucceeded JobStatus = "success"
+	JobFailed    JobStatus = "failed"
+	JobSkipped   JobStatus = "skipped"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// Event 下载过程中产生的事件，具体类型：
+// BatchStarted、BatchProgress、JobStarted、JobProgress、JobRetry、JobFinished、BatchFinished
+type Event interface {
+	event()
+}
+
+// BatchStarted 批量下载开始
+type BatchStarted struct {
+	Total     int
+	TotalSize int64
+}
+
+// BatchProgress 批量下载整体进度（定时发送）
+type BatchProgress struct {
+	Progress        float64
+	FilesDone       int64
+	Total           int
+	DownloadedBytes int64
+	Retries         int64
+	Paused          bool
+}
+
+// JobStarted 单个文件开始下载
+type JobStarted struct {
+	Index int
+	Link  LinkData
+}
+
+// JobProgress 单个文件已下载字节数
+type JobProgress struct {
+	Index int
+	Bytes int64
+	Size  int64
+	Speed float64 // 字节/秒，自上次 JobProgress 以来的平均速度
+}
+
+// JobRetry 单个文件（或视频分段）下载重试
+type JobRetry struct {
+	Index int
+	Err   error
+}
+
+// JobFinished 单个文件下载结束
+type JobFinished struct {
+	Index      int
+	Link       LinkData
+	Status     JobStatus
+	StatusCode int
+	Path       string
+	URL        string // 最终成功（或最后尝试）的下载链接
+	Bytes      int64
+	Digest     FileDigest // 下载成功时保存文件的摘要，其他情况为空
+	Err        error
+}
+
+// BatchFinished 批量下载结束，包含统计结果
+type BatchFinished struct {
+	Result DownloadResult
+}
+
+func (BatchStarted) event()  {}
+func (BatchProgress) event() {}
+func (JobStarted) event()    {}
+func (JobProgress) event()   {}
+func (JobRetry) event()      {}
+func (JobFinished) event()   {}
+func (BatchFinished) event() {}
+
+// Observer 订阅下载事件；OnEvent 可能在多个下载协程中并发调用
+type Observer interface {
+	OnEvent(e Event)
+}
+
+// ObserverFunc 函数形式的 Observer
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// ProgressCounter 接收下载字节数和重试次数
+type ProgressCounter interface {
+	AddBytes(n int64)
+	AddRetry(err error)
+}
+
+type nopCounter struct{}
+
+func (nopCounter) AddBytes(n int64)   {}
+func (nopCounter) AddRetry(err error) {}
+
+const jobProgressInterval = 200 * time.Millisecond
+
+// jobTracker 单个文件的进度计数，同时汇总到批量统计
+type jobTracker struct {
+	dm       *DownloadManager
+	stats    *DownloadStats
+	index    int
+	size     int64
+	bytes    atomic.Int64
+	lastEmit atomic.Int64
+	// 上次发送进度时的字节数，用于计算速度
+	lastBytes atomic.Int64
+}
+
+func newJobTracker(dm *DownloadManager, stats *DownloadStats, index int, size int64) *jobTracker {
+	t := &jobTracker{dm: dm, stats: stats, index: index, size: size}
+	t.lastEmit.Store(time.Now().UnixNano())
+	return t
+}
+
+func (t *jobTracker) AddBytes(n int64) {
+	t.stats.downloadedBytes.Add(n)
+	total := t.bytes.Add(n)
+
+	// 限制事件频率
+	now := time.Now().UnixNano()
+	last := t.lastEmit.Load()
+	if now-last < int64(jobProgressInterval) || !t.lastEmit.CompareAndSwap(last, now) {
+		return
+	}
+	elapsed := time.Duration(now - last).Seconds()
+	speed := float64(total-t.lastBytes.Swap(total)) / elapsed
+	t.dm.emit(JobProgress{Index: t.index, Bytes: total, Size: t.size, Speed: max(speed, 0)})
+}
+
+func (t *jobTracker) AddRetry(err error) {
+	t.stats.retryCount.Add(1)
+	t.dm.emit(JobRetry{Index: t.index, Err: err})
+}
@@ -0,0 +1,292 @@
+package dl
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+const mergedFile = "merged.ts"
+
+// cbcReader 流式 AES-CBC 解密，保留最后一块直到读完，再去除 PKCS7 填充
+type cbcReader struct {
+	r     io.Reader
+	mode  cipher.BlockMode
+	chunk []byte
+	held  []byte // 已解密、可能是最后一块
+	out   []byte // 可以输出的明文
+	eof   bool
+}
+
+func newCBCReader(r io.Reader, key, iv []byte) (io.Reader, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建AES cipher失败: %v", err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("IV长度必须是%d字节", aes.BlockSize)
+	}
+	return &cbcReader{
+		r:     r,
+		mode:  cipher.NewCBCDecrypter(block, iv),
+		chunk: make([]byte, 64*aes.BlockSize*32),
+	}, nil
+}
+
+func (c *cbcReader) Read(p []byte) (int, error) {
+	for len(c.out) == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+		if err := c.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+func (c *cbcReader) fill() error {
+	n, err := io.ReadFull(c.r, c.chunk)
+	final := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	if err != nil && !final {
+		return err
+	}
+	if n%aes.BlockSize != 0 {
+		return fmt.Errorf("密文长度必须是块大小(%d)的倍数", aes.BlockSize)
+	}
+
+	c.mode.CryptBlocks(c.chunk[:n], c.chunk[:n])
+	plain := append(c.held, c.chunk[:n]...)
+	if final {
+		c.eof = true
+		c.held = nil
+		c.out = PKCS7Unpadding(plain)
+		return nil
+	}
+	split := len(plain) - aes.BlockSize
+	c.out = plain[:split]
+	c.held = append([]byte(nil), plain[split:]...)
+	return nil
+}
+
+// segmentMerger 分段按顺序追加到合并文件，追加后删除分段，磁盘占用约为一份视频
+type segmentMerger struct {
+	tempDir  string
+	out      *os.File
+	manifest *hlsManifest
+	keys     []segmentKey // 与分段一一对应
+
+	mu    sync.Mutex
+	ready map[int]bool
+}
+
+// openSegmentMerger 打开合并文件，截断到清单记录的长度（丢弃中断时未记录的部分）
+func openSegmentMerger(tempDir string, manifest *hlsManifest, keys []segmentKey) (*segmentMerger, error) {
+	out, err := os.OpenFile(filepath.Join(tempDir, mergedFile), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	merged, mergedSize := manifest.mergedState()
+	if err := out.Truncate(mergedSize); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if _, err := out.Seek(mergedSize, io.SeekStart); err != nil {
+		out.Close()
+		return nil, err
+	}
+	slog.Debug("open merged file", "merged", merged, "size", mergedSize)
+	return &segmentMerger{
+		tempDir:  tempDir,
+		out:      out,
+		manifest: manifest,
+		keys:     keys,
+		ready:    make(map[int]bool),
+	}, nil
+}
+
+// segmentReady 分段下载完成，追加所有已就绪的连续分段
+func (sm *segmentMerger) segmentReady(index int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.ready[index] = true
+	for {
+		next, _ := sm.manifest.mergedState()
+		if !sm.ready[next] {
+			return nil
+		}
+		if err := sm.appendSegment(next); err != nil {
+			return err
+		}
+		delete(sm.ready, next)
+	}
+}
+
+func (sm *segmentMerger) appendSegment(index int) error {
+	tsFile := filepath.Join(sm.tempDir, fmt.Sprintf("%05d.ts", index))
+	in, err := os.Open(tsFile)
+	if err != nil {
+		return fmt.Errorf("segment %d not found: %w", index, err)
+	}
+	defer in.Close()
+
+	var reader io.Reader = in
+	if key := sm.keys[index]; key.Key != nil {
+		reader, err = newCBCReader(in, key.Key, key.IV)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt segment: %w", err)
+		}
+	}
+	if _, err := io.Copy(sm.out, reader); err != nil {
+		return fmt.Errorf("failed to merge segment %d: %w", index, err)
+	}
+
+	offset, err := sm.out.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if err := sm.manifest.markMerged(index+1, offset); err != nil {
+		return err
+	}
+	in.Close()
+	if err := os.Remove(tsFile); err != nil {
+		slog.Warn("failed to remove merged segment", "path", tsFile, "err", err)
+	}
+	return nil
+}
+
+func (sm *segmentMerger) close() error {
+	return sm.out.Close()
+}
+
+type segmentJob struct {
+	index int
+	url   string
+}
+
+// downloadAndMergeTS 并发下载分段，按顺序边下载边合并到工作目录的合并文件，返回其路径
+func downloadAndMergeTS(
+	ctx context.Context,
+	tempDir string,
+	urls []string,
+	headers map[string]string,
+	maxConcurrency int,
+	manifest *hlsManifest,
+	keys []segmentKey,
+	counter ProgressCounter,
+) (string, error) {
+	merger, err := openSegmentMerger(tempDir, manifest, keys)
+	if err != nil {
+		return "", err
+	}
+	defer merger.close()
+
+	maxConcurrency = min(max(maxConcurrency, 1), max(len(urls), 1))
+	jobs := make(chan segmentJob)
+	var (
+		wg       sync.WaitGroup
+		failed   atomic.Bool
+		firstErr error
+		errOnce  sync.Once
+	)
+	fail := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+		failed.Store(true)
+	}
+
+	for range maxConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				// 暂停时等待继续
+				if err := waitIfPaused(ctx); err != nil {
+					fail(err)
+				}
+				if failed.Load() {
+					continue
+				}
+				filename := filepath.Join(tempDir, fmt.Sprintf("%05d.ts", job.index))
+				err := downloadTSFileWithRetry(ctx, job.url, filename, headers, counter)
+				if err == nil {
+					var info os.FileInfo
+					if info, err = os.Stat(filename); err == nil && info.Size() == 0 {
+						err = fmt.Errorf("segment %d is empty: %s", job.index, filename)
+					} else if err == nil {
+						err = manifest.markDone(job.index, info.Size())
+					}
+				}
+				if err == nil {
+					err = merger.segmentReady(job.index)
+				}
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	// 分发任务，跳过之前已完成的分段
+	merged, _ := manifest.mergedState()
+	for index, url := range urls {
+		if failed.Load() {
+			break
+		}
+		filename := filepath.Join(tempDir, fmt.Sprintf("%05d.ts", index))
+		if size, ok := manifest.done(index, filename); ok {
+			counter.AddBytes(size)
+			if index >= merged {
+				if err := merger.segmentReady(index); err != nil {
+					fail(err)
+				}
+			}
+			continue
+		}
+		jobs <- segmentJob{index: index, url: url}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return "", firstErr
+	}
+	if merged, _ := manifest.mergedState(); merged != len(urls) {
+		return "", fmt.Errorf("merged segments %d/%d", merged, len(urls))
+	}
+	return filepath.Join(tempDir, mergedFile), nil
+}
+
+// moveFile 移动文件，跨磁盘时复制后删除
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,262 @@
+package dl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const hlsManifestFile = "manifest.json"
+
+// hlsManifest 视频分段下载进度，保存在工作目录中，重新下载时只获取缺少的分段
+type hlsManifest struct {
+	URL        string        `json:"url"`
+	Segments   int           `json:"segments"`
+	Checksum   string        `json:"checksum"`  // 分段列表摘要，播放列表变化时重新下载
+	Completed  map[int]int64 `json:"completed"` // 分段序号 -> 文件大小
+	Merged     int           `json:"merged"`    // 已按顺序合并的分段数，合并后分段文件删除
+	MergedSize int64         `json:"merged_size"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// 本进程正在使用的工作目录。同一批次中同一视频出现两次时（如不同课程中的同一课时视频），
+// 后开始的任务使用带序号的目录，避免两个任务同时写入分段和合并文件
+var (
+	hlsWorkDirsMu    sync.Mutex
+	hlsWorkDirsInUse = make(map[string]bool)
+)
+
+// HLSWorkRoot 视频分段工作目录的上级目录，位于用户缓存目录
+func HLSWorkRoot() string {
+	root, err := os.UserCacheDir()
+	if err != nil {
+		root = os.TempDir()
+	}
+	return filepath.Join(root, APP_NAME, "hls")
+}
+
+// urlPath 去掉域名和参数，CDN切换或签名参数变化时仍视为同一资源
+func urlPath(link string) string {
+	parsedURL, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return parsedURL.Path
+}
+
+func segmentsChecksum(segmentURLs []string) string {
+	h := sha256.New()
+	for _, link := range segmentURLs {
+		h.Write([]byte(urlPath(link)))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// acquireHLSWorkDir 返回 base 或未被占用的 base-1、base-2……并标记为使用中
+func acquireHLSWorkDir(base string) string {
+	hlsWorkDirsMu.Lock()
+	defer hlsWorkDirsMu.Unlock()
+	workDir := base
+	for index := 1; hlsWorkDirsInUse[workDir]; index++ {
+		workDir = fmt.Sprintf("%s-%d", base, index)
+	}
+	hlsWorkDirsInUse[workDir] = true
+	return workDir
+}
+
+// releaseHLSWorkDir 任务结束（工作目录已删除或保留以便续传）后释放
+func releaseHLSWorkDir(workDir string) {
+	hlsWorkDirsMu.Lock()
+	defer hlsWorkDirsMu.Unlock()
+	delete(hlsWorkDirsInUse, workDir)
+}
+
+// openHLSWorkDir 打开播放列表对应的工作目录（按链接路径哈希命名），分段列表变化时清空；
+// 工作目录标记为使用中，结束后需调用 releaseHLSWorkDir
+func openHLSWorkDir(playlistURL string, segmentURLs []string) (string, *hlsManifest, error) {
+	sum := sha256.Sum256([]byte(urlPath(playlistURL)))
+	workDir := acquireHLSWorkDir(filepath.Join(HLSWorkRoot(), "video_"+hex.EncodeToString(sum[:8])))
+	manifest, err := loadHLSManifest(workDir, playlistURL, segmentURLs)
+	if err != nil {
+		releaseHLSWorkDir(workDir)
+		return "", nil, err
+	}
+	return workDir, manifest, nil
+}
+
+// loadHLSManifest 读取工作目录中的下载进度，不存在或分段列表变化时清空目录并新建
+func loadHLSManifest(workDir string, playlistURL string, segmentURLs []string) (*hlsManifest, error) {
+	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	checksum := segmentsChecksum(segmentURLs)
+	manifest := &hlsManifest{path: filepath.Join(workDir, hlsManifestFile)}
+	data, err := os.ReadFile(manifest.path)
+	if err == nil && json.Unmarshal(data, manifest) == nil &&
+		manifest.Segments == len(segmentURLs) && manifest.Checksum == checksum {
+		if len(manifest.Completed) > 0 {
+			slog.Info(fmt.Sprintf("已完成分段 %d/%d，继续下载", len(manifest.Completed), len(segmentURLs)))
+		}
+		return manifest, nil
+	}
+
+	// 新下载或播放列表已变化
+	if err == nil {
+		slog.Info("播放列表已变化，重新下载全部分段", "dir", workDir)
+	}
+	if err := os.RemoveAll(workDir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	manifest.URL = playlistURL
+	manifest.Segments = len(segmentURLs)
+	manifest.Checksum = checksum
+	manifest.Completed = make(map[int]int64)
+	if err := manifest.save(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// done 分段已下载完成且文件大小一致，或已经合并
+func (m *hlsManifest) done(index int, filename string) (int64, bool) {
+	m.mu.Lock()
+	size, ok := m.Completed[index]
+	merged := index < m.Merged
+	m.mu.Unlock()
+	if !ok || size <= 0 {
+		return 0, false
+	}
+	if merged {
+		return size, true
+	}
+	info, err := os.Stat(filename)
+	return size, err == nil && info.Size() == size
+}
+
+// markDone 记录完成的分段并保存
+func (m *hlsManifest) markDone(index int, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Completed[index] = size
+	return m.save()
+}
+
+// mergedState 已合并的分段数和合并文件长度
+func (m *hlsManifest) mergedState() (int, int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Merged, m.MergedSize
+}
+
+// markMerged 记录合并进度并保存
+func (m *hlsManifest) markMerged(merged int, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Merged = merged
+	m.MergedSize = size
+	return m.save()
+}
+
+// save 先写入临时文件再替换，避免中断时损坏
+func (m *hlsManifest) save() error {
+	m.UpdatedAt = time.Now()
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmpPath := m.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, m.path)
+}
+
+// CleanHLSWorkDirs 删除超过 olderThan 未更新的视频分段工作目录（0 表示全部），返回删除的目录数和释放的字节数
+func CleanHLSWorkDirs(olderThan time.Duration) (int, int64, error) {
+	root := HLSWorkRoot()
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		removed int
+		freed   int64
+		errs    []error
+	)
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "video_") {
+			continue
+		}
+		workDir := filepath.Join(root, entry.Name())
+		hlsWorkDirsMu.Lock()
+		inUse := hlsWorkDirsInUse[workDir]
+		hlsWorkDirsMu.Unlock()
+		if inUse {
+			continue // 正在下载
+		}
+		if olderThan > 0 && time.Since(lastModified(workDir)) < olderThan {
+			continue
+		}
+
+		size := dirSize(workDir)
+		if err := os.RemoveAll(workDir); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		slog.Debug("removed hls work dir", "path", workDir, "size", size)
+		removed++
+		freed += size
+	}
+	return removed, freed, errors.Join(errs...)
+}
+
+// lastModified 工作目录中最近的修改时间
+func lastModified(dir string) time.Time {
+	var latest time.Time
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
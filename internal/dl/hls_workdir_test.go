@@ -0,0 +1,50 @@
+package dl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 同一批次中同一视频同时下载两次时使用不同的工作目录
+func TestHLSWorkDirInUse(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	segments := []string{"https://a.example/v/1.ts", "https://a.example/v/2.ts"}
+
+	first, m1, err := openHLSWorkDir("https://a.example/v/index.m3u8", segments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m1.markDone(0, 10); err != nil {
+		t.Fatal(err)
+	}
+	second, m2, err := openHLSWorkDir("https://b.example/v/index.m3u8?sign=1", segments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first || filepath.Dir(second) != filepath.Dir(first) {
+		t.Fatalf("second job work dir = %s, want a sibling of %s", second, first)
+	}
+	if len(m2.Completed) != 0 {
+		t.Fatalf("second job should not share progress: %v", m2.Completed)
+	}
+
+	// 清理时跳过使用中的目录
+	if removed, _, err := CleanHLSWorkDirs(0); err != nil || removed != 0 {
+		t.Fatalf("CleanHLSWorkDirs removed %d dirs in use, err %v", removed, err)
+	}
+
+	// 释放后再次打开时续传原目录
+	releaseHLSWorkDir(second)
+	os.RemoveAll(second)
+	releaseHLSWorkDir(first)
+	again, m3, err := openHLSWorkDir("https://a.example/v/index.m3u8", segments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseHLSWorkDir(again)
+	if again != first || m3.Completed[0] != 10 {
+		t.Fatalf("reopen = %s %v, want %s with progress", again, m3.Completed, first)
+	}
+}
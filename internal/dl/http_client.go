@@ -1,23 +1,40 @@
 package dl
 
 import (
+	"net"
 	"net/http"
 	"time"
 )
 
+// 连接、TLS握手和等待响应头的超时；下载过程不设总时长（限速时大文件需要更久），
+// 改为读取空闲超时：超过 readIdleTimeout 没有收到数据时中断，可续传或重试
+const (
+	dialTimeout           = 30 * time.Second
+	tlsHandshakeTimeout   = 15 * time.Second
+	responseHeaderTimeout = 60 * time.Second
+)
+
+var readIdleTimeout = 60 * time.Second
+
 var defaultHTTPClient = createHTTPClient()
 
 func createHTTPClient() *http.Client {
 	transport := &http.Transport{
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
-		MaxConnsPerHost:     32,
-		IdleConnTimeout:     90 * time.Second,
-		DisableCompression:  false,
-		DisableKeepAlives:   false,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		MaxConnsPerHost:       32,
+		IdleConnTimeout:       90 * time.Second,
+		DisableCompression:    false,
+		DisableKeepAlives:     false,
 	}
 	return &http.Client{
-		Transport: transport,
-		Timeout:   60 * time.Second,
+		// 全局限速和每个服务器的并发数限制，取得服务器名额后才开始计算超时
+		Transport: &limitedTransport{base: transport},
 	}
 }
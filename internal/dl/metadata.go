@@ -0,0 +1,220 @@
+package dl
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 元数据文件后缀，如 书名.pdf.json
+const metadataSuffix = ".json"
+
+// ResourceMetadata 每个下载文件旁的元数据文件，保留解析资源时的信息，便于之后整理和核对
+type ResourceMetadata struct {
+	ID           string            `json:"id"`
+	Title        string            `json:"title"`
+	Format       string            `json:"format"`
+	Folder       string            `json:"folder"`
+	File         string            `json:"file"`    // 文件名
+	Size         int64             `json:"size"`    // 文件大小
+	TiSize       int64             `json:"ti_size"` // 解析得到的大小，-1 表示未知
+	TiMD5        string            `json:"ti_md5,omitempty"`
+	SHA256       string            `json:"sha256"`
+	MD5          string            `json:"md5"`
+	URL          string            `json:"url"` // 最终使用的下载链接
+	RawURL       string            `json:"raw_url"`
+	BackupURL    string            `json:"backup_url"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	DownloadedAt time.Time         `json:"downloaded_at"`
+	ResourceMeta
+}
+
+// IndexEntry 目录索引中的一个文件
+type IndexEntry struct {
+	File         string    `json:"file"`
+	Metadata     string    `json:"metadata"`
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Format       string    `json:"format"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	MD5          string    `json:"md5,omitempty"`
+	SourceURL    string    `json:"source_url,omitempty"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// FolderIndex 每个保存目录中的索引文件，与已有索引按文件名合并
+type FolderIndex struct {
+	UpdatedAt time.Time    `json:"updated_at"`
+	Items     []IndexEntry `json:"items"`
+}
+
+// metadataWriter 订阅下载事件，文件保存后写入元数据文件，全部结束后更新各目录的索引
+type metadataWriter struct {
+	mu      sync.Mutex
+	entries map[string][]IndexEntry // 目录 → 本次保存的文件
+	removed map[string][]string     // 目录 → 本次有意删除的文件（如合并后删除的原文件）
+}
+
+func newMetadataWriter() *metadataWriter {
+	return &metadataWriter{entries: make(map[string][]IndexEntry), removed: make(map[string][]string)}
+}
+
+func (w *metadataWriter) OnEvent(e Event) {
+	switch e := e.(type) {
+	case JobFinished:
+		if e.Path == "" {
+			return
+		}
+		// 跳过的文件已有元数据时不再重写；已合并的文件由合并时写入
+		if e.Status == JobSkipped {
+			if _, err := os.Stat(e.Path + metadataSuffix); err == nil || isMergedPDF(e.Path) {
+				return
+			}
+		} else if e.Status != JobSucceeded {
+			return
+		}
+		if err := w.write(e); err != nil {
+			slog.Warn(fmt.Sprintf("写入元数据 %s 出错：%v", e.Path+metadataSuffix, err))
+		}
+	case BatchFinished:
+		w.saveIndexes()
+	}
+}
+
+func (w *metadataWriter) write(e JobFinished) error {
+	info, err := os.Stat(e.Path)
+	if err != nil {
+		return err
+	}
+	digest := e.Digest
+	if digest.SHA256 == "" {
+		if digest, _, err = hashFile(e.Path); err != nil {
+			return err
+		}
+	}
+	file := filepath.Base(e.Path)
+	meta := ResourceMetadata{
+		ID:           e.Link.ID,
+		Title:        e.Link.Title,
+		Format:       e.Link.Format,
+		Folder:       e.Link.Folder,
+		File:         file,
+		Size:         info.Size(),
+		TiSize:       e.Link.Size,
+		TiMD5:        e.Link.MD5,
+		SHA256:       digest.SHA256,
+		MD5:          digest.MD5,
+		URL:          e.URL,
+		RawURL:       e.Link.RawURL,
+		BackupURL:    e.Link.BackupURL,
+		Tags:         e.Link.Tags,
+		DownloadedAt: time.Now(),
+		ResourceMeta: e.Link.Meta,
+	}
+	if err := writeJSONFile(e.Path+metadataSuffix, meta); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dir := filepath.Dir(e.Path)
+	w.entries[dir] = append(w.entries[dir], IndexEntry{
+		File:         file,
+		Metadata:     file + metadataSuffix,
+		ID:           meta.ID,
+		Title:        meta.Title,
+		Format:       meta.Format,
+		Size:         meta.Size,
+		SHA256:       meta.SHA256,
+		MD5:          meta.MD5,
+		SourceURL:    meta.SourceURL,
+		DownloadedAt: meta.DownloadedAt,
+	})
+	return nil
+}
+
+// remove 文件已有意删除，更新索引时去掉该文件
+func (w *metadataWriter) remove(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dir, file := filepath.Split(path)
+	dir = filepath.Clean(dir)
+	w.entries[dir] = slices.DeleteFunc(w.entries[dir], func(entry IndexEntry) bool {
+		return entry.File == file
+	})
+	w.removed[dir] = append(w.removed[dir], file)
+}
+
+// saveIndexes 合并本次保存的文件到各目录的索引
+func (w *metadataWriter) saveIndexes() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dirs := make(map[string]bool)
+	for dir := range w.entries {
+		dirs[dir] = true
+	}
+	for dir := range w.removed {
+		dirs[dir] = true
+	}
+	for dir := range dirs {
+		if err := updateFolderIndex(dir, w.entries[dir], w.removed[dir]); err != nil {
+			slog.Warn(fmt.Sprintf("更新目录索引 %s 出错：%v", filepath.Join(dir, INDEX_FILE), err))
+		}
+	}
+	clear(w.entries)
+	clear(w.removed)
+}
+
+// updateFolderIndex 合并本次保存的文件并去掉有意删除的文件；其他已不存在的文件保留在索引中，
+// 校验目录时报告为缺失
+func updateFolderIndex(dir string, entries []IndexEntry, removed []string) error {
+	path := filepath.Join(dir, INDEX_FILE)
+	var index FolderIndex
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &index); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	items := make(map[string]IndexEntry)
+	for _, item := range index.Items {
+		items[item.File] = item
+	}
+	for _, entry := range entries {
+		items[entry.File] = entry
+	}
+	for _, file := range removed {
+		delete(items, file)
+	}
+	index.Items = slices.Collect(maps.Values(items))
+	slices.SortFunc(index.Items, func(a, b IndexEntry) int {
+		return cmp.Compare(a.File, b.File)
+	})
+	index.UpdatedAt = time.Now()
+	return writeJSONFile(path, index)
+}
+
+// writeJSONFile 先写入临时文件再替换
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,54 @@
+package dl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// saveDownloaded 模拟一批下载：保存文件、写入元数据并更新目录索引
+func saveDownloaded(t *testing.T, w *metadataWriter, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		w.OnEvent(JobFinished{Link: LinkData{Title: name, Format: "pdf", Size: -1}, Status: JobSucceeded, Path: path})
+	}
+}
+
+func TestFolderIndexKeepsMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	w := newMetadataWriter()
+	saveDownloaded(t, w, dir, "a.pdf", "b.pdf", "c.pdf")
+	w.OnEvent(BatchFinished{})
+
+	// 手动删除的文件保留在索引中，有意删除的文件（如合并后删除的原文件）从索引中去掉
+	os.Remove(filepath.Join(dir, "a.pdf"))
+	saveDownloaded(t, w, dir, "d.pdf")
+	os.Remove(filepath.Join(dir, "b.pdf"))
+	w.remove(filepath.Join(dir, "b.pdf"))
+	w.OnEvent(BatchFinished{})
+
+	results := make(map[string]VerifyStatus)
+	summary, err := VerifyFolder(context.Background(), dir, func(r VerifyResult) {
+		results[filepath.Base(r.Path)] = r.Status
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]VerifyStatus{"a.pdf": VerifyMissing, "c.pdf": VerifyOK, "d.pdf": VerifyOK}
+	if len(results) != len(want) {
+		t.Fatalf("results = %v, want %v", results, want)
+	}
+	for file, status := range want {
+		if results[file] != status {
+			t.Fatalf("results = %v, want %v", results, want)
+		}
+	}
+	if summary.Missing != 1 || summary.Passed() {
+		t.Fatalf("summary = %+v, want 1 missing", summary)
+	}
+}
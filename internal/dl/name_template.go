@@ -0,0 +1,189 @@
+package dl
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultNameTemplate 默认保存路径：书名/标题.后缀，书名为空时直接保存在下载目录
+const DefaultNameTemplate = "{folder}/{title}.{ext}"
+
+// TemplateField 保存路径模板中可用的字段
+type TemplateField struct {
+	Name string
+	Desc string
+	Dim  string // 目录分类的维度ID，为空表示 LinkData 字段
+}
+
+var NAME_TEMPLATE_FIELDS = []TemplateField{
+	{"title", "标题", ""},
+	{"folder", "书名", ""},
+	{"course", "课程", ""},
+	{"id", "资源ID", ""},
+	{"format", "资源类型", ""},
+	{"ext", "文件后缀", ""},
+	{"stage", "学段", "zxxxd"},
+	{"grade", "年级", "zxxnj"},
+	{"subject", "学科", "zxxxk"},
+	{"edition", "版本", "zxxbb"},
+	{"volume", "册次", "zxxcc"},
+}
+
+// SampleLinkData 预览保存路径模板使用的示例资源
+var SampleLinkData = LinkData{
+	Format: "pdf",
+	Title:  "义务教育教科书·语文四年级上册",
+	Folder: "统编版·语文四年级上册",
+	ID:     "bdc00134-465d-454b-a541-dcd0cec4d86e",
+	Tags: map[string]string{
+		"zxxxd": "小学",
+		"zxxnj": "四年级",
+		"zxxxk": "语文",
+		"zxxbb": "统编版",
+		"zxxcc": "上册",
+	},
+}
+
+// catalogTags 目录分类：维度ID → 名称，如 zxxxk → 语文
+func catalogTags(tags []DocTag) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	result := make(map[string]string)
+	for _, tag := range tags {
+		if tag.TagDim != "" && tag.TagName != "" {
+			result[tag.TagDim] = tag.TagName
+		}
+	}
+	return result
+}
+
+// NameTemplate 保存路径模板，如 {stage}/{subject}/{edition}/{grade}/{title}.{ext}。
+// 以“/”分隔目录，每一级分别去除特殊字符，为空的目录忽略；末尾的“.{ext}”可省略，文件始终按资源类型添加后缀。
+type NameTemplate struct {
+	raw   string
+	parts []string
+}
+
+// ParseNameTemplate 解析保存路径模板，为空时使用默认模板
+func ParseNameTemplate(value string) (*NameTemplate, error) {
+	raw := strings.TrimSpace(value)
+	if raw == "" {
+		raw = DefaultNameTemplate
+	}
+	tmpl := strings.ReplaceAll(raw, `\`, "/")
+	tmpl = strings.TrimSuffix(tmpl, ".{ext}")
+
+	var parts []string
+	for _, part := range strings.Split(tmpl, "/") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		if err := checkTemplatePart(part); err != nil {
+			return nil, fmt.Errorf("保存路径模板 %s 有误：%w", raw, err)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("保存路径模板 %s 有误：缺少文件名", raw)
+	}
+	return &NameTemplate{raw: raw, parts: parts}, nil
+}
+
+// checkTemplatePart 检查字段名和括号
+func checkTemplatePart(part string) error {
+	for {
+		start := strings.IndexAny(part, "{}")
+		if start < 0 {
+			return nil
+		}
+		if part[start] == '}' {
+			return fmt.Errorf("多余的 }")
+		}
+		end := strings.IndexByte(part[start:], '}')
+		if end < 0 {
+			return fmt.Errorf("缺少 }")
+		}
+		name := part[start+1 : start+end]
+		if templateField(name) == nil {
+			return fmt.Errorf("未知字段 {%s}", name)
+		}
+		part = part[start+end+1:]
+	}
+}
+
+func templateField(name string) *TemplateField {
+	for i := range NAME_TEMPLATE_FIELDS {
+		if NAME_TEMPLATE_FIELDS[i].Name == name {
+			return &NAME_TEMPLATE_FIELDS[i]
+		}
+	}
+	return nil
+}
+
+func (t *NameTemplate) String() string {
+	return t.raw
+}
+
+// fieldValue 字段取值，没有的目录分类为空
+func fieldValue(name string, file LinkData, suffix string) string {
+	switch name {
+	case "title":
+		return file.Title
+	case "folder":
+		return file.Folder
+	case "course":
+		return file.Meta.CourseTitle
+	case "id":
+		return file.ID
+	case "format":
+		return file.Format
+	case "ext":
+		return suffix
+	}
+	if field := templateField(name); field != nil && field.Dim != "" {
+		return file.Tags[field.Dim]
+	}
+	return ""
+}
+
+// expandTemplatePart 替换一级路径中的字段，字段值中的括号不再替换
+func expandTemplatePart(part string, file LinkData, suffix string) string {
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(part, '{')
+		if start < 0 {
+			sb.WriteString(part)
+			return sb.String()
+		}
+		end := strings.IndexByte(part[start:], '}')
+		if end < 0 {
+			sb.WriteString(part)
+			return sb.String()
+		}
+		sb.WriteString(part[:start])
+		sb.WriteString(fieldValue(part[start+1:start+end], file, suffix))
+		part = part[start+end+1:]
+	}
+}
+
+// render 按模板生成目录和文件名（不含后缀），每一级去除特殊字符
+func (t *NameTemplate) render(file LinkData, suffix string) (dirs []string, stem string) {
+	for i, part := range t.parts {
+		value := expandTemplatePart(part, file, suffix)
+		if i == len(t.parts)-1 {
+			return dirs, sanitizeFilename(value)
+		}
+		if strings.TrimSpace(value) != "" {
+			dirs = append(dirs, sanitizeFilename(value))
+		}
+	}
+	return dirs, ""
+}
+
+// Preview 示例资源的保存路径（相对下载目录）
+func (t *NameTemplate) Preview(file LinkData) string {
+	dirs, stem := t.render(file, file.Format)
+	return filepath.Join(append(dirs, stem+"."+file.Format)...)
+}
@@ -1,6 +1,7 @@
 package dl
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
@@ -162,7 +163,7 @@ func ParseHierarchies(data []byte) TagBase {
 	return tagBase
 }
 
-func fetchJSONFile(url string, filePath string, local bool, save bool) ([]byte, error, bool) {
+func fetchJSONFile(ctx context.Context, url string, filePath string, local bool, save bool) ([]byte, error, bool) {
 	slog.Debug(fmt.Sprintf("process path = %s / file = %s", url, filePath))
 	if local {
 		if _, err := os.Stat(filePath); err == nil {
@@ -175,7 +176,7 @@ func fetchJSONFile(url string, filePath string, local bool, save bool) ([]byte,
 		slog.Debug("Fetch data from " + url)
 	}
 
-	data, err, status := FetchJsonData(url)
+	data, err, status := FetchJsonData(ctx, url)
 	if save && err == nil && status {
 		if err := saveJSONToFile(data, filePath); err != nil {
 			slog.Warn(fmt.Sprintf("Save json data failed: %v", err))
@@ -207,7 +208,7 @@ func ParseURLsFromJSON(data []byte) ([]string, error) {
 	}
 }
 
-func readRawData(name string, local bool, save bool) ([]byte, [][]byte) {
+func readRawData(ctx context.Context, name string, local bool, save bool) ([]byte, [][]byte) {
 	configInfo := TchMaterialInfo
 	if name == TAB_NAMES[2] {
 		configInfo = SyncClassroomInfo
@@ -222,12 +223,12 @@ func readRawData(name string, local bool, save bool) ([]byte, [][]byte) {
 	tagPath := path.Join(dataDir, path.Base(tagURL))
 	versionPath := path.Join(dataDir, path.Base(versionURL))
 
-	tagData, err, statusOK := fetchJSONFile(tagURL, tagPath, local, save)
+	tagData, err, statusOK := fetchJSONFile(ctx, tagURL, tagPath, local, save)
 	if err != nil && statusOK {
 		return tagData, dataList
 	}
 
-	versionData, err, statusOK := fetchJSONFile(versionURL, versionPath, local, save)
+	versionData, err, statusOK := fetchJSONFile(ctx, versionURL, versionPath, local, save)
 	if err != nil && statusOK {
 		return tagData, dataList
 	}
@@ -239,7 +240,7 @@ func readRawData(name string, local bool, save bool) ([]byte, [][]byte) {
 
 	for _, url := range urls {
 		dataPath := path.Join(dataDir, path.Base(url))
-		data, err, statusOK := fetchJSONFile(url, dataPath, local, save)
+		data, err, statusOK := fetchJSONFile(ctx, url, dataPath, local, save)
 		if err != nil && statusOK {
 			continue
 		}
@@ -342,13 +343,13 @@ func UpdateHierarchies2(bookBase *BookItem, tagMap map[string]string, docPDFList
 	}
 }
 
-func FetchRawData2(name string, local bool, save bool) BookItem {
+func FetchRawData2(ctx context.Context, name string, local bool, save bool) BookItem {
 	slog.Debug(fmt.Sprintf("读取 %s", name))
 	if name == TAB_NAMES[3] {
-		return FetchReadingLibraryRawData(local, save)
+		return FetchReadingLibraryRawData(ctx, local, save)
 	}
 
-	tagData, dataList := readRawData(name, local, save)
+	tagData, dataList := readRawData(ctx, name, local, save)
 	tagBase := ParseHierarchies(tagData)
 	tagMap, _, docPDFList := ParseDataList(dataList)
 	slog.Debug(fmt.Sprintf("total docPDFList = %d", len(docPDFList)))
@@ -376,7 +377,7 @@ func FetchRawData2(name string, local bool, save bool) BookItem {
 	return BookItem{}
 }
 
-func FetchReadingLibraryRawData(local bool, save bool) BookItem {
+func FetchReadingLibraryRawData(ctx context.Context, local bool, save bool) BookItem {
 	// 诵读库数据解析：两层结构
 	dataDir := ReadingLibraryInfo.Directory
 	tagURL := ReadingLibraryInfo.Tag
@@ -390,7 +391,7 @@ func FetchReadingLibraryRawData(local bool, save bool) BookItem {
 	slog.Debug(fmt.Sprintf("base url = %s", baseURL))
 
 	tagPath := path.Join(dataDir, path.Base(tagURL))
-	tagData, err, statusOK := fetchJSONFile(tagURL, tagPath, local, save)
+	tagData, err, statusOK := fetchJSONFile(ctx, tagURL, tagPath, local, save)
 	if err != nil && statusOK {
 		return BookItem{}
 	}
@@ -405,7 +406,7 @@ func FetchReadingLibraryRawData(local bool, save bool) BookItem {
 	for _, file := range dv.Files {
 		url := baseURL + file
 		dataPath := path.Join(dataDir, path.Base(url))
-		data, err, statusOK := fetchJSONFile(url, dataPath, local, save)
+		data, err, statusOK := fetchJSONFile(ctx, url, dataPath, local, save)
 		if err != nil && statusOK {
 			continue
 		}
@@ -575,7 +576,8 @@ func queryBooks(bookItem BookItem, prefixList []string) []BookOption {
 	return bookOptions
 }
 
-func ParseCourseID(courseID string) []CourseToc {
+// ParseCourseID 查询课程包的章节目录，请求使用 ctx 中的重试策略
+func ParseCourseID(ctx context.Context, courseID string) []CourseToc {
 	// b7062df1-f929-458e-964c-d778f89ca255\
 	server := SERVER_LIST[rand.Intn(len(SERVER_LIST))]
 	var courseInfo []DataCourseInfo        //
@@ -587,7 +589,7 @@ func ParseCourseID(courseID string) []CourseToc {
 
 	url := fmt.Sprintf(pattern, server, courseID)
 	slog.Debug(fmt.Sprintf("URL = %s", url))
-	data, err, _ := FetchJsonData(url) // parts.json
+	data, err, _ := FetchJsonData(ctx, url) // parts.json
 	if err != nil {
 		return courseToc
 	}
@@ -601,7 +603,7 @@ func ParseCourseID(courseID string) []CourseToc {
 	slog.Debug(fmt.Sprintf("course id urls = %s", urls))
 
 	for _, url := range urls {
-		data, err, _ := FetchJsonData(url)
+		data, err, _ := FetchJsonData(ctx, url)
 		if err != nil {
 			slog.Warn(fmt.Sprintf("Failed to fetch data from %s: %v", url, err))
 			continue
@@ -633,7 +635,7 @@ func ParseCourseID(courseID string) []CourseToc {
 
 	teachID := courseInfo[0].TeachIDs[0] // = tree_id
 	url = fmt.Sprintf(pattern2, server, teachID)
-	data, err, _ = FetchJsonData(url)
+	data, err, _ = FetchJsonData(ctx, url)
 	if err != nil {
 		return courseToc
 	}
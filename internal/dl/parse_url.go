@@ -1,6 +1,7 @@
 package dl
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
@@ -232,6 +233,30 @@ func convertURL(rawLink string, isClean bool) string {
 	return link
 }
 
+// candidateURLs 候选下载链接：原始链接、去掉 .pkg 的链接、ndr-private → ndr 的链接
+func candidateURLs(links []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	add := func(link string) {
+		if link != "" && !seen[link] {
+			seen[link] = true
+			result = append(result, link)
+		}
+	}
+
+	for _, link := range links {
+		add(link)
+	}
+	for _, link := range links {
+		add(convertURL(link, false))
+	}
+	for _, link := range links {
+		add(strings.ReplaceAll(link, "ndr-private.", "ndr."))
+		add(convertURL(link, true))
+	}
+	return result
+}
+
 // 提取教师名称并拼接
 func getTeacherNames(r ResourceItemExt) string {
 	// slog.Debug(fmt.Sprintf("Teacher %v", r.TeacherList))
@@ -313,12 +338,19 @@ func parseResourceItems(data []byte, tiFormatList []string, random bool) ([]Link
 	// 尝试解析为ResourceItemExt (课程包)
 	var itemExt ResourceItemExt
 	teacherNames := ""
+	var teachers []string
 	schoolName := ""
 	bookName := ""
+	courseID, courseTitle := "", ""
 
 	if err := json.Unmarshal(data, &itemExt); err == nil {
 		slog.Debug(fmt.Sprintf("CustomProperties %v", itemExt.CustomProperties))
 		teacherNames = getTeacherNames(itemExt)
+		for _, teacher := range itemExt.TeacherList {
+			if teacher.Name != "" {
+				teachers = append(teachers, teacher.Name)
+			}
+		}
 		schoolName = itemExt.CustomProperties.SchoolName
 		bookName = itemExt.CustomProperties.BookInfo.Name
 
@@ -326,6 +358,7 @@ func parseResourceItems(data []byte, tiFormatList []string, random bool) ([]Link
 		tempItems := getFirstItemResource[ResourceItem](itemExt.Relations)
 		if tempItems != nil {
 			items = tempItems
+			courseID, courseTitle = itemExt.ID, itemExt.Title.Name
 		}
 	}
 
@@ -374,6 +407,8 @@ func parseResourceItems(data []byte, tiFormatList []string, random bool) ([]Link
 		var rawLink string
 		var format string
 		var size int64
+		var md5sum string
+		var storages []string
 
 		for _, tiItem := range item.TiItems {
 			format = tiItem.TiFormat
@@ -392,8 +427,10 @@ func parseResourceItems(data []byte, tiFormatList []string, random bool) ([]Link
 			if random {
 				randomIndex = rand.Intn(len(tiItem.TiStorages))
 			}
-			rawLink = tiItem.TiStorages[randomIndex]
+			storage := tiItem.TiStorages[randomIndex]
+			rawLink = storage
 			size = tiItem.TiSize
+			md5sum = tiItem.TiMD5
 			if len(tiItem.CustomProperties.Requirements) > 0 {
 				for _, reqItem := range tiItem.CustomProperties.Requirements {
 					slog.Debug(fmt.Sprintf("reqItem = %v", reqItem))
@@ -414,16 +451,35 @@ func parseResourceItems(data []byte, tiFormatList []string, random bool) ([]Link
 					}
 				}
 			}
+			if tiItem.TiFormat == "folder" && rawLink != storage {
+				// 大小和 MD5 对应整个目录，不能用于校验其中的文件
+				size, md5sum = -1, ""
+			}
 
 			if title == "" {
 				title = fmt.Sprintf("%s-%03d", strings.ToUpper(format), i)
 			}
 			if rawLink != "" {
+				// 全部镜像链接，选中的在前，补充与 rawLink 相同的路径
+				storages = []string{rawLink}
+				base := strings.TrimRight(storage, "/")
+				if strings.HasPrefix(rawLink, base) {
+					extra := strings.TrimPrefix(rawLink, base)
+					for _, mirror := range tiItem.TiStorages {
+						if mirror != storage {
+							storages = append(storages, strings.TrimRight(mirror, "/")+extra)
+						}
+					}
+				}
 				break
 			}
 		}
 
 		fullTitle := concatFullTitle(title, "", schoolName, teacherNames)
+		tagList := item.TagList
+		if len(tagList) == 0 {
+			tagList = itemExt.CustomProperties.BookInfo.TagList
+		}
 		if rawLink != "" {
 			linkData := LinkData{
 				Format:    format,
@@ -432,7 +488,21 @@ func parseResourceItems(data []byte, tiFormatList []string, random bool) ([]Link
 				ID:        item.ID,
 				RawURL:    rawLink,
 				BackupURL: convertURL(rawLink, true), // 备用下载链接
+				URLs:      candidateURLs(storages),
 				Size:      size,
+				MD5:       md5sum,
+				Tags:      catalogTags(tagList),
+				Meta: ResourceMeta{
+					ResourceType: item.ResourceType,
+					Teachers:     teachers,
+					School:       schoolName,
+					BookID:       itemExt.CustomProperties.BookInfo.ID,
+					BookTitle:    bookName,
+					CourseID:     courseID,
+					CourseTitle:  courseTitle,
+					Order:        i,
+					TagList:      tagList,
+				},
 			}
 			result = append(result, linkData)
 			slog.Debug(fmt.Sprintf("format = %s, linkData = %v", format, linkData))
@@ -443,7 +513,7 @@ func parseResourceItems(data []byte, tiFormatList []string, random bool) ([]Link
 	return result, nil
 }
 
-func parsePaperResourceItems(data []byte, random bool) ([]LinkData, error) {
+func parsePaperResourceItems(ctx context.Context, data []byte, random bool) ([]LinkData, error) {
 	// 练习（试卷） 或者 container_id 字段，请求data.json获得pdf
 	var result []LinkData
 	var resourceItem ResourceItem
@@ -460,7 +530,7 @@ func parsePaperResourceItems(data []byte, random bool) ([]LinkData, error) {
 
 	dataURL := fmt.Sprintf(configInfo.resources.follow, cdnHost, resourceItem.ContainerID, resourceItem.ID)
 	slog.Debug(fmt.Sprintf("resourceType = %s, dataURL = %v", resourceType, dataURL))
-	dataResult, err, statusOK := FetchJsonData(dataURL)
+	dataResult, err, statusOK := FetchJsonData(ctx, dataURL)
 	if err != nil || !statusOK {
 		slog.Warn(fmt.Sprintf("fetch data error: %v / status=%v", err, statusOK))
 		return nil, err
@@ -502,9 +572,8 @@ func parsePaperResourceItems(data []byte, random bool) ([]LinkData, error) {
 	return result, nil
 }
 
-func parseCourseResourceItems(data []byte, random bool) ([]LinkData, error) {
+func parseCourseResourceItems(ctx context.Context, data []byte, random bool) ([]LinkData, error) {
 	// 视频合集
-	var result []LinkData
 	var courseItem CourseDetailItem
 	if err := json.Unmarshal(data, &courseItem); err != nil {
 		return nil, err
@@ -519,42 +588,67 @@ func parseCourseResourceItems(data []byte, random bool) ([]LinkData, error) {
 
 	dataURL := fmt.Sprintf(configInfo.resources.follow, cdnHost, activity_set_id)
 	slog.Debug(fmt.Sprintf("dataURL = %v", dataURL))
-	dataResult, err, statusOK := FetchJsonData(dataURL)
+	dataResult, err, statusOK := FetchJsonData(ctx, dataURL)
 	if err != nil || !statusOK {
 		slog.Warn(fmt.Sprintf("fetch data error: %v / status=%v", err, statusOK))
 		return nil, err
 	}
 
-	// 解析数据
+	result := parseCourseActivities(dataResult, courseItem.Course.ID)
+	slog.Debug(fmt.Sprintf("Extract result items = %d", len(result)))
+	return result, nil
+}
+
+// parseCourseActivities 解析视频合集中的视频，课程信息与课程包中的资源一致，便于按课程整理和打包
+func parseCourseActivities(dataResult []byte, courseID string) []LinkData {
+	var result []LinkData
 	activitySetName := gjson.GetBytes(dataResult, "activity_set_name").String()
 	nodes := gjson.GetBytes(dataResult, "nodes")
 	nodes.ForEach(func(_, value gjson.Result) bool {
 		res := value.Get("relations.activity.activity_resources")
 		res.ForEach(func(_, item gjson.Result) bool {
 			title := item.Get("video_extend.title").String()
-			urls := item.Get("video_extend.urls").Array() // 多条数据，内容一致但文件大小不同: 720p, 480p
-			if len(urls) > 0 {
-				m3u8URLS := urls[0].Get("urls").Array() // 多个候选，随机
-				if len(m3u8URLS) > 0 {
-					downloadURL := m3u8URLS[rand.Intn(len(m3u8URLS))].String()
-					result = append(result, LinkData{
-						Format:    "m3u8",
-						Title:     title,
-						Folder:    activitySetName,
-						ID:        item.Get("resource_id").String(),
-						RawURL:    downloadURL,
-						BackupURL: downloadURL,
-						Size:      -1, // urls[0].Get("size").Int() 不准确
-					})
+			urls := item.Get("video_extend.urls").Array() // 多条数据，内容一致但清晰度不同: 720p, 480p
+			var variants []VideoVariant
+			for _, entry := range urls {
+				m3u8URLS := entry.Get("urls").Array() // 多个候选，随机，其余作为镜像
+				if len(m3u8URLS) == 0 {
+					continue
+				}
+				randomIndex := rand.Intn(len(m3u8URLS))
+				candidates := []string{m3u8URLS[randomIndex].String()}
+				for j, m3u8URL := range m3u8URLS {
+					if j != randomIndex {
+						candidates = append(candidates, m3u8URL.String())
+					}
 				}
+				variants = append(variants, courseVideoVariant(entry, candidates))
+			}
+			if len(variants) > 0 {
+				// 默认第一条，下载时按清晰度策略选择
+				downloadURL := variants[0].URLs[0]
+				result = append(result, LinkData{
+					Format:    "m3u8",
+					Title:     title,
+					Folder:    activitySetName,
+					ID:        item.Get("resource_id").String(),
+					RawURL:    downloadURL,
+					BackupURL: downloadURL,
+					URLs:      variants[0].URLs,
+					Variants:  variants,
+					Size:      -1, // urls[0].Get("size").Int() 不准确
+					Meta: ResourceMeta{
+						CourseID:    courseID,
+						CourseTitle: activitySetName,
+						Order:       len(result),
+					},
+				})
 			}
 			return true
 		})
 		return true
 	})
-
-	slog.Debug(fmt.Sprintf("Extract result items = %d", len(result)))
-	return result, nil
+	return result
 }
 
 func getResourceItem(link string) (LinkData, error) {
@@ -589,6 +683,7 @@ func getResourceItem(link string) (LinkData, error) {
 		ID:        id,
 		RawURL:    link,
 		BackupURL: backupLink,
+		URLs:      candidateURLs([]string{link}),
 		Size:      -1,
 	}
 	return result, nil
@@ -646,7 +741,8 @@ func renameDuplicates(result []LinkData) []LinkData {
 	return unique
 }
 
-func ExtractResources(links []string, formatList []string, random bool, useBackup bool, isParse bool) []LinkData {
+// ExtractResources 解析链接中的资源；请求使用 ctx 中的重试策略（见 WithRetries），ctx 取消时停止解析
+func ExtractResources(ctx context.Context, links []string, formatList []string, random bool, useBackup bool, isParse bool) []LinkData {
 	var result []LinkData
 
 	var audio = false
@@ -669,6 +765,9 @@ func ExtractResources(links []string, formatList []string, random bool, useBacku
 	slog.Debug(fmt.Sprintf("links = %v, configURLList is %v", len(links), len(configURLList)))
 
 	for _, pair := range configURLList {
+		if ctx.Err() != nil {
+			break
+		}
 		var (
 			resources []LinkData
 			errMsg    string
@@ -680,6 +779,7 @@ func ExtractResources(links []string, formatList []string, random bool, useBacku
 		if strings.Contains(url, RESOURCES_PATH) {
 			resource, err := getResourceItem(url)
 			if err == nil {
+				resource.Meta.SourceURL = pair.query
 				if slices.Contains(formatList, resource.Format) {
 					result = append(result, resource)
 				}
@@ -687,7 +787,7 @@ func ExtractResources(links []string, formatList []string, random bool, useBacku
 			}
 		}
 
-		data, err, statusOK := FetchJsonData(url)
+		data, err, statusOK := FetchJsonData(ctx, url)
 		if err != nil || !statusOK {
 			slog.Warn(fmt.Sprintf("fetch data error: %v / status=%v", err, statusOK))
 			continue
@@ -700,14 +800,14 @@ func ExtractResources(links []string, formatList []string, random bool, useBacku
 				continue
 			}
 			errMsg = "parse paper resource error"
-			resources, err = parsePaperResourceItems(data, random)
+			resources, err = parsePaperResourceItems(ctx, data, random)
 
 		case isCourseDetailResourceURL(pair.query):
 			if !slices.Contains(formatList, "m3u8") {
 				continue
 			}
 			errMsg = "parse course detail error"
-			resources, err = parseCourseResourceItems(data, random)
+			resources, err = parseCourseResourceItems(ctx, data, random)
 
 		default:
 			errMsg = "parse resource data error"
@@ -719,6 +819,9 @@ func ExtractResources(links []string, formatList []string, random bool, useBacku
 			continue
 		}
 
+		for i := range resources {
+			resources[i].Meta.SourceURL = pair.query
+		}
 		result = append(result, resources...)
 	}
 
@@ -0,0 +1,217 @@
+package dl
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hantang/smartedudlgo/internal/pdf"
+)
+
+// 合并文件名后缀，如 书名-合并.pdf，避免与原文件重名
+const mergedPDFSuffix = "-合并.pdf"
+
+// mergeItem 等待合并的一个 PDF 文件
+type mergeItem struct {
+	index int
+	path  string
+	title string
+}
+
+// mergeGroup 同一 Folder（一本书）中的 PDF 文件
+type mergeGroup struct {
+	items      []mergeItem
+	incomplete bool // 有文件下载失败或取消，不合并
+	merged     bool // 有文件因已合并而跳过，合并文件已存在
+}
+
+// mergedSource 合并后删除的原文件，再次下载时按合并文件跳过或校验
+type mergedSource struct {
+	Merged string `json:"merged"` // 合并文件，相对原文件所在目录
+	Size   int64  `json:"size"`
+	MD5    string `json:"md5"`
+}
+
+// mergedIndex 目录中合并后删除的原文件，按文件名索引
+type mergedIndex struct {
+	UpdatedAt time.Time               `json:"updated_at"`
+	Files     map[string]mergedSource `json:"files"`
+}
+
+// pdfMerger 订阅下载事件，全部结束后将同一 Folder 的多个 PDF 按条目顺序合并为一个带书签的文件，
+// 书签标题为各文件的标题；removeParts 时合并成功后删除原文件及其元数据文件，并在 MERGED_FILE 中记录原文件
+type pdfMerger struct {
+	mu          sync.Mutex
+	groups      map[string]*mergeGroup
+	removeParts bool
+	meta        *metadataWriter // 写入元数据时为合并文件写入元数据，否则为 nil
+}
+
+func newPDFMerger(removeParts bool, meta *metadataWriter) *pdfMerger {
+	return &pdfMerger{groups: make(map[string]*mergeGroup), removeParts: removeParts, meta: meta}
+}
+
+func (m *pdfMerger) OnEvent(e Event) {
+	switch e := e.(type) {
+	case JobFinished:
+		if e.Link.Folder == "" || !strings.EqualFold(e.Link.Format, "pdf") {
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		group := m.groups[e.Link.Folder]
+		if group == nil {
+			group = &mergeGroup{}
+			m.groups[e.Link.Folder] = group
+		}
+		if e.Status == JobSkipped && isMergedPDF(e.Path) {
+			group.merged = true
+		} else if (e.Status == JobSucceeded || e.Status == JobSkipped) && e.Path != "" {
+			group.items = append(group.items, mergeItem{index: e.Index, path: e.Path, title: e.Link.Title})
+		} else {
+			group.incomplete = true
+		}
+	case BatchFinished:
+		m.mergeAll()
+	}
+}
+
+func (m *pdfMerger) mergeAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for folder, group := range m.groups {
+		if group.merged {
+			slog.Info(fmt.Sprintf("%s 已合并，不重新合并PDF", folder))
+			continue
+		}
+		if len(group.items) < 2 {
+			continue
+		}
+		if group.incomplete {
+			slog.Warn(fmt.Sprintf("%s 有文件未下载完成，不合并PDF", folder))
+			continue
+		}
+		if err := m.merge(folder, group.items); err != nil {
+			slog.Warn(fmt.Sprintf("合并PDF %s 出错：%v", folder, err))
+		}
+	}
+	clear(m.groups)
+}
+
+// merge 按条目顺序合并为第一个文件所在目录中的 Folder-合并.pdf，已存在时替换
+func (m *pdfMerger) merge(folder string, items []mergeItem) error {
+	slices.SortFunc(items, func(a, b mergeItem) int {
+		return cmp.Compare(a.index, b.index)
+	})
+	sources := make([]pdf.Source, len(items))
+	for i, item := range items {
+		sources[i] = pdf.Source{Path: item.path, Title: item.title}
+	}
+	dstPath := filepath.Join(filepath.Dir(items[0].path), sanitizeFilename(folder)+mergedPDFSuffix)
+	tmpPath := dstPath + ".tmp"
+	if err := pdf.Merge(sources, tmpPath, folder); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	slog.Info(fmt.Sprintf("已合并 %d 个PDF为 %s", len(items), dstPath))
+
+	if m.meta != nil {
+		link := LinkData{Title: folder, Format: "pdf", Folder: folder, Size: -1}
+		if err := m.meta.write(JobFinished{Link: link, Status: JobSucceeded, Path: dstPath}); err != nil {
+			slog.Warn(fmt.Sprintf("写入元数据 %s 出错：%v", dstPath+metadataSuffix, err))
+		}
+	}
+	if m.removeParts {
+		// 先记录合并文件包含的原文件，再次下载时跳过或校验后跳过
+		if err := recordMerged(dstPath, items); err != nil {
+			return fmt.Errorf("记录合并的原文件出错，不删除原文件：%w", err)
+		}
+		for _, item := range items {
+			if err := os.Remove(item.path); err != nil {
+				slog.Warn(fmt.Sprintf("删除 %s 出错：%v", item.path, err))
+				continue
+			}
+			os.Remove(item.path + metadataSuffix)
+			if m.meta != nil {
+				m.meta.remove(item.path)
+			}
+		}
+	}
+	return nil
+}
+
+// isMergedPDF 是否为合并生成的文件
+func isMergedPDF(path string) bool {
+	return strings.HasSuffix(path, mergedPDFSuffix)
+}
+
+// recordMerged 在原文件所在目录的 MERGED_FILE 中记录原文件的大小、MD5 和合并文件
+func recordMerged(dstPath string, items []mergeItem) error {
+	files := make(map[string]map[string]mergedSource)
+	for _, item := range items {
+		dir, name := filepath.Split(item.path)
+		dir = filepath.Clean(dir)
+		digest, size, err := hashFile(item.path)
+		if err != nil {
+			return err
+		}
+		merged, err := filepath.Rel(dir, dstPath)
+		if err != nil {
+			return err
+		}
+		if files[dir] == nil {
+			files[dir] = make(map[string]mergedSource)
+		}
+		files[dir][name] = mergedSource{Merged: filepath.ToSlash(merged), Size: size, MD5: digest.MD5}
+	}
+	for dir, sources := range files {
+		index := loadMergedIndex(dir)
+		if index.Files == nil {
+			index.Files = make(map[string]mergedSource)
+		}
+		maps.Copy(index.Files, sources)
+		index.UpdatedAt = time.Now()
+		if err := writeJSONFile(filepath.Join(dir, MERGED_FILE), index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadMergedIndex(dir string) mergedIndex {
+	var index mergedIndex
+	data, err := os.ReadFile(filepath.Join(dir, MERGED_FILE))
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		slog.Warn(fmt.Sprintf("读取 %s 出错：%v", filepath.Join(dir, MERGED_FILE), err))
+	}
+	return index
+}
+
+// findMerged 查找已合并并删除的原文件，合并文件不存在时返回 false
+func findMerged(path string) (string, mergedSource, bool) {
+	dir, name := filepath.Split(path)
+	source, ok := loadMergedIndex(filepath.Clean(dir)).Files[name]
+	if !ok {
+		return "", source, false
+	}
+	mergedPath := filepath.Join(dir, filepath.FromSlash(source.Merged))
+	info, err := os.Stat(mergedPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", source, false
+	}
+	return mergedPath, source, true
+}
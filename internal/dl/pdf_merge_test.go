@@ -0,0 +1,76 @@
+package dl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 合并后删除原文件（-merge-remove）时，再次下载按合并时的记录跳过或校验，不重新下载
+func TestCheckExistingMerged(t *testing.T) {
+	dir := t.TempDir()
+	body := "%PDF-1.4\n1 0 obj\n<<>>\nendobj\nstartxref\n0\n%%EOF\n"
+	dm := NewDownloadManager(dir, nil)
+	var links []LinkData
+	var items []mergeItem
+	for i, title := range []string{"上册", "下册"} {
+		link := LinkData{Format: "pdf", Title: title, Folder: "数学", Size: int64(len(body))}
+		path := dm.buildSavePath(link, link.Format, 0)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		digest, _, err := hashFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		link.MD5 = digest.MD5
+		links = append(links, link)
+		items = append(items, mergeItem{index: i, path: path, title: title})
+	}
+	mergedPath := filepath.Join(filepath.Dir(items[0].path), "数学"+mergedPDFSuffix)
+	if err := os.WriteFile(mergedPath, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordMerged(mergedPath, items); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if err := os.Remove(item.path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, policy := range []ConflictPolicy{ConflictSkip, ConflictVerify} {
+		path, skip, _ := dm.checkExisting(links[0], policy)
+		if !skip || path != mergedPath {
+			t.Errorf("%s: checkExisting = %q, %v, want skip with merged file", policy, path, skip)
+		}
+	}
+	if _, skip, _ := dm.checkExisting(links[0], ConflictRename); skip {
+		t.Error("rename: merged file should not be skipped")
+	}
+	changed := links[1]
+	changed.MD5 = "d41d8cd98f00b204e9800998ecf8427e"
+	if _, skip, _ := dm.checkExisting(changed, ConflictVerify); skip {
+		t.Error("verify: source with different MD5 should be downloaded again")
+	}
+
+	// 跳过的文件已在合并文件中，不重新合并
+	merger := newPDFMerger(true, nil)
+	for i, link := range links {
+		merger.OnEvent(JobFinished{Index: i, Link: link, Status: JobSkipped, Path: mergedPath})
+	}
+	if group := merger.groups["数学"]; group == nil || !group.merged || len(group.items) != 0 {
+		t.Fatalf("merge group = %+v, want merged without items", group)
+	}
+
+	if err := os.Remove(mergedPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, skip, _ := dm.checkExisting(links[0], ConflictSkip); skip {
+		t.Error("skip: source should be downloaded again after the merged file is removed")
+	}
+}
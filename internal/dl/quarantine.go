@@ -0,0 +1,162 @@
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 隔离目录最多保留的文件数和总大小，超过时删除最早隔离的文件
+const (
+	quarantineMaxFiles = 20
+	quarantineMaxBytes = 1 << 30
+)
+
+// 隔离文件名以隔离时间开头
+const quarantineTimeLayout = "20060102-150405.000"
+
+var quarantineMu sync.Mutex
+
+// quarantineNote 隔离文件旁记录来源和原因
+type quarantineNote struct {
+	Title  string    `json:"title"`
+	ID     string    `json:"id"`
+	URL    string    `json:"url"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// quarantinedFile 隔离目录中的一个文件（不含记录）
+type quarantinedFile struct {
+	path string
+	size int64
+	time time.Time
+}
+
+// QuarantineDir 下载目录中的隔离目录
+func QuarantineDir(downloadsDir string) string {
+	return filepath.Join(downloadsDir, QUARANTINE_DIR)
+}
+
+// quarantine 将校验失败的文件移到下载目录的隔离目录，便于排查；
+// 调用方每个文件只隔离第一次失败的内容，隔离目录超过数量或大小限制时删除最早的文件
+func (dm *DownloadManager) quarantine(path string, file LinkData, link string, reason error) {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+
+	dir := QuarantineDir(dm.downloadsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		slog.Warn(fmt.Sprintf("创建隔离目录 %s 出错：%v", dir, err))
+		return
+	}
+	now := time.Now()
+	name := now.Format(quarantineTimeLayout) + "-" + strings.TrimSuffix(filepath.Base(path), partSuffix)
+	dst := filepath.Join(dir, name)
+	if err := moveFile(path, dst); err != nil {
+		slog.Warn(fmt.Sprintf("隔离文件 %s 出错：%v", path, err))
+		return
+	}
+	note := quarantineNote{Title: file.Title, ID: file.ID, URL: link, Reason: reason.Error(), Time: now}
+	if err := writeJSONFile(dst+metadataSuffix, note); err != nil {
+		slog.Warn(fmt.Sprintf("写入隔离记录 %s 出错：%v", dst+metadataSuffix, err))
+	}
+	slog.Info(fmt.Sprintf("已隔离无效文件 %s", dst))
+
+	files, err := listQuarantined(dir)
+	if err != nil {
+		return
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	// 最新隔离的文件总是保留
+	for len(files) > 1 && (len(files) > quarantineMaxFiles || total > quarantineMaxBytes) {
+		if err := removeQuarantined(files[0].path); err != nil {
+			slog.Warn(fmt.Sprintf("删除隔离文件 %s 出错：%v", files[0].path, err))
+		}
+		total -= files[0].size
+		files = files[1:]
+	}
+}
+
+// listQuarantined 按隔离时间从早到晚列出隔离文件
+func listQuarantined(dir string) ([]quarantinedFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []quarantinedFile
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), metadataSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		f := quarantinedFile{path: filepath.Join(dir, entry.Name()), size: info.Size(), time: info.ModTime()}
+		if len(entry.Name()) > len(quarantineTimeLayout) {
+			if t, err := time.ParseInLocation(quarantineTimeLayout, entry.Name()[:len(quarantineTimeLayout)], time.Local); err == nil {
+				f.time = t
+			}
+		}
+		files = append(files, f)
+	}
+	slices.SortFunc(files, func(a, b quarantinedFile) int {
+		return a.time.Compare(b.time)
+	})
+	return files, nil
+}
+
+// removeQuarantined 删除隔离文件及其记录
+func removeQuarantined(path string) error {
+	err := os.Remove(path)
+	if removeErr := os.Remove(path + metadataSuffix); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+		err = errors.Join(err, removeErr)
+	}
+	return err
+}
+
+// CleanQuarantine 删除下载目录中隔离超过 olderThan 的文件（0 表示全部），返回删除的文件数和释放的字节数；
+// 隔离目录为空时一并删除
+func CleanQuarantine(downloadsDir string, olderThan time.Duration) (int, int64, error) {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+
+	dir := QuarantineDir(downloadsDir)
+	files, err := listQuarantined(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		removed int
+		freed   int64
+		errs    []error
+	)
+	for _, f := range files {
+		if olderThan > 0 && time.Since(f.time) < olderThan {
+			continue
+		}
+		if err := removeQuarantined(f.path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+		freed += f.size
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+		os.Remove(dir)
+	}
+	return removed, freed, errors.Join(errs...)
+}
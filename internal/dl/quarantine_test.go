@@ -0,0 +1,72 @@
+package dl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 多次重试和多个候选链接都返回错误页面时只隔离一份
+func TestQuarantineOncePerFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>error</html>"))
+	}))
+	defer srv.Close()
+
+	old := defaultRetryPolicy
+	defer func() { defaultRetryPolicy = old }()
+	defaultRetryPolicy.BaseDelay = time.Millisecond
+	defaultRetryPolicy.MaxDelay = time.Millisecond
+
+	dir := t.TempDir()
+	links := []LinkData{{Format: "pdf", Title: "a", RawURL: srv.URL + "/a.pdf", BackupURL: srv.URL + "/b.pdf"}}
+	result := NewDownloadManager(dir, links).StartDownload(context.Background(), DownloadOptions{Retries: 3})
+	if result.Failed != 1 {
+		t.Fatalf("result = %+v, want 1 failed", result)
+	}
+	files, err := listQuarantined(QuarantineDir(dir))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("quarantined = %v, err %v, want 1 file", files, err)
+	}
+	if _, err := os.Stat(files[0].path + metadataSuffix); err != nil {
+		t.Fatalf("quarantine note missing: %v", err)
+	}
+}
+
+func TestQuarantineLimitAndClean(t *testing.T) {
+	dir := t.TempDir()
+	dm := NewDownloadManager(dir, nil)
+	for i := range quarantineMaxFiles + 2 {
+		path := filepath.Join(dir, "a.pdf"+partSuffix)
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", i+1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		dm.quarantine(path, LinkData{Title: "a"}, "https://example.com/a.pdf", errInvalidContent)
+		time.Sleep(2 * time.Millisecond) // 隔离文件名精确到毫秒
+	}
+	files, err := listQuarantined(QuarantineDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != quarantineMaxFiles || files[0].size != 3 {
+		t.Fatalf("got %d files, oldest size %d; want %d files without the 2 oldest", len(files), files[0].size, quarantineMaxFiles)
+	}
+
+	removed, freed, err := CleanQuarantine(dir, time.Hour)
+	if err != nil || removed != 0 {
+		t.Fatalf("CleanQuarantine(1h) = %d, %v; want nothing removed", removed, err)
+	}
+	removed, freed, err = CleanQuarantine(dir, 0)
+	if err != nil || removed != quarantineMaxFiles || freed == 0 {
+		t.Fatalf("CleanQuarantine(0) = %d, %d, %v", removed, freed, err)
+	}
+	if _, err := os.Stat(QuarantineDir(dir)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("empty quarantine dir should be removed: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package dl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const queueFile = "queue.json"
+
+// QueueState 队列中文件的下载状态
+type QueueState string
+
+const (
+	QueueQueued  QueueState = "queued"
+	QueueRunning QueueState = "running"
+	QueueDone    QueueState = "done"
+	QueueFailed  QueueState = "failed"
+	QueueSkipped QueueState = "skipped"
+)
+
+// QueueItem 队列中的一个文件
+type QueueItem struct {
+	Link      LinkData   `json:"link"`
+	State     QueueState `json:"state"`
+	Attempts  int        `json:"attempts"`
+	Path      string     `json:"path,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// QueueOptions 可保存的下载参数，不包含登录信息
+type QueueOptions struct {
+	IsVideo        bool           `json:"is_video"`
+	EnableLog      bool           `json:"enable_log"`
+	MaxConcurrency int            `json:"max_concurrency"`
+	Conflict       ConflictPolicy `json:"conflict"`
+	Container      VideoContainer `json:"container"`
+	Quality        string         `json:"quality"` // QualityPolicy.Value
+	NameTemplate   string         `json:"name_template,omitempty"`
+	WriteMetadata  bool           `json:"write_metadata,omitempty"`
+	MergePDF       bool           `json:"merge_pdf,omitempty"`
+	RemoveMerged   bool           `json:"remove_merged,omitempty"`
+	Retries        int            `json:"retries,omitempty"`
+}
+
+// DownloadOptions 恢复下载参数，登录信息由调用方重新提供
+func (o QueueOptions) DownloadOptions(headers map[string]string) DownloadOptions {
+	quality, _ := ParseQualityPolicy(o.Quality)
+	return DownloadOptions{
+		Headers:        headers,
+		EnableLog:      o.EnableLog,
+		IsVideo:        o.IsVideo,
+		MaxConcurrency: o.MaxConcurrency,
+		Conflict:       o.Conflict,
+		Container:      o.Container,
+		Quality:        quality,
+		NameTemplate:   o.NameTemplate,
+		WriteMetadata:  o.WriteMetadata,
+		MergePDF:       o.MergePDF,
+		RemoveMerged:   o.RemoveMerged,
+		Retries:        o.Retries,
+	}
+}
+
+// Queue 保存到用户配置目录的下载队列，程序崩溃或重启后可继续未完成的文件。
+// 作为 Observer 订阅 DownloadManager 的事件更新状态，队列下标与下载下标一致。
+type Queue struct {
+	DownloadsDir string       `json:"downloads_dir"`
+	Options      QueueOptions `json:"options"`
+	Items        []QueueItem  `json:"items"`
+	CreatedAt    time.Time    `json:"created_at"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// QueuePath 队列文件路径
+func QueuePath() string {
+	root, err := os.UserConfigDir()
+	if err != nil {
+		root = os.TempDir()
+	}
+	return filepath.Join(root, APP_NAME, queueFile)
+}
+
+// NewQueue 创建并保存新的下载队列，替换之前的队列
+func NewQueue(downloadsDir string, links []LinkData, opts DownloadOptions) *Queue {
+	now := time.Now()
+	q := &Queue{
+		DownloadsDir: downloadsDir,
+		Options: QueueOptions{
+			IsVideo:        opts.IsVideo,
+			EnableLog:      opts.EnableLog,
+			MaxConcurrency: opts.MaxConcurrency,
+			Conflict:       opts.Conflict,
+			Container:      opts.Container,
+			Quality:        opts.Quality.Value(),
+			NameTemplate:   opts.NameTemplate,
+			WriteMetadata:  opts.WriteMetadata,
+			MergePDF:       opts.MergePDF,
+			RemoveMerged:   opts.RemoveMerged,
+			Retries:        opts.Retries,
+		},
+		CreatedAt: now,
+		path:      QueuePath(),
+	}
+	for _, link := range links {
+		q.Items = append(q.Items, QueueItem{Link: link, State: QueueQueued, UpdatedAt: now})
+	}
+	q.save()
+	return q
+}
+
+// LoadQueue 读取上次保存的队列，没有时返回 nil
+func LoadQueue() (*Queue, error) {
+	path := QueuePath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{path: path}
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, fmt.Errorf("读取下载队列 %s 出错：%w", path, err)
+	}
+	return q, nil
+}
+
+// DiscardQueue 删除保存的队列
+func DiscardQueue() error {
+	err := os.Remove(QueuePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// unfinished 等待、正在下载（中断）或下载失败的文件，可继续下载
+func (s QueueState) unfinished() bool {
+	return s == QueueQueued || s == QueueRunning || s == QueueFailed
+}
+
+// Unfinished 未完成（含下载失败）的文件数
+func (q *Queue) Unfinished() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	count := 0
+	for _, item := range q.Items {
+		if item.State.unfinished() {
+			count++
+		}
+	}
+	return count
+}
+
+// Remaining 只保留未完成（含下载失败）文件的新队列，用于继续下载
+func (q *Queue) Remaining() *Queue {
+	return q.subset(QueueState.unfinished)
+}
+
+// RetryFailed 只保留下载失败文件的新队列，用于重试
+func (q *Queue) RetryFailed() *Queue {
+	return q.subset(func(s QueueState) bool { return s == QueueFailed })
+}
+
+// subset 保留符合条件的文件（保留尝试次数和上次的错误），保存并替换当前队列
+func (q *Queue) subset(keep func(QueueState) bool) *Queue {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	remaining := &Queue{
+		DownloadsDir: q.DownloadsDir,
+		Options:      q.Options,
+		CreatedAt:    q.CreatedAt,
+		path:         q.path,
+	}
+	for _, item := range q.Items {
+		if keep(item.State) {
+			item.State = QueueQueued
+			remaining.Items = append(remaining.Items, item)
+		}
+	}
+	remaining.save()
+	return remaining
+}
+
+// Links 队列中的全部文件，顺序与队列一致
+func (q *Queue) Links() []LinkData {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	links := make([]LinkData, len(q.Items))
+	for i, item := range q.Items {
+		links[i] = item.Link
+	}
+	return links
+}
+
+func (q *Queue) OnEvent(e Event) {
+	switch e := e.(type) {
+	case JobStarted:
+		q.update(e.Index, func(item *QueueItem) {
+			item.State = QueueRunning
+			item.Attempts++
+		})
+	case JobFinished:
+		q.update(e.Index, func(item *QueueItem) {
+			switch e.Status {
+			case JobSucceeded:
+				item.State = QueueDone
+			case JobSkipped:
+				item.State = QueueSkipped
+			case JobFailed:
+				item.State = QueueFailed
+			default:
+				// 取消的文件下次继续
+				item.State = QueueQueued
+			}
+			item.Path = e.Path
+			item.Error = ""
+			if e.Err != nil && e.Status == JobFailed {
+				item.Error = e.Err.Error()
+			}
+		})
+	case BatchFinished:
+		// 全部完成后不再需要继续下载；有失败的文件时保留队列，之后可继续或重试
+		if q.Unfinished() == 0 {
+			if err := DiscardQueue(); err != nil {
+				slog.Warn(fmt.Sprintf("删除下载队列出错：%v", err))
+			}
+		}
+	}
+}
+
+func (q *Queue) update(index int, fn func(item *QueueItem)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if index < 0 || index >= len(q.Items) {
+		return
+	}
+	fn(&q.Items[index])
+	q.Items[index].UpdatedAt = time.Now()
+	q.saveLocked()
+}
+
+func (q *Queue) save() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.saveLocked()
+}
+
+// saveLocked 先写入临时文件再替换，避免中断时损坏；保存失败不影响下载
+func (q *Queue) saveLocked() {
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		slog.Warn(fmt.Sprintf("保存下载队列出错：%v", err))
+		return
+	}
+	data, err := json.Marshal(q)
+	if err == nil {
+		tmpPath := q.path + ".tmp"
+		if err = os.WriteFile(tmpPath, data, 0644); err == nil {
+			err = os.Rename(tmpPath, q.path)
+		}
+	}
+	if err != nil {
+		slog.Warn(fmt.Sprintf("保存下载队列出错：%v", err))
+	}
+}
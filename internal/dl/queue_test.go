@@ -0,0 +1,79 @@
+package dl
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestQueueKeepsFailedItems(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	links := []LinkData{{Title: "a"}, {Title: "b"}, {Title: "c"}}
+	q := NewQueue(t.TempDir(), links, DownloadOptions{})
+	for i, status := range []JobStatus{JobSucceeded, JobFailed, JobFailed} {
+		q.OnEvent(JobStarted{Index: i, Link: links[i]})
+		q.OnEvent(JobFinished{Index: i, Link: links[i], Status: status, Err: errors.New("状态异常: 404")})
+	}
+	q.OnEvent(BatchFinished{})
+	if _, err := os.Stat(QueuePath()); err != nil {
+		t.Fatalf("queue with failed items should be kept: %v", err)
+	}
+
+	saved, err := LoadQueue()
+	if err != nil || saved == nil {
+		t.Fatalf("LoadQueue = %v, %v", saved, err)
+	}
+	if saved.Unfinished() != 2 {
+		t.Fatalf("Unfinished = %d, want 2", saved.Unfinished())
+	}
+	remaining := saved.Remaining()
+	if len(remaining.Items) != 2 {
+		t.Fatalf("got %d remaining items, want 2", len(remaining.Items))
+	}
+	for _, item := range remaining.Items {
+		if item.State != QueueQueued || item.Attempts != 1 || item.Error == "" {
+			t.Fatalf("remaining item = %+v, want queued with 1 attempt and last error", item)
+		}
+	}
+
+	// 重试后全部成功时删除队列
+	for i := range remaining.Items {
+		remaining.OnEvent(JobStarted{Index: i})
+		remaining.OnEvent(JobFinished{Index: i, Status: JobSucceeded})
+	}
+	if remaining.Items[0].Attempts != 2 {
+		t.Fatalf("attempts = %d, want 2", remaining.Items[0].Attempts)
+	}
+	remaining.OnEvent(BatchFinished{})
+	if _, err := os.Stat(QueuePath()); !os.IsNotExist(err) {
+		t.Fatalf("finished queue should be discarded: %v", err)
+	}
+}
+
+func TestQueueOptionsQuality(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	for _, value := range []string{"highest", "lowest", "720p", "2m", "1.5m", "800k", "码率≤1Mbps"} {
+		quality, err := ParseQualityPolicy(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		NewQueue(t.TempDir(), []LinkData{{Title: "a"}}, DownloadOptions{Quality: quality})
+		data, err := os.ReadFile(QueuePath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), `"Mode"`) {
+			t.Fatalf("quality should be saved as a string: %s", data)
+		}
+		saved, err := LoadQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := saved.Options.DownloadOptions(nil).Quality; got != quality {
+			t.Errorf("%s: restored quality = %+v, want %+v", value, got, quality)
+		}
+	}
+}
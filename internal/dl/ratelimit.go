@@ -0,0 +1,290 @@
+package dl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 限速时单次读取的上限，避免一次占用过多令牌
+const rateLimitChunk = 32 * 1024
+
+// rateLimiter 令牌桶限速，所有文件下载和视频分段共用；rate 为 0 表示不限速
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // 字节/秒
+	tokens float64 // 可以为负，表示已预支的字节数
+	last   time.Time
+}
+
+// burst 桶容量：0.25 秒的流量
+func (l *rateLimiter) burst() float64 {
+	return max(l.rate/4, rateLimitChunk)
+}
+
+func (l *rateLimiter) setRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = float64(max(bytesPerSec, 0))
+	l.tokens = min(l.tokens, l.burst())
+	l.last = time.Now()
+}
+
+func (l *rateLimiter) getRate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+func (l *rateLimiter) limited() bool {
+	return l.getRate() > 0
+}
+
+// wait 消耗 n 个令牌，不足时等待
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst())
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hostLimiter 限制每个服务器同时进行的请求数；limit 为 0 表示不限制
+type hostLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	active  map[string]int
+	changed chan struct{} // 有请求结束或上限变化时关闭并替换
+}
+
+func newHostLimiter() *hostLimiter {
+	return &hostLimiter{active: make(map[string]int), changed: make(chan struct{})}
+}
+
+func (l *hostLimiter) notifyLocked() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+func (l *hostLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = max(limit, 0)
+	l.notifyLocked()
+}
+
+func (l *hostLimiter) getLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *hostLimiter) acquire(ctx context.Context, host string) error {
+	for {
+		l.mu.Lock()
+		if l.limit <= 0 || l.active[host] < l.limit {
+			l.active[host]++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *hostLimiter) release(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[host]--; l.active[host] <= 0 {
+		delete(l.active, host)
+	}
+	l.notifyLocked()
+}
+
+var (
+	downloadRate  = &rateLimiter{}
+	hostSemaphore = newHostLimiter()
+)
+
+// SetRateLimit 设置全局下载限速（字节/秒，0 不限速），下载过程中修改立即生效
+func SetRateLimit(bytesPerSec int64) {
+	downloadRate.setRate(bytesPerSec)
+}
+
+func RateLimit() int64 {
+	return downloadRate.getRate()
+}
+
+// SetHostConcurrency 设置每个服务器的最大并发请求数（0 不限制），下载过程中修改立即生效
+func SetHostConcurrency(limit int) {
+	hostSemaphore.setLimit(limit)
+}
+
+func HostConcurrency() int {
+	return hostSemaphore.getLimit()
+}
+
+// limitedTransport 请求前按服务器排队，读取响应时限速，响应关闭后释放；
+// 取得服务器名额后才开始计算超时，读取响应时超过 readIdleTimeout 没有数据则中断请求
+type limitedTransport struct {
+	base http.RoundTripper
+}
+
+// idleTimeoutError 读取空闲超时，作为网络超时错误可重试、续传
+type idleTimeoutError struct{}
+
+func (idleTimeoutError) Error() string {
+	return fmt.Sprintf("读取超时：%v 内没有收到数据", readIdleTimeout)
+}
+func (idleTimeoutError) Timeout() bool   { return true }
+func (idleTimeoutError) Temporary() bool { return true }
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if err := hostSemaphore.acquire(req.Context(), host); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancelCause(req.Context())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel(nil)
+		hostSemaphore.release(host)
+		return nil, err
+	}
+	body := &limitedBody{
+		ReadCloser: resp.Body,
+		ctx:        ctx,
+		release: sync.OnceFunc(func() {
+			cancel(nil)
+			hostSemaphore.release(host)
+		}),
+	}
+	body.idle = time.AfterFunc(readIdleTimeout, func() { cancel(idleTimeoutError{}) })
+	resp.Body = body
+	return resp, nil
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	idle    *time.Timer // 读取空闲计时，等待限速时暂停
+	release func()
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if downloadRate.limited() && len(p) > rateLimitChunk {
+		p = p[:rateLimitChunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && errors.Is(context.Cause(b.ctx), idleTimeoutError{}) {
+		err = idleTimeoutError{}
+	}
+	if n > 0 {
+		b.idle.Stop()
+		if waitErr := downloadRate.wait(b.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+		b.idle.Reset(readIdleTimeout)
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	defer b.release()
+	b.idle.Stop()
+	return b.ReadCloser.Close()
+}
+
+type RateData struct {
+	Name  string
+	Value string
+}
+
+var RATE_LIMIT_LIST = []RateData{
+	{"不限速", "0"},
+	{"512KB/s", "512k"},
+	{"1MB/s", "1m"},
+	{"2MB/s", "2m"},
+	{"5MB/s", "5m"},
+	{"10MB/s", "10m"},
+}
+
+var HOST_CONCURRENCY_LIST = []int{0, 2, 4, 8, 16}
+
+// ParseRate 解析限速：字节/秒，支持 k、m、g 后缀（1024进制），可带 b、/s，如 512k、2MB/s；0 或空为不限速
+func ParseRate(value string) (int64, error) {
+	for _, item := range RATE_LIMIT_LIST {
+		if item.Name == value {
+			value = item.Value
+			break
+		}
+	}
+	v := strings.ToLower(strings.TrimSpace(value))
+	v = strings.TrimSuffix(v, "/s")
+	v = strings.TrimSuffix(v, "b")
+	if v == "" {
+		return 0, nil
+	}
+
+	unit := float64(1)
+	switch v[len(v)-1] {
+	case 'k':
+		unit = 1024
+	case 'm':
+		unit = 1024 * 1024
+	case 'g':
+		unit = 1024 * 1024 * 1024
+	}
+	if unit > 1 {
+		v = v[:len(v)-1]
+	}
+	rate, err := strconv.ParseFloat(v, 64)
+	if err != nil || rate < 0 {
+		return 0, fmt.Errorf("invalid rate limit: %s", value)
+	}
+	return int64(rate * unit), nil
+}
+
+// FormatRate 限速文本
+func FormatRate(bytesPerSec int64) string {
+	switch {
+	case bytesPerSec <= 0:
+		return "不限速"
+	case bytesPerSec >= 1024*1024:
+		return fmt.Sprintf("%.1fMB/s", float64(bytesPerSec)/1024/1024)
+	}
+	return fmt.Sprintf("%.0fKB/s", float64(bytesPerSec)/1024)
+}
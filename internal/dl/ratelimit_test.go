@@ -0,0 +1,96 @@
+package dl
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// setReadIdleTimeout 测试中缩短读取空闲超时
+func setReadIdleTimeout(t *testing.T, d time.Duration) {
+	old := readIdleTimeout
+	readIdleTimeout = d
+	t.Cleanup(func() { readIdleTimeout = old })
+}
+
+// slowServer 每隔 interval 发送一块数据，共 chunks 块
+func slowServer(chunks int, interval time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for range chunks {
+			w.Write(make([]byte, 1024))
+			w.(http.Flusher).Flush()
+			time.Sleep(interval)
+		}
+	}))
+}
+
+func TestSlowTransferLongerThanIdleTimeout(t *testing.T) {
+	setReadIdleTimeout(t, 200*time.Millisecond)
+	srv := slowServer(10, 50*time.Millisecond) // 共约 500ms，超过空闲超时但一直有数据
+	defer srv.Close()
+
+	resp, err := defaultHTTPClient.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(data) != 10*1024 {
+		t.Fatalf("got %d bytes", len(data))
+	}
+}
+
+func TestRateLimitedTransferLongerThanIdleTimeout(t *testing.T) {
+	setReadIdleTimeout(t, 200*time.Millisecond)
+	SetRateLimit(64 * 1024)
+	defer SetRateLimit(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 48*1024)) // 限速下约 0.5 秒
+	}))
+	defer srv.Close()
+
+	resp, err := defaultHTTPClient.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+}
+
+func TestStalledTransferTimesOut(t *testing.T) {
+	setReadIdleTimeout(t, 100*time.Millisecond)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1024))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	resp, err := defaultHTTPClient.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("err = %v, want timeout", err)
+	}
+	if !isNetworkError(err) {
+		t.Fatalf("idle timeout should be retryable: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package dl
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReportRecord 下载报告中的一个文件，JSON Lines 和 CSV 使用相同字段
+type ReportRecord struct {
+	RunID      string    `json:"run_id"`
+	RunStarted time.Time `json:"run_started"`
+	Index      int       `json:"index"`
+	Title      string    `json:"title"`
+	Format     string    `json:"format"`
+	Folder     string    `json:"folder"`
+	Status     JobStatus `json:"status"`
+	StatusCode int       `json:"status_code"`
+	Size       int64     `json:"size"`  // 解析得到的文件大小，-1 表示未知
+	MD5        string    `json:"md5"`   // 保存文件的 MD5，可与资源信息中的 MD5 对照
+	Bytes      int64     `json:"bytes"` // 本次下载的字节数
+	Started    time.Time `json:"started"`
+	Ended      time.Time `json:"ended"`
+	DurationMS int64     `json:"duration_ms"`
+	URL        string    `json:"url"` // 最终使用的下载链接
+	RawURL     string    `json:"raw_url"`
+	BackupURL  string    `json:"backup_url"`
+	Path       string    `json:"path"`
+	SHA256     string    `json:"sha256"`
+	Error      string    `json:"error"`
+}
+
+var reportCSVHeader = []string{
+	"run_id", "run_started", "index", "title", "format", "folder", "status", "status_code",
+	"size", "md5", "bytes", "started", "ended", "duration_ms", "url", "raw_url", "backup_url",
+	"path", "sha256", "error",
+}
+
+func (r ReportRecord) csvRow() []string {
+	return []string{
+		r.RunID, r.RunStarted.Format(time.RFC3339), strconv.Itoa(r.Index), r.Title, r.Format, r.Folder,
+		string(r.Status), strconv.Itoa(r.StatusCode), strconv.FormatInt(r.Size, 10), r.MD5, strconv.FormatInt(r.Bytes, 10),
+		formatReportTime(r.Started), formatReportTime(r.Ended), strconv.FormatInt(r.DurationMS, 10),
+		r.URL, r.RawURL, r.BackupURL, r.Path, r.SHA256, r.Error,
+	}
+}
+
+func formatReportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// newRunID 本次下载的标识：开始时间 + 随机后缀
+func newRunID(started time.Time) string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return started.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// reportWriter 订阅下载事件，每个文件结束时追加到下载目录中的 JSONL 和 CSV 报告
+type reportWriter struct {
+	dir     string
+	runID   string
+	started time.Time
+
+	mu        sync.Mutex
+	jobStarts map[int]time.Time
+}
+
+func newReportWriter(dir string) *reportWriter {
+	started := time.Now()
+	return &reportWriter{
+		dir:       dir,
+		runID:     newRunID(started),
+		started:   started,
+		jobStarts: make(map[int]time.Time),
+	}
+}
+
+func (w *reportWriter) OnEvent(e Event) {
+	switch e := e.(type) {
+	case JobStarted:
+		w.mu.Lock()
+		w.jobStarts[e.Index] = time.Now()
+		w.mu.Unlock()
+	case JobFinished:
+		w.write(w.record(e))
+	}
+}
+
+func (w *reportWriter) record(e JobFinished) ReportRecord {
+	ended := time.Now()
+	w.mu.Lock()
+	started := w.jobStarts[e.Index]
+	delete(w.jobStarts, e.Index)
+	w.mu.Unlock()
+
+	record := ReportRecord{
+		RunID:      w.runID,
+		RunStarted: w.started,
+		Index:      e.Index,
+		Title:      e.Link.Title,
+		Format:     e.Link.Format,
+		Folder:     e.Link.Folder,
+		Status:     e.Status,
+		StatusCode: e.StatusCode,
+		Size:       e.Link.Size,
+		Bytes:      e.Bytes,
+		Started:    started,
+		Ended:      ended,
+		URL:        e.URL,
+		RawURL:     e.Link.RawURL,
+		BackupURL:  e.Link.BackupURL,
+		Path:       e.Path,
+	}
+	if !started.IsZero() {
+		record.DurationMS = ended.Sub(started).Milliseconds()
+	}
+	if e.Err != nil {
+		record.Error = e.Err.Error()
+	}
+	if e.Digest.SHA256 != "" {
+		record.SHA256, record.MD5 = e.Digest.SHA256, e.Digest.MD5
+	} else if e.Path != "" && e.Status == JobSkipped {
+		// 跳过的文件未计算摘要
+		if digest, _, err := hashFile(e.Path); err == nil {
+			record.SHA256, record.MD5 = digest.SHA256, digest.MD5
+		} else {
+			slog.Debug("failed to hash file", "path", e.Path, "err", err)
+		}
+	}
+	return record
+}
+
+// write 追加一条记录，写入失败只记录日志
+func (w *reportWriter) write(record ReportRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := appendJSONL(filepath.Join(w.dir, REPORT_JSONL_FILE), record); err != nil {
+		slog.Error(fmt.Sprintf("Error writing report: %v", err))
+	}
+	if err := appendCSV(filepath.Join(w.dir, REPORT_CSV_FILE), record); err != nil {
+		slog.Error(fmt.Sprintf("Error writing report: %v", err))
+	}
+}
+
+func appendJSONL(path string, record ReportRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// appendCSV 追加一行（RFC 4180），新文件先写表头
+func appendCSV(path string, record ReportRecord) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	writer.UseCRLF = true
+	if info.Size() == 0 {
+		// UTF-8 BOM，便于 Excel 识别中文
+		if _, err := file.WriteString("\uFEFF"); err != nil {
+			return err
+		}
+		if err := writer.Write(reportCSVHeader); err != nil {
+			return err
+		}
+	}
+	if err := writer.Write(record.csvRow()); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// saveSummary 在日志文件中追加便于阅读的下载统计，详细记录见报告文件
+func (w *reportWriter) saveSummary(result DownloadResult) {
+	now := time.Now().Format("2006-01-02 15:04:05 MST")
+	lines := []string{
+		"",
+		"===============================================================",
+		fmt.Sprintf("## %s 下载统计：成功/失败 = %d/%d", now, result.Success, result.Failed),
+		"---------------------------------------------------------------",
+		fmt.Sprintf("运行ID：%s（开始于 %s，用时 %s）", w.runID,
+			w.started.Format("2006-01-02 15:04:05 MST"), time.Since(w.started).Round(time.Second)),
+		result.Summary(),
+		fmt.Sprintf("详细记录：%s、%s", REPORT_JSONL_FILE, REPORT_CSV_FILE),
+		"",
+	}
+	savePath := filepath.Join(w.dir, LOG_FILE)
+	slog.Info(fmt.Sprintf("Save log to %s", savePath))
+
+	file, err := os.OpenFile(savePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error opening file: %v", err))
+		return
+	}
+	defer file.Close()
+	if _, err := file.WriteString(strings.Join(lines, "\n")); err != nil {
+		slog.Error(fmt.Sprintf("Error writing file: %v", err))
+	}
+}
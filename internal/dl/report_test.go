@@ -0,0 +1,134 @@
+package dl
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReportCSVColumns(t *testing.T) {
+	wantHeader := []string{
+		"run_id", "run_started", "index", "title", "format", "folder", "status", "status_code",
+		"size", "md5", "bytes", "started", "ended", "duration_ms", "url", "raw_url", "backup_url",
+		"path", "sha256", "error",
+	}
+	dir := t.TempDir()
+	w := newReportWriter(dir)
+	link := LinkData{Title: "书", Format: "pdf", Size: 5}
+	w.OnEvent(JobStarted{Index: 0, Link: link})
+	w.OnEvent(JobFinished{
+		Index:  0,
+		Link:   link,
+		Status: JobFailed,
+		Digest: FileDigest{SHA256: "sha", MD5: "md5sum"},
+		Err:    errors.New("状态异常: 404, 含逗号"),
+	})
+
+	f, err := os.Open(filepath.Join(dir, REPORT_CSV_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want header and 1 record", len(rows))
+	}
+	header := slices.Clone(rows[0])
+	header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	if !slices.Equal(header, wantHeader) {
+		t.Fatalf("header = %v, want %v", header, wantHeader)
+	}
+	record := make(map[string]string)
+	for i, name := range header {
+		record[name] = rows[1][i]
+	}
+	if record["size"] != "5" || record["md5"] != "md5sum" || record["sha256"] != "sha" || record["error"] != "状态异常: 404, 含逗号" {
+		t.Fatalf("record = %v", record)
+	}
+}
+
+// 复用 DownloadManager 再次下载（重试失败文件）时每个文件只写入一条报告
+func TestReportNotDuplicatedOnReuse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	links := []LinkData{{Format: "bin", Title: "a", BackupURL: srv.URL + "/a.bin", Size: 4}}
+	dm := NewDownloadManager(dir, links)
+	opts := DownloadOptions{EnableLog: true, Conflict: ConflictOverwrite}
+	for range 2 {
+		if result := dm.StartDownload(context.Background(), opts); result.Success != 1 {
+			t.Fatalf("result = %+v", result)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, REPORT_JSONL_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Fatalf("got %d report records, want 2", lines)
+	}
+}
+
+// 只有写入报告或元数据时才计算摘要，校验 MD5 时已计算的摘要直接使用
+func TestDigestOnlyWhenNeeded(t *testing.T) {
+	body := "%PDF-1.4\n1 0 obj\n<<>>\nendobj\nstartxref\n0\n%%EOF\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	want, _, err := hashFile(writeTemp(t, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		md5  string
+		opts DownloadOptions
+		want FileDigest
+	}{
+		{"no report", "", DownloadOptions{}, FileDigest{}},
+		{"report", "", DownloadOptions{EnableLog: true}, want},
+		{"md5 checked", want.MD5, DownloadOptions{}, want},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links := []LinkData{{Format: "pdf", Title: "a", BackupURL: srv.URL + "/a.pdf", MD5: tt.md5}}
+			dm := NewDownloadManager(t.TempDir(), links)
+			var got FileDigest
+			dm.Subscribe(ObserverFunc(func(e Event) {
+				if e, ok := e.(JobFinished); ok {
+					got = e.Digest
+				}
+			}))
+			if result := dm.StartDownload(context.Background(), tt.opts); result.Success != 1 {
+				t.Fatalf("result = %+v", result)
+			}
+			if got != tt.want {
+				t.Errorf("digest = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func writeTemp(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "a")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -6,6 +6,11 @@ import (
 
 const APP_DESC string = "本工具用于下载智慧教育平台中的教材等资源，支持批量下载PDF等资源。"
 const LOG_FILE string = "log-smartedudl.txt"
+const REPORT_JSONL_FILE string = "report-smartedudl.jsonl"
+const REPORT_CSV_FILE string = "report-smartedudl.csv"
+const INDEX_FILE string = "index-smartedudl.json"
+const MERGED_FILE string = "merged-smartedudl.json"
+const QUARANTINE_DIR string = "quarantine-smartedudl"
 const APP_NAME string = "cn.smartedu"
 
 // 配置数据
@@ -18,6 +23,9 @@ var SERVER_LIST = []string{
 	"s-file-3",
 }
 
+// CDN服务器域名后缀，如 s-file-1.ykt.cbern.com.cn
+var CDN_DOMAIN = ".ykt.cbern.com.cn"
+
 // var PAPER_SERVER = "https://bdcs-file-2.ykt.cbern.com.cn"
 var BDCS_SERVER_LIST = []string{
 	"bdcs-file-1",
@@ -270,7 +278,26 @@ type LinkData struct {
 	ID        string
 	RawURL    string
 	BackupURL string
-	Size      int64
+	URLs      []string          // 全部候选下载链接（各镜像及转换后的链接），下载失败时依次尝试
+	Variants  []VideoVariant    // 视频的多种清晰度，下载时按清晰度策略选择
+	Size      int64             // 解析得到的文件大小，-1 表示未知
+	MD5       string            // 资源JSON中的 MD5，为空表示未提供
+	Tags      map[string]string // 目录分类：维度ID（如 zxxxk）→ 名称（如 语文），用于保存路径模板
+	Meta      ResourceMeta      // 解析时保留的资源信息，用于元数据文件
+}
+
+// ResourceMeta 资源JSON中除下载链接外的信息
+type ResourceMeta struct {
+	SourceURL    string   `json:"source_url,omitempty"` // 输入的资源页面链接
+	ResourceType string   `json:"resource_type,omitempty"`
+	Teachers     []string `json:"teachers,omitempty"`
+	School       string   `json:"school,omitempty"`
+	BookID       string   `json:"book_id,omitempty"` // teachingmaterial_info
+	BookTitle    string   `json:"book_title,omitempty"`
+	CourseID     string   `json:"course_id,omitempty"` // 课程包（一节课）
+	CourseTitle  string   `json:"course_title,omitempty"`
+	Order        int      `json:"order,omitempty"` // 在课程包中的顺序
+	TagList      []DocTag `json:"tag_list,omitempty"`
 }
 
 type FormatData struct {
@@ -340,6 +367,7 @@ type ResourceItem struct {
 	Title            string   `json:"title"`
 	ResourceType     string   `json:"resource_type_code_name"`
 	ContainerID      string   `json:"container_id"`
+	TagList          []DocTag `json:"tag_list"`
 	CustomProperties struct {
 		OriginalTitle string `json:"original_title"`
 		AliasName     string `json:"alias_name"`
@@ -360,6 +388,7 @@ type TiItem struct {
 	TiFormat         string   `json:"ti_format"`
 	LcTiFormat       string   `json:"lc_ti_format"`
 	TiSize           int64    `json:"ti_size"`
+	TiMD5            string   `json:"ti_md5"`
 	TiFileFlag       string   `json:"ti_file_flag"`
 	TiIsSourceFile   bool     `json:"ti_is_source_file"`
 	CustomProperties struct {
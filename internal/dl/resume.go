@@ -0,0 +1,246 @@
+package dl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const partSuffix = ".part"
+
+// partMeta 未完成下载（.part 文件）的附加信息，用于断点续传
+type partMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Size         int64  `json:"size"` // 完整文件大小，-1 表示未知
+	ContentType  string `json:"content_type,omitempty"`
+}
+
+func partMetaPath(partPath string) string {
+	return partPath + ".json"
+}
+
+func loadPartMeta(partPath string) (partMeta, bool) {
+	var meta partMeta
+	data, err := os.ReadFile(partMetaPath(partPath))
+	if err != nil {
+		return meta, false
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, false
+	}
+	return meta, true
+}
+
+func savePartMeta(partPath string, meta partMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partMetaPath(partPath), data, 0644)
+}
+
+// removePart 删除 .part 文件及其附加信息
+func removePart(partPath string) {
+	for _, p := range []string{partPath, partMetaPath(partPath)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn(fmt.Sprintf("删除临时文件 %s 出错：%v", p, err))
+		}
+	}
+}
+
+// sameResource 判断两个链接是否指向同一资源（忽略CDN域名）
+func sameResource(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ua, err1 := url.Parse(a)
+	ub, err2 := url.Parse(b)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return ua.Path == ub.Path
+}
+
+// parseContentRange 解析 "bytes start-end/total"，total 未知时返回 -1
+func parseContentRange(value string) (start int64, total int64, ok bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, false
+	}
+	rangePart, totalPart, found := strings.Cut(strings.TrimPrefix(value, "bytes "), "/")
+	if !found {
+		return 0, 0, false
+	}
+	startPart, _, found := strings.Cut(rangePart, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	total = -1
+	if totalPart != "*" {
+		if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, total, true
+}
+
+// partCounter 记录 .part 文件中已计入进度的字节数，续传、重试或重新下载时只累计差值
+type partCounter struct {
+	counter ProgressCounter
+	counted int64
+}
+
+func newPartCounter(counter ProgressCounter) *partCounter {
+	return &partCounter{counter: counter}
+}
+
+func (c *partCounter) set(size int64) {
+	if delta := size - c.counted; delta != 0 {
+		c.counter.AddBytes(delta)
+		c.counted = size
+	}
+}
+
+func (c *partCounter) add(n int64) {
+	c.counter.AddBytes(n)
+	c.counted += n
+}
+
+// fetchToPart 下载到 partPath，若已有同一资源的 .part 文件则通过 Range 请求续传。
+// 下载完成且大小校验通过后返回，调用方负责重命名为最终文件。
+func fetchToPart(ctx context.Context, link, partPath string, headers map[string]string, progress *partCounter) (int, error) {
+	var offset int64
+	meta, hasMeta := loadPartMeta(partPath)
+	if info, err := os.Stat(partPath); err == nil && hasMeta && sameResource(meta.URL, link) {
+		offset = info.Size()
+	} else {
+		meta = partMeta{URL: link, Size: -1}
+	}
+
+	if offset > 0 && meta.Size > 0 && offset == meta.Size {
+		slog.Debug(fmt.Sprintf("%s 已下载完成", partPath))
+		progress.set(offset)
+		return http.StatusOK, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return -1, fmt.Errorf("创建下载请求出错: %w", err)
+	}
+	for k, v := range headers {
+		if v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		// 资源变化时服务器返回完整内容
+		if meta.ETag != "" {
+			req.Header.Set("If-Range", meta.ETag)
+		} else if meta.LastModified != "" {
+			req.Header.Set("If-Range", meta.LastModified)
+		}
+	}
+
+	resp, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+	statusCode := resp.StatusCode
+
+	flag := os.O_WRONLY | os.O_CREATE
+	switch statusCode {
+	case http.StatusPartialContent:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			removePart(partPath)
+			return statusCode, fmt.Errorf("续传范围异常: %q", resp.Header.Get("Content-Range"))
+		}
+		if total > 0 {
+			meta.Size = total
+		}
+		flag |= os.O_APPEND
+		slog.Info(fmt.Sprintf("断点续传 %s，从 %d 字节开始", partPath, offset))
+	case http.StatusOK:
+		// 不支持 Range 或资源已变化，从头下载
+		offset = 0
+		meta = partMeta{
+			URL:          link,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Size:         resp.ContentLength,
+			ContentType:  resp.Header.Get("Content-Type"),
+		}
+		flag |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// "bytes */total" 且与已下载大小一致时视为已完成
+		contentRange := resp.Header.Get("Content-Range")
+		if _, totalPart, found := strings.Cut(contentRange, "/"); found && totalPart == strconv.FormatInt(offset, 10) {
+			progress.set(offset)
+			return http.StatusOK, nil
+		}
+		removePart(partPath)
+		progress.set(0)
+		return statusCode, fmt.Errorf("续传失败，已删除临时文件: %w", newStatusError(resp))
+	default:
+		return statusCode, newStatusError(resp)
+	}
+
+	if err := savePartMeta(partPath, meta); err != nil {
+		return statusCode, fmt.Errorf("保存下载信息出错：%w", err)
+	}
+	out, err := os.OpenFile(partPath, flag, 0644)
+	if err != nil {
+		return statusCode, fmt.Errorf("创建文件 %s 出错：%w", partPath, err)
+	}
+	defer out.Close()
+	progress.set(offset)
+
+	buffer := make([]byte, 32*1024) // 32KB大小
+	written := offset
+	for {
+		n, err := resp.Body.Read(buffer)
+		if n > 0 {
+			if _, err := out.Write(buffer[:n]); err != nil {
+				return statusCode, fmt.Errorf("写入文件出错：%w", err)
+			}
+			written += int64(n)
+			progress.add(int64(n))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return statusCode, fmt.Errorf("读取出错（已下载 %d 字节，可续传）：%w", written, err)
+		}
+	}
+
+	if meta.Size > 0 && written != meta.Size {
+		return statusCode, fmt.Errorf("文件不完整：%d/%d 字节", written, meta.Size)
+	}
+	return statusCode, nil
+}
+
+// finishPart 将下载完成的 .part 文件移动到 outputPath
+func finishPart(partPath, outputPath string) error {
+	if err := os.Rename(partPath, outputPath); err != nil {
+		return err
+	}
+	removePart(partPath)
+	return nil
+}
@@ -0,0 +1,165 @@
+package dl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy 请求重试策略：指数退避 + 随机抖动
+type RetryPolicy struct {
+	MaxAttempts int           // 最多尝试次数（含第一次）
+	BaseDelay   time.Duration // 首次重试等待时间，之后每次翻倍
+	MaxDelay    time.Duration // 单次等待上限
+	Jitter      float64       // 等待时间随机浮动比例 0~1
+	RetryStatus []int         // 可重试的HTTP状态码
+}
+
+// defaultRetryPolicy 文件下载、JSON数据和视频密钥请求共用的默认重试策略，
+// 每批下载按 DownloadOptions.Retries 复制一份，不直接修改
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+	Jitter:      0.2,
+	RetryStatus: []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// withAttempts 复制策略并设置最多尝试次数，n < 1 时保持不变
+func (p RetryPolicy) withAttempts(n int) RetryPolicy {
+	p.RetryStatus = slices.Clone(p.RetryStatus)
+	if n >= 1 {
+		p.MaxAttempts = n
+	}
+	return p
+}
+
+type retryPolicyKey struct{}
+
+// withRetryPolicy 随 ctx 传递本批下载的重试策略
+func withRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// WithRetries 返回带重试次数（含第一次，n < 1 时使用默认值）的 ctx，用于解析资源等下载前的请求
+func WithRetries(ctx context.Context, n int) context.Context {
+	return withRetryPolicy(ctx, defaultRetryPolicy.withAttempts(n))
+}
+
+// retryPolicyFrom ctx 中的重试策略，没有时使用默认策略
+func retryPolicyFrom(ctx context.Context) RetryPolicy {
+	if policy, ok := ctx.Value(retryPolicyKey{}).(RetryPolicy); ok {
+		return policy
+	}
+	return defaultRetryPolicy
+}
+
+// Retry-After 等待上限，避免服务器返回过长时间
+const maxRetryAfter = 2 * time.Minute
+
+// HTTPStatusError 响应状态码异常
+type HTTPStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("状态异常: %d", e.StatusCode)
+}
+
+// newStatusError 根据响应生成错误，解析 Retry-After（秒数或HTTP日期）
+func newStatusError(resp *http.Response) *HTTPStatusError {
+	statusErr := &HTTPStatusError{StatusCode: resp.StatusCode}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return statusErr
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		statusErr.RetryAfter = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		statusErr.RetryAfter = max(time.Until(t), 0)
+	}
+	return statusErr
+}
+
+// Retryable 判断错误是否可重试：网络错误或指定状态码
+func (p RetryPolicy) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return slices.Contains(p.RetryStatus, statusErr.StatusCode)
+	}
+	return isNetworkError(err)
+}
+
+// Backoff 第 attempt 次重试（从0开始）前的等待时间
+func (p RetryPolicy) Backoff(attempt int, err error) time.Duration {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return min(statusErr.RetryAfter, maxRetryAfter)
+	}
+
+	delay := p.BaseDelay << uint(attempt)
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delta := float64(delay) * p.Jitter
+		delay += time.Duration(delta * (2*rand.Float64() - 1))
+	}
+	return max(delay, 0)
+}
+
+// withRetry 按重试策略执行 fn，每次重试前调用 onRetry（可为 nil）；ctx 取消时立即返回
+func withRetry(ctx context.Context, policy RetryPolicy, name string, onRetry func(err error), fn func() error) error {
+	attempts := max(policy.MaxAttempts, 1)
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		err = fn()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil || !policy.Retryable(err) {
+			return err
+		}
+		if attempt == attempts-1 {
+			break
+		}
+
+		backoff := policy.Backoff(attempt, err)
+		slog.Debug("request failed, retrying",
+			"name", name,
+			"attempt", attempt+1,
+			"backoff", backoff.String(),
+			"err", err)
+		if onRetry != nil {
+			onRetry(err)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	if attempts > 1 {
+		return fmt.Errorf("重试%d次后失败: %w", attempts-1, err)
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package dl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsNetworkErrorWrapped(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("读取出错（已下载 100 字节，可续传）：%w", idleTimeoutError{}), true},
+		{fmt.Errorf("读取出错：%w", io.ErrUnexpectedEOF), true},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), true}, // DeadlineExceeded 实现 net.Error，Timeout 为 true
+		{&HTTPStatusError{StatusCode: http.StatusNotFound}, false},
+		{fmt.Errorf("写入文件出错：%w", os.ErrPermission), false},
+	}
+	for _, tt := range tests {
+		if got := isNetworkError(tt.err); got != tt.want {
+			t.Errorf("isNetworkError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestIsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	timeout := fmt.Errorf("request: %w", context.DeadlineExceeded)
+	if isCanceled(ctx, timeout) {
+		t.Error("request timeout with live ctx should not count as canceled")
+	}
+	cancel()
+	if !isCanceled(ctx, fmt.Errorf("read: %w", context.Canceled)) {
+		t.Error("error after ctx canceled should count as canceled")
+	}
+}
+
+// 第一次请求发送一半后停止发送，空闲超时后重试并续传完成
+func TestStalledDownloadResumes(t *testing.T) {
+	setReadIdleTimeout(t, 100*time.Millisecond)
+	body := strings.Repeat("0123456789", 10000)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write([]byte(body[:len(body)/2]))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "a.bin", time.Time{}, strings.NewReader(body))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	links := []LinkData{{Format: "bin", Title: "a", RawURL: srv.URL + "/a.bin", BackupURL: srv.URL + "/a.bin", Size: int64(len(body))}}
+	dm := NewDownloadManager(dir, links)
+	var savedPath string
+	dm.Subscribe(ObserverFunc(func(e Event) {
+		if e, ok := e.(JobFinished); ok {
+			savedPath = e.Path
+		}
+	}))
+	result := dm.StartDownload(context.Background(), DownloadOptions{MaxConcurrency: 1})
+	if result.Success != 1 || result.Retries == 0 {
+		t.Fatalf("result = %+v, want 1 success after retry", result)
+	}
+	data, err := os.ReadFile(savedPath)
+	if err != nil || string(data) != body {
+		t.Fatalf("saved file mismatch: %d bytes, err %v", len(data), err)
+	}
+}
+
+func TestRetryPolicyFromOptions(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	old := defaultRetryPolicy
+	defer func() { defaultRetryPolicy = old }()
+	defaultRetryPolicy.BaseDelay = time.Millisecond
+	defaultRetryPolicy.MaxDelay = time.Millisecond
+
+	links := []LinkData{{Format: "pdf", Title: "a", BackupURL: srv.URL + "/a.pdf"}}
+	result := NewDownloadManager(t.TempDir(), links).StartDownload(context.Background(), DownloadOptions{Retries: 2})
+	if result.Failed != 1 || requests.Load() != 2 {
+		t.Fatalf("result = %+v, requests = %d, want 2 attempts", result, requests.Load())
+	}
+	if defaultRetryPolicy.MaxAttempts != old.MaxAttempts {
+		t.Fatalf("default policy modified: %d", defaultRetryPolicy.MaxAttempts)
+	}
+}
+
+// 解析资源的请求使用 ctx 中的重试策略，ctx 取消时不再请求
+func TestExtractResourcesRetryPolicy(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	old := defaultRetryPolicy
+	defer func() { defaultRetryPolicy = old }()
+	defaultRetryPolicy.BaseDelay = time.Millisecond
+	defaultRetryPolicy.MaxDelay = time.Millisecond
+
+	links := []string{srv.URL + "/a.json"}
+	ExtractResources(WithRetries(context.Background(), 2), links, []string{"pdf"}, false, false, false)
+	if requests.Load() != 2 {
+		t.Fatalf("requests = %d, want 2 attempts", requests.Load())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	requests.Store(0)
+	if result := ExtractResources(ctx, links, []string{"pdf"}, false, false, false); len(result) != 0 || requests.Load() != 0 {
+		t.Fatalf("canceled ctx: %d resources, %d requests", len(result), requests.Load())
+	}
+}
@@ -0,0 +1,155 @@
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+const settingsFile = "settings.toml"
+
+// Settings 保存到用户配置目录的设置，图形界面和命令行共用；命令行参数优先于设置文件
+type Settings struct {
+	DownloadsDir   string         `toml:"downloads_dir"` // 空为用户下载目录
+	NameTemplate   string         `toml:"name_template"` // 保存路径模板，如 {stage}/{subject}/{title}.{ext}
+	Formats        []string       `toml:"formats"`       // 资源类型后缀，如 pdf、mp3
+	UseBackup      bool           `toml:"use_backup"`
+	EnableLog      bool           `toml:"enable_log"`
+	WriteMetadata  bool           `toml:"write_metadata"`
+	MergePDF       bool           `toml:"merge_pdf"`     // 合并同一本书的多个 PDF
+	RemoveMerged   bool           `toml:"remove_merged"` // 合并后删除原文件
+	MaxConcurrency int            `toml:"threads"`
+	Retries        int            `toml:"retries"`
+	Conflict       ConflictPolicy `toml:"conflict"`
+	Container      VideoContainer `toml:"container"`
+	Quality        string         `toml:"quality"`    // highest、lowest、720p、2m 等
+	RateLimit      string         `toml:"rate_limit"` // 如 2m，0 不限速
+	HostConns      int            `toml:"host_conns"` // 0 不限制
+	ThemeColor     string         `toml:"theme_color"`
+	Local          bool           `toml:"local"`
+	SaveData       bool           `toml:"save_data"`
+
+	path string
+}
+
+// DefaultSettings 默认设置，与命令行参数的默认值一致
+func DefaultSettings() *Settings {
+	var formats []string
+	for _, format := range FORMAT_LIST {
+		if format.Check {
+			formats = append(formats, format.Suffix)
+		}
+	}
+	return &Settings{
+		NameTemplate:   DefaultNameTemplate,
+		Formats:        formats,
+		MaxConcurrency: 10,
+		Retries:        defaultRetryPolicy.MaxAttempts,
+		Conflict:       ConflictRename,
+		Container:      ContainerMP4,
+		Quality:        string(QualityHighest),
+		RateLimit:      "0",
+		path:           SettingsPath(),
+	}
+}
+
+// SettingsPath 设置文件路径
+func SettingsPath() string {
+	root, err := os.UserConfigDir()
+	if err != nil {
+		root = os.TempDir()
+	}
+	return filepath.Join(root, APP_NAME, settingsFile)
+}
+
+// LoadSettings 读取设置文件，没有的项使用默认值；文件不存在时返回默认设置。
+// 文件有误时返回默认设置和错误。
+func LoadSettings() (*Settings, error) {
+	s := DefaultSettings()
+	if _, err := toml.DecodeFile(s.path, s); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return DefaultSettings(), fmt.Errorf("读取设置 %s 出错：%w", s.path, err)
+	}
+	if err := s.Validate(); err != nil {
+		return DefaultSettings(), fmt.Errorf("设置 %s 有误：%w", s.path, err)
+	}
+	return s, nil
+}
+
+// Validate 检查各项取值
+func (s *Settings) Validate() error {
+	if s.MaxConcurrency < 1 {
+		return fmt.Errorf("invalid threads: %d", s.MaxConcurrency)
+	}
+	if s.Retries < 1 {
+		return fmt.Errorf("invalid retries: %d", s.Retries)
+	}
+	if s.HostConns < 0 {
+		return fmt.Errorf("invalid host connections: %d", s.HostConns)
+	}
+	if _, err := ParseConflictPolicy(string(s.Conflict)); err != nil {
+		return err
+	}
+	if _, err := ParseVideoContainer(string(s.Container)); err != nil {
+		return err
+	}
+	if _, err := ParseQualityPolicy(s.Quality); err != nil {
+		return err
+	}
+	if _, err := ParseRate(s.RateLimit); err != nil {
+		return err
+	}
+	if _, err := ParseNameTemplate(s.NameTemplate); err != nil {
+		return err
+	}
+	return nil
+}
+
+// HasFormat 是否选择了该资源类型
+func (s *Settings) HasFormat(suffix string) bool {
+	for _, format := range s.Formats {
+		if format == suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFormat 选择或取消资源类型，保持 FORMAT_LIST 的顺序
+func (s *Settings) SetFormat(suffix string, checked bool) {
+	var formats []string
+	for _, format := range FORMAT_LIST {
+		if format.Suffix == suffix && checked || format.Suffix != suffix && s.HasFormat(format.Suffix) {
+			formats = append(formats, format.Suffix)
+		}
+	}
+	s.Formats = formats
+}
+
+// Save 先写入临时文件再替换
+func (s *Settings) Save() error {
+	if s.path == "" {
+		s.path = SettingsPath()
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := toml.NewEncoder(file).Encode(s); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
@@ -0,0 +1,119 @@
+package dl
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"mime"
+	"os"
+	"slices"
+	"strings"
+)
+
+// 读取文件头的字节数，用于判断实际格式
+const sniffLength = 512
+
+// 常见的通用类型，不能说明实际格式
+var genericContentTypes = []string{
+	"application/octet-stream",
+	"binary/octet-stream",
+	"application/x-download",
+	"application/force-download",
+	"text/html",
+	"text/xml",
+	"application/xml",
+}
+
+// contentTypeFormat 响应 Content-Type 对应的后缀，通用类型或未知类型为空
+func contentTypeFormat(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || slices.Contains(genericContentTypes, mediaType) {
+		return ""
+	}
+	return MIME_TO_FORMAT[mediaType]
+}
+
+// sniffFormat 按文件头判断格式，无法判断时为空
+func sniffFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return "pdf"
+	case bytes.HasPrefix(head, []byte{0xff, 0xd8, 0xff}):
+		return "jpg"
+	case bytes.HasPrefix(head, pngSignature):
+		return "png"
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return "gif"
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return "webp"
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return "ogg"
+	case bytes.HasPrefix(head, []byte("ID3")), len(head) >= 4 && validMPEGHeader(head[:4]):
+		return "mp3"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return "zip"
+	case len(head) > tsPacketSize && head[0] == tsSyncByte && head[tsPacketSize] == tsSyncByte:
+		return "ts"
+	}
+	return ""
+}
+
+// knownFormat 是否为资源类型列表或 MIME_TO_FORMAT 中的后缀
+func knownFormat(format string) bool {
+	for _, item := range FORMAT_LIST {
+		if item.Suffix == format {
+			return true
+		}
+	}
+	for _, value := range MIME_TO_FORMAT {
+		if value == format {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileFormat 比较解析得到的格式、响应类型和文件头，返回保存使用的后缀：
+// 文件头可以判断时以文件头为准（zip 可能是 superboard 等基于 zip 的格式，不覆盖已知格式），
+// 否则解析得到的格式未知（如没有后缀）时使用响应类型
+func reconcileFormat(declared string, contentType string, head []byte) string {
+	normalized := strings.ToLower(declared)
+	if normalized == "jpeg" {
+		normalized = "jpg"
+	}
+	sniffed := sniffFormat(head)
+	byType := contentTypeFormat(contentType)
+
+	format := normalized
+	switch {
+	case sniffed != "" && sniffed != normalized && !(sniffed == "zip" && knownFormat(normalized)):
+		format = sniffed
+	case sniffed == "" && byType != "" && !knownFormat(normalized):
+		format = byType
+	}
+	if format == normalized {
+		// 大小写或 jpeg/jpg 不同时保留原后缀
+		format = declared
+	}
+	if format != declared {
+		slog.Info(fmt.Sprintf("格式不一致：解析为 %q，响应类型 %q，文件头 %q，保存为 %q", declared, contentType, sniffed, format))
+	} else if byType != "" && byType != normalized {
+		slog.Debug("content type differs from format", "format", format, "content_type", contentType, "sniffed", sniffed)
+	}
+	return format
+}
+
+// detectFormat 按下载完成的 .part 文件修正后缀
+func detectFormat(partPath string, declared string) string {
+	meta, _ := loadPartMeta(partPath)
+	f, err := os.Open(partPath)
+	if err != nil {
+		return declared
+	}
+	defer f.Close()
+	head, err := readAtMost(f, 0, sniffLength)
+	if err != nil {
+		return declared
+	}
+	return reconcileFormat(declared, meta.ContentType, head)
+}
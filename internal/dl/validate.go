@@ -0,0 +1,259 @@
+package dl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errInvalidContent 下载内容与格式不符，如保存为 .pdf 的错误页面或不完整的文件
+var errInvalidContent = errors.New("文件内容无效")
+
+// contentValidator 检查文件内容，不符合格式时返回原因
+type contentValidator func(f io.ReaderAt, size int64) error
+
+var contentValidators = map[string]contentValidator{
+	"pdf":  validatePDF,
+	"mp3":  validateMP3,
+	"ogg":  validateOGG,
+	"jpg":  validateJPEG,
+	"jpeg": validateJPEG,
+	"png":  validatePNG,
+	"ts":   validateTS,
+}
+
+// validateContent 按资源类型检查文件内容，没有对应检查的类型直接通过
+func validateContent(path string, format string) error {
+	validate, ok := contentValidators[strings.ToLower(format)]
+	if !ok {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("%w：空文件", errInvalidContent)
+	}
+
+	head, err := readAtMost(f, 0, min(info.Size(), 512))
+	if err != nil {
+		return err
+	}
+	if looksLikeErrorPage(head) {
+		return fmt.Errorf("%w：内容为网页或错误信息", errInvalidContent)
+	}
+	if err := validate(f, info.Size()); err != nil {
+		return fmt.Errorf("%w：%v", errInvalidContent, err)
+	}
+	return nil
+}
+
+// readAtMost 读取 offset 起的 n 字节，文件较短时返回实际读取的部分
+func readAtMost(f io.ReaderAt, offset int64, n int64) ([]byte, error) {
+	buf := make([]byte, max(n, 0))
+	read, err := f.ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+// readTail 读取末尾 n 字节
+func readTail(f io.ReaderAt, size int64, n int64) ([]byte, error) {
+	n = min(n, size)
+	return readAtMost(f, size-n, n)
+}
+
+// looksLikeErrorPage 服务器返回的网页、XML 或 JSON 错误信息
+func looksLikeErrorPage(head []byte) bool {
+	text := strings.ToLower(strings.TrimSpace(string(bytes.TrimPrefix(head, []byte("\ufeff")))))
+	for _, prefix := range []string{"<!doctype html", "<html", "<head", "<body", "<?xml", "{\"", "<error"} {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePDF 文件头 %PDF-，结尾有 startxref（指向文件内的交叉引用表）和 %%EOF
+func validatePDF(f io.ReaderAt, size int64) error {
+	head, err := readAtMost(f, 0, min(size, 1024))
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return fmt.Errorf("缺少PDF文件头")
+	}
+	tail, err := readTail(f, size, 4096)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return fmt.Errorf("缺少PDF结尾标记（文件不完整）")
+	}
+	index := bytes.LastIndex(tail, []byte("startxref"))
+	if index < 0 {
+		return fmt.Errorf("缺少交叉引用表位置 startxref")
+	}
+	fields := bytes.Fields(tail[index+len("startxref"):])
+	if len(fields) == 0 {
+		return fmt.Errorf("交叉引用表位置无效")
+	}
+	offset, err := strconv.ParseInt(string(fields[0]), 10, 64)
+	if err != nil || offset < 0 || offset >= size {
+		return fmt.Errorf("交叉引用表位置无效：%s", fields[0])
+	}
+	return nil
+}
+
+// validateMP3 跳过 ID3v2 标签后，在开头找到有效的 MPEG 音频帧头
+func validateMP3(f io.ReaderAt, size int64) error {
+	var offset int64
+	head, err := readAtMost(f, 0, min(size, 10))
+	if err != nil {
+		return err
+	}
+	if len(head) == 10 && string(head[:3]) == "ID3" {
+		// 标签大小为 syncsafe 整数，每字节7位
+		tagSize := int64(head[6]&0x7f)<<21 | int64(head[7]&0x7f)<<14 | int64(head[8]&0x7f)<<7 | int64(head[9]&0x7f)
+		offset = 10 + tagSize
+		if head[5]&0x10 != 0 {
+			offset += 10
+		}
+		if offset >= size {
+			return fmt.Errorf("只有ID3标签，没有音频数据")
+		}
+	}
+	data, err := readAtMost(f, offset, min(size-offset, 64*1024))
+	if err != nil {
+		return err
+	}
+	for i := 0; i+4 <= len(data); i++ {
+		if validMPEGHeader(data[i : i+4]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("找不到MP3音频帧")
+}
+
+// validMPEGHeader 帧同步11位，版本、层、码率、采样率不为保留值
+func validMPEGHeader(h []byte) bool {
+	if h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return false
+	}
+	version := (h[1] >> 3) & 0x03
+	layer := (h[1] >> 1) & 0x03
+	bitrate := h[2] >> 4
+	sampleRate := (h[2] >> 2) & 0x03
+	return version != 0x01 && layer != 0x00 && bitrate != 0x0f && bitrate != 0x00 && sampleRate != 0x03
+}
+
+// validateOGG 以 OggS 页开始，最后一页带有流结束标志
+func validateOGG(f io.ReaderAt, size int64) error {
+	head, err := readAtMost(f, 0, min(size, 4))
+	if err != nil {
+		return err
+	}
+	if string(head) != "OggS" {
+		return fmt.Errorf("缺少OGG文件头")
+	}
+	// 每页最大约 64KB，末尾一定包含最后一页的页头
+	tail, err := readTail(f, size, 65536+282)
+	if err != nil {
+		return err
+	}
+	index := bytes.LastIndex(tail, []byte("OggS"))
+	if index < 0 || index+6 > len(tail) || tail[index+5]&0x04 == 0 {
+		return fmt.Errorf("缺少OGG结束页（文件不完整）")
+	}
+	return nil
+}
+
+// validateJPEG 以 SOI（FF D8 FF）开始，末尾有 EOI（FF D9）
+func validateJPEG(f io.ReaderAt, size int64) error {
+	head, err := readAtMost(f, 0, min(size, 3))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(head, []byte{0xff, 0xd8, 0xff}) {
+		return fmt.Errorf("缺少JPEG文件头")
+	}
+	tail, err := readTail(f, size, 1024)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(tail, []byte{0xff, 0xd9}) {
+		return fmt.Errorf("缺少JPEG结束标记（文件不完整）")
+	}
+	return nil
+}
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// validatePNG 文件签名，最后一块为 IEND
+func validatePNG(f io.ReaderAt, size int64) error {
+	head, err := readAtMost(f, 0, min(size, int64(len(pngSignature))))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(head, pngSignature) {
+		return fmt.Errorf("缺少PNG文件签名")
+	}
+	tail, err := readTail(f, size, 64)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(tail, []byte("IEND")) {
+		return fmt.Errorf("缺少PNG结束块（文件不完整）")
+	}
+	return nil
+}
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	// 检查开头的包数，避免读取整个视频
+	tsCheckPackets = 1024
+)
+
+// validateTS 大小为188字节的整数倍，开头若干包和最后一包以同步字节 0x47 开始
+func validateTS(f io.ReaderAt, size int64) error {
+	if size%tsPacketSize != 0 {
+		return fmt.Errorf("大小不是%d字节的整数倍（文件不完整）", tsPacketSize)
+	}
+	data, err := readAtMost(f, 0, min(size, tsPacketSize*tsCheckPackets))
+	if err != nil {
+		return err
+	}
+	for offset := 0; offset < len(data); offset += tsPacketSize {
+		if data[offset] != tsSyncByte {
+			return fmt.Errorf("偏移 %d 处缺少TS同步字节", offset)
+		}
+	}
+	last, err := readAtMost(f, size-tsPacketSize, 1)
+	if err != nil {
+		return err
+	}
+	if len(last) != 1 || last[0] != tsSyncByte {
+		return fmt.Errorf("偏移 %d 处缺少TS同步字节", size-tsPacketSize)
+	}
+	return nil
+}
+
+// checkPart 依次检查内容格式和资源信息中的大小、MD5，返回比较 MD5 时计算的摘要
+func checkPart(path string, file LinkData) (FileDigest, error) {
+	if err := validateContent(path, file.Format); err != nil {
+		return FileDigest{}, err
+	}
+	return checkDownloaded(path, file)
+}
@@ -0,0 +1,179 @@
+package dl
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errIntegrity 下载内容与资源信息中的大小或 MD5 不一致
+var errIntegrity = errors.New("文件校验失败")
+
+// FileDigest 文件摘要（十六进制小写）
+type FileDigest struct {
+	SHA256 string
+	MD5    string
+}
+
+// hashFile 读取一次同时计算 SHA-256 和 MD5，返回摘要和文件大小
+func hashFile(path string) (FileDigest, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return FileDigest{}, 0, err
+	}
+	defer file.Close()
+	sha, sum := sha256.New(), md5.New()
+	n, err := io.Copy(io.MultiWriter(sha, sum), file)
+	if err != nil {
+		return FileDigest{}, n, err
+	}
+	return FileDigest{
+		SHA256: hex.EncodeToString(sha.Sum(nil)),
+		MD5:    hex.EncodeToString(sum.Sum(nil)),
+	}, n, nil
+}
+
+// checkDownloaded 按资源信息校验下载内容：大小已知时比较大小，提供 MD5 时比较 MD5；
+// 比较 MD5 时返回计算的摘要，否则摘要为空
+func checkDownloaded(path string, file LinkData) (FileDigest, error) {
+	if file.Size <= 0 && file.MD5 == "" {
+		return FileDigest{}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileDigest{}, err
+	}
+	if file.Size > 0 && info.Size() != file.Size {
+		return FileDigest{}, fmt.Errorf("%w：大小 %d/%d 字节", errIntegrity, info.Size(), file.Size)
+	}
+	if file.MD5 == "" {
+		return FileDigest{}, nil
+	}
+	digest, _, err := hashFile(path)
+	if err != nil {
+		return FileDigest{}, err
+	}
+	if !strings.EqualFold(digest.MD5, file.MD5) {
+		return FileDigest{}, fmt.Errorf("%w：MD5 %s/%s", errIntegrity, digest.MD5, file.MD5)
+	}
+	return digest, nil
+}
+
+// VerifyStatus 单个文件的校验结果
+type VerifyStatus string
+
+const (
+	VerifyOK       VerifyStatus = "ok"
+	VerifyMismatch VerifyStatus = "mismatch" // 大小或摘要不一致
+	VerifyMissing  VerifyStatus = "missing"  // 文件已不存在
+	VerifyError    VerifyStatus = "error"    // 读取出错
+)
+
+// VerifyResult 单个文件的校验结果
+type VerifyResult struct {
+	Path   string
+	Status VerifyStatus
+	Detail string
+}
+
+// VerifySummary 目录校验统计
+type VerifySummary struct {
+	Indexes  int // 找到的索引文件数
+	Total    int
+	OK       int
+	Mismatch int
+	Missing  int
+	Failed   int
+}
+
+// Passed 全部文件校验通过
+func (s VerifySummary) Passed() bool {
+	return s.Mismatch == 0 && s.Missing == 0 && s.Failed == 0
+}
+
+func (s VerifySummary) String() string {
+	return fmt.Sprintf("索引 %d 个，文件 %d 个：通过 %d，不一致 %d，缺失 %d，出错 %d",
+		s.Indexes, s.Total, s.OK, s.Mismatch, s.Missing, s.Failed)
+}
+
+// VerifyFolder 查找 dir 及其子目录中的索引文件（下载时写入元数据生成），
+// 按其中记录的大小和摘要重新校验每个文件，每个文件校验后调用 onResult（可为 nil）
+func VerifyFolder(ctx context.Context, dir string, onResult func(VerifyResult)) (VerifySummary, error) {
+	var summary VerifySummary
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() || d.Name() != INDEX_FILE {
+			return nil
+		}
+
+		var index FolderIndex
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("读取索引 %s 出错：%w", path, err)
+		}
+		summary.Indexes++
+		folder := filepath.Dir(path)
+		for _, entry := range index.Items {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			result := verifyEntry(folder, entry)
+			summary.Total++
+			switch result.Status {
+			case VerifyOK:
+				summary.OK++
+			case VerifyMismatch:
+				summary.Mismatch++
+			case VerifyMissing:
+				summary.Missing++
+			default:
+				summary.Failed++
+			}
+			if onResult != nil {
+				onResult(result)
+			}
+		}
+		return nil
+	})
+	if err == nil && summary.Indexes == 0 {
+		err = fmt.Errorf("%s 中没有索引文件 %s，请在下载时开启元数据", dir, INDEX_FILE)
+	}
+	return summary, err
+}
+
+// verifyEntry 依次比较大小、SHA-256 和 MD5，索引中没有记录的项不比较
+func verifyEntry(folder string, entry IndexEntry) VerifyResult {
+	path := filepath.Join(folder, entry.File)
+	result := VerifyResult{Path: path, Status: VerifyOK}
+	digest, size, err := hashFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		result.Status = VerifyMissing
+	case err != nil:
+		result.Status, result.Detail = VerifyError, err.Error()
+	case entry.Size > 0 && size != entry.Size:
+		result.Status, result.Detail = VerifyMismatch, fmt.Sprintf("大小 %d/%d 字节", size, entry.Size)
+	case entry.SHA256 != "" && !strings.EqualFold(digest.SHA256, entry.SHA256):
+		result.Status, result.Detail = VerifyMismatch, fmt.Sprintf("SHA-256 %s/%s", digest.SHA256, entry.SHA256)
+	case entry.MD5 != "" && !strings.EqualFold(digest.MD5, entry.MD5):
+		result.Status, result.Detail = VerifyMismatch, fmt.Sprintf("MD5 %s/%s", digest.MD5, entry.MD5)
+	}
+	return result
+}
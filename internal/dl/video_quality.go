@@ -0,0 +1,213 @@
+package dl
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// QualityMode 视频清晰度选择方式
+type QualityMode string
+
+const (
+	QualityHighest QualityMode = "highest" // 最高清晰度
+	QualityLowest  QualityMode = "lowest"  // 最低清晰度
+	QualityHeight  QualityMode = "height"  // 指定高度（如720p），没有则选不超过该高度的最高清晰度
+	QualityBitrate QualityMode = "bitrate" // 不超过指定码率的最高清晰度
+)
+
+// QualityPolicy 视频清晰度选择策略，用于主播放列表和课程视频的多个清晰度
+type QualityPolicy struct {
+	Mode       QualityMode
+	Height     int   // QualityHeight 使用
+	MaxBitrate int64 // QualityBitrate 使用，单位 bit/s
+}
+
+type QualityData struct {
+	Name  string
+	Value string
+}
+
+var QUALITY_LIST = []QualityData{
+	{"最高清晰度", "highest"},
+	{"最低清晰度", "lowest"},
+	{"1080p", "1080p"},
+	{"720p", "720p"},
+	{"480p", "480p"},
+	{"码率≤2Mbps", "2m"},
+	{"码率≤1Mbps", "1m"},
+}
+
+// ParseQualityPolicy 解析清晰度：highest、lowest、720p（高度）、2m/800k（最大码率），默认最高清晰度
+func ParseQualityPolicy(value string) (QualityPolicy, error) {
+	for _, item := range QUALITY_LIST {
+		if item.Name == value {
+			value = item.Value
+			break
+		}
+	}
+
+	v := strings.ToLower(strings.TrimSpace(value))
+	switch v {
+	case "", string(QualityHighest):
+		return QualityPolicy{Mode: QualityHighest}, nil
+	case string(QualityLowest):
+		return QualityPolicy{Mode: QualityLowest}, nil
+	}
+
+	if height, ok := strings.CutSuffix(v, "p"); ok {
+		if n, err := strconv.Atoi(height); err == nil && n > 0 {
+			return QualityPolicy{Mode: QualityHeight, Height: n}, nil
+		}
+	}
+	unit := int64(1)
+	if rate, ok := strings.CutSuffix(v, "k"); ok {
+		v, unit = rate, 1000
+	} else if rate, ok := strings.CutSuffix(v, "m"); ok {
+		v, unit = rate, 1000*1000
+	}
+	if rate, err := strconv.ParseFloat(v, 64); err == nil && rate > 0 {
+		return QualityPolicy{Mode: QualityBitrate, MaxBitrate: int64(rate * float64(unit))}, nil
+	}
+	return QualityPolicy{Mode: QualityHighest}, fmt.Errorf("invalid video quality: %s", value)
+}
+
+// Value 可由 ParseQualityPolicy 解析的写法，用于保存
+func (p QualityPolicy) Value() string {
+	switch p.Mode {
+	case QualityHeight:
+		return fmt.Sprintf("%dp", p.Height)
+	case QualityBitrate:
+		switch {
+		case p.MaxBitrate%1000000 == 0:
+			return fmt.Sprintf("%dm", p.MaxBitrate/1000000)
+		case p.MaxBitrate%1000 == 0:
+			return fmt.Sprintf("%dk", p.MaxBitrate/1000)
+		}
+		return strconv.FormatInt(p.MaxBitrate, 10)
+	case QualityLowest:
+		return string(QualityLowest)
+	}
+	return string(QualityHighest)
+}
+
+func (p QualityPolicy) String() string {
+	switch p.Mode {
+	case QualityHeight:
+		return fmt.Sprintf("%dp", p.Height)
+	case QualityBitrate:
+		return fmt.Sprintf("≤%dkbps", p.MaxBitrate/1000)
+	case QualityLowest:
+		return string(QualityLowest)
+	}
+	return string(QualityHighest)
+}
+
+// VideoVariant 同一视频的一种清晰度，未知的字段为0
+type VideoVariant struct {
+	Height    int
+	Bandwidth int64
+	Size      int64
+	URLs      []string
+}
+
+// compareVariant 按高度、码率、文件大小比较清晰度
+func compareVariant(a, b VideoVariant) int {
+	return cmp.Or(
+		cmp.Compare(a.Height, b.Height),
+		cmp.Compare(a.Bandwidth, b.Bandwidth),
+		cmp.Compare(a.Size, b.Size),
+	)
+}
+
+// Choose 按策略选择清晰度，返回下标；没有候选时返回 -1
+func (p QualityPolicy) Choose(variants []VideoVariant) int {
+	if len(variants) == 0 {
+		return -1
+	}
+	// 在满足条件的候选中选择最高（或最低）清晰度
+	pick := func(accept func(v VideoVariant) bool, lowest bool) int {
+		best := -1
+		for i, v := range variants {
+			if !accept(v) {
+				continue
+			}
+			if best < 0 {
+				best = i
+				continue
+			}
+			c := compareVariant(v, variants[best])
+			if (lowest && c < 0) || (!lowest && c > 0) {
+				best = i
+			}
+		}
+		return best
+	}
+	all := func(v VideoVariant) bool { return true }
+
+	var best int
+	switch p.Mode {
+	case QualityLowest:
+		return pick(all, true)
+	case QualityHeight:
+		best = pick(func(v VideoVariant) bool { return v.Height == p.Height }, false)
+		if best < 0 {
+			best = pick(func(v VideoVariant) bool { return v.Height > 0 && v.Height <= p.Height }, false)
+		}
+	case QualityBitrate:
+		best = pick(func(v VideoVariant) bool { return v.Bandwidth > 0 && v.Bandwidth <= p.MaxBitrate }, false)
+		if best < 0 && pick(func(v VideoVariant) bool { return v.Bandwidth > 0 }, false) < 0 {
+			// 码率均未知
+			return pick(all, false)
+		}
+	default:
+		return pick(all, false)
+	}
+	if best < 0 {
+		// 都不满足条件时选最低清晰度
+		return pick(all, true)
+	}
+	return best
+}
+
+var heightPattern = regexp.MustCompile(`(?i)(?:^|[^\d])(\d{3,4})p(?:$|[^a-z])`)
+
+// parseHeight 从 “1280x720”、“720p” 等文本中提取高度
+func parseHeight(text string) int {
+	if _, h, ok := strings.Cut(strings.ToLower(text), "x"); ok {
+		if n, err := strconv.Atoi(h); err == nil {
+			return n
+		}
+	}
+	if matches := heightPattern.FindStringSubmatch(text); len(matches) > 1 {
+		n, _ := strconv.Atoi(matches[1])
+		return n
+	}
+	return 0
+}
+
+// courseVideoVariant 课程详情中 video_extend.urls 的一项，字段不固定，尽量提取清晰度信息
+func courseVideoVariant(item gjson.Result, urls []string) VideoVariant {
+	variant := VideoVariant{
+		Height:    int(item.Get("height").Int()),
+		Bandwidth: cmp.Or(item.Get("bitrate").Int(), item.Get("bandwidth").Int()),
+		Size:      item.Get("size").Int(),
+		URLs:      urls,
+	}
+	if variant.Height == 0 {
+		for _, key := range []string{"resolution", "quality", "definition", "name", "label"} {
+			if height := parseHeight(item.Get(key).String()); height > 0 {
+				variant.Height = height
+				break
+			}
+		}
+	}
+	if variant.Height == 0 && len(urls) > 0 {
+		variant.Height = parseHeight(urls[0])
+	}
+	return variant
+}
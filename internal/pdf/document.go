@@ -0,0 +1,524 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// xrefEntry 交叉引用表中的一项：文件偏移，或位于对象流中的序号
+type xrefEntry struct {
+	offset     int64
+	compressed bool
+	stream     int // 所在对象流编号
+	index      int // 在对象流中的序号
+}
+
+// document 已读取的 PDF 文件，对象按需解析
+type document struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	trailer Dict
+	cache   map[int]Object
+	streams map[int]*objectStream
+	rebuilt bool
+}
+
+// objectStream 解码后的对象流
+type objectStream struct {
+	data    []byte
+	offsets []int // 序号 → 对象偏移
+	nums    []int
+}
+
+// 每个文件最多跟随的 /Prev 数，避免循环
+const maxXrefSections = 64
+
+func openDocument(path string) (*document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &document{
+		data:    data,
+		xref:    make(map[int]xrefEntry),
+		cache:   make(map[int]Object),
+		streams: make(map[int]*objectStream),
+	}
+	if err := d.readXref(); err != nil || d.trailer["Root"] == nil {
+		// 交叉引用表损坏时扫描全部对象
+		if err := d.rebuildXref(); err != nil {
+			return nil, err
+		}
+	}
+	if d.trailer["Encrypt"] != nil {
+		return nil, errors.New("不支持加密的PDF")
+	}
+	return d, nil
+}
+
+// readXref 从 startxref 开始读取交叉引用表（含 /Prev 和 /XRefStm）
+func (d *document) readXref() error {
+	tail := d.data[max(len(d.data)-2048, 0):]
+	index := bytes.LastIndex(tail, []byte("startxref"))
+	if index < 0 {
+		return errors.New("startxref not found")
+	}
+	p := &parser{data: tail, pos: index + len("startxref")}
+	offset, ok := p.readInt()
+	if !ok {
+		return errors.New("invalid startxref")
+	}
+
+	visited := make(map[int]bool)
+	for i := 0; i < maxXrefSections && offset > 0 && !visited[offset]; i++ {
+		visited[offset] = true
+		trailer, err := d.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		if d.trailer == nil {
+			d.trailer = trailer
+		}
+		if stm, ok := toInt(trailer["XRefStm"]); ok {
+			if _, err := d.readXrefSection(stm); err != nil {
+				return err
+			}
+		}
+		offset, _ = toInt(trailer["Prev"])
+	}
+	if d.trailer == nil {
+		return errors.New("trailer not found")
+	}
+	return nil
+}
+
+// readXrefSection 读取一段交叉引用表或交叉引用流，较新的项优先
+func (d *document) readXrefSection(offset int) (Dict, error) {
+	if offset >= len(d.data) {
+		return nil, fmt.Errorf("invalid xref offset %d", offset)
+	}
+	p := &parser{data: d.data, pos: offset}
+	p.skipSpace()
+	if !bytes.HasPrefix(d.data[p.pos:], []byte("xref")) {
+		return d.readXrefStream(offset)
+	}
+	p.pos += len("xref")
+	for {
+		p.skipSpace()
+		if bytes.HasPrefix(d.data[p.pos:], []byte("trailer")) {
+			p.pos += len("trailer")
+			obj, err := p.readObject()
+			if err != nil {
+				return nil, err
+			}
+			trailer, ok := obj.(Dict)
+			if !ok {
+				return nil, errors.New("invalid trailer")
+			}
+			return trailer, nil
+		}
+		start, ok1 := p.readInt()
+		count, ok2 := p.readInt()
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("invalid xref subsection at %d", p.pos)
+		}
+		for i := range count {
+			off, ok1 := p.readInt()
+			_, ok2 := p.readInt()
+			p.skipSpace()
+			kind := p.readKeyword()
+			if !ok1 || !ok2 || kind != "n" && kind != "f" {
+				return nil, fmt.Errorf("invalid xref entry at %d", p.pos)
+			}
+			if _, exists := d.xref[start+i]; !exists && kind == "n" {
+				d.xref[start+i] = xrefEntry{offset: int64(off)}
+			}
+		}
+	}
+}
+
+// readXrefStream 读取交叉引用流（PDF 1.5）
+func (d *document) readXrefStream(offset int) (Dict, error) {
+	_, obj, err := d.parseAt(int64(offset))
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(Stream)
+	if !ok || stream.Dict["Type"] != Name("XRef") {
+		return nil, fmt.Errorf("invalid xref stream at %d", offset)
+	}
+	data, err := d.decode(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	w, _ := stream.Dict["W"].(Array)
+	if len(w) != 3 {
+		return nil, errors.New("invalid xref stream /W")
+	}
+	var widths [3]int
+	for i := range widths {
+		widths[i], _ = toInt(w[i])
+	}
+	size, _ := toInt(stream.Dict["Size"])
+	sections := []int{0, size}
+	if index, ok := stream.Dict["Index"].(Array); ok {
+		sections = sections[:0]
+		for _, v := range index {
+			n, _ := toInt(v)
+			sections = append(sections, n)
+		}
+	}
+
+	rowSize := widths[0] + widths[1] + widths[2]
+	if rowSize == 0 {
+		return nil, errors.New("invalid xref stream /W")
+	}
+	field := func(row []byte, i int) int64 {
+		start := 0
+		for j := range i {
+			start += widths[j]
+		}
+		var v int64
+		for _, b := range row[start : start+widths[i]] {
+			v = v<<8 | int64(b)
+		}
+		return v
+	}
+	pos := 0
+	for s := 0; s+1 < len(sections); s += 2 {
+		start, count := sections[s], sections[s+1]
+		for i := range count {
+			if pos+rowSize > len(data) {
+				return stream.Dict, nil
+			}
+			row := data[pos : pos+rowSize]
+			pos += rowSize
+			kind := int64(1)
+			if widths[0] > 0 {
+				kind = field(row, 0)
+			}
+			num := start + i
+			if _, exists := d.xref[num]; exists {
+				continue
+			}
+			switch kind {
+			case 1:
+				d.xref[num] = xrefEntry{offset: field(row, 1)}
+			case 2:
+				d.xref[num] = xrefEntry{compressed: true, stream: int(field(row, 1)), index: int(field(row, 2))}
+			}
+		}
+	}
+	return stream.Dict, nil
+}
+
+var objHeader = regexp.MustCompile(`(?m)^\s*(\d+)\s+(\d+)\s+obj\b`)
+
+// rebuildXref 扫描文件中的全部“n g obj”，并查找文档目录
+func (d *document) rebuildXref() error {
+	d.rebuilt = true
+	clear(d.xref)
+	clear(d.cache)
+	for _, match := range objHeader.FindAllSubmatchIndex(d.data, -1) {
+		num, err := strconv.Atoi(string(d.data[match[2]:match[3]]))
+		if err != nil {
+			continue
+		}
+		d.xref[num] = xrefEntry{offset: int64(match[2])}
+	}
+
+	// 对象流中的对象
+	for num := range d.xref {
+		obj, err := d.resolveNum(num)
+		if stream, ok := obj.(Stream); err == nil && ok && stream.Dict["Type"] == Name("ObjStm") {
+			objStm, err := d.objectStream(num)
+			if err != nil {
+				continue
+			}
+			for i, n := range objStm.nums {
+				if _, exists := d.xref[n]; !exists {
+					d.xref[n] = xrefEntry{compressed: true, stream: num, index: i}
+				}
+			}
+		}
+	}
+
+	if d.trailer == nil {
+		d.trailer = make(Dict)
+	}
+	if index := bytes.LastIndex(d.data, []byte("trailer")); index >= 0 {
+		p := &parser{data: d.data, pos: index + len("trailer")}
+		if obj, err := p.readObject(); err == nil {
+			if trailer, ok := obj.(Dict); ok {
+				d.trailer = trailer
+			}
+		}
+	}
+	if _, ok := d.trailer["Root"].(Ref); !ok {
+		for num := range d.xref {
+			if obj, err := d.resolveNum(num); err == nil {
+				if dict, ok := obj.(Dict); ok && dict["Type"] == Name("Catalog") {
+					d.trailer["Root"] = Ref{Num: num}
+					break
+				}
+			}
+		}
+	}
+	if _, ok := d.trailer["Root"].(Ref); !ok {
+		return errors.New("找不到PDF文档目录")
+	}
+	return nil
+}
+
+// parseAt 读取偏移处的“n g obj ... endobj”，返回对象编号和对象
+func (d *document) parseAt(offset int64) (int, Object, error) {
+	if offset < 0 || offset >= int64(len(d.data)) {
+		return 0, nil, fmt.Errorf("invalid object offset %d", offset)
+	}
+	p := &parser{data: d.data, pos: int(offset)}
+	num, ok1 := p.readInt()
+	_, ok2 := p.readInt()
+	p.skipSpace()
+	if !ok1 || !ok2 || p.readKeyword() != "obj" {
+		return 0, nil, fmt.Errorf("object header expected at %d", offset)
+	}
+	obj, err := p.readObject()
+	if err != nil {
+		return num, nil, err
+	}
+	dict, ok := obj.(Dict)
+	if !ok {
+		return num, obj, nil
+	}
+	p.skipSpace()
+	if !bytes.HasPrefix(d.data[p.pos:], []byte("stream")) {
+		return num, obj, nil
+	}
+	p.pos += len("stream")
+	if p.pos < len(d.data) && d.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(d.data) && d.data[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+
+	// 优先使用 /Length，与 endstream 不符时搜索 endstream
+	if length, ok := toInt(d.resolve(dict["Length"])); ok && length >= 0 && start+length <= len(d.data) {
+		end := &parser{data: d.data, pos: start + length}
+		end.skipSpace()
+		if bytes.HasPrefix(d.data[end.pos:], []byte("endstream")) {
+			return num, Stream{Dict: dict, Data: d.data[start : start+length]}, nil
+		}
+	}
+	index := bytes.Index(d.data[start:], []byte("endstream"))
+	if index < 0 {
+		return num, nil, fmt.Errorf("endstream not found for object %d", num)
+	}
+	data := d.data[start : start+index]
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	return num, Stream{Dict: dict, Data: data}, nil
+}
+
+// resolve 间接引用替换为对象，不存在时为 nil
+func (d *document) resolve(obj Object) Object {
+	ref, ok := obj.(Ref)
+	if !ok {
+		return obj
+	}
+	resolved, err := d.resolveNum(ref.Num)
+	if err != nil {
+		return nil
+	}
+	return resolved
+}
+
+func (d *document) resolveNum(num int) (Object, error) {
+	if obj, ok := d.cache[num]; ok {
+		return obj, nil
+	}
+	entry, ok := d.xref[num]
+	if !ok {
+		return nil, fmt.Errorf("object %d not found", num)
+	}
+	// 先占位，避免 /Length 等循环引用
+	d.cache[num] = nil
+
+	var obj Object
+	var err error
+	if entry.compressed {
+		obj, err = d.compressedObject(entry)
+	} else {
+		var parsed int
+		parsed, obj, err = d.parseAt(entry.offset)
+		if err == nil && parsed != num {
+			err = fmt.Errorf("object %d expected at %d, got %d", num, entry.offset, parsed)
+		}
+	}
+	if err != nil {
+		delete(d.cache, num)
+		// 交叉引用表中的偏移有误时扫描全部对象后重试一次
+		if !d.rebuilt && d.rebuildXref() == nil {
+			return d.resolveNum(num)
+		}
+		return nil, err
+	}
+	d.cache[num] = obj
+	return obj, nil
+}
+
+func (d *document) compressedObject(entry xrefEntry) (Object, error) {
+	objStm, err := d.objectStream(entry.stream)
+	if err != nil {
+		return nil, err
+	}
+	if entry.index >= len(objStm.offsets) {
+		return nil, fmt.Errorf("object index %d out of range in stream %d", entry.index, entry.stream)
+	}
+	p := &parser{data: objStm.data, pos: objStm.offsets[entry.index]}
+	return p.readObject()
+}
+
+// objectStream 解码对象流（PDF 1.5），读取其中的对象编号和偏移
+func (d *document) objectStream(num int) (*objectStream, error) {
+	if objStm, ok := d.streams[num]; ok {
+		return objStm, nil
+	}
+	obj, err := d.resolveNum(num)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(Stream)
+	if !ok {
+		return nil, fmt.Errorf("object %d is not an object stream", num)
+	}
+	data, err := d.decode(stream)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := toInt(stream.Dict["N"])
+	first, _ := toInt(stream.Dict["First"])
+	objStm := &objectStream{data: data}
+	p := &parser{data: data}
+	for range n {
+		objNum, ok1 := p.readInt()
+		offset, ok2 := p.readInt()
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("invalid object stream %d", num)
+		}
+		objStm.nums = append(objStm.nums, objNum)
+		objStm.offsets = append(objStm.offsets, first+offset)
+	}
+	d.streams[num] = objStm
+	return objStm, nil
+}
+
+// decode 解码交叉引用流和对象流，只支持 FlateDecode 及 PNG 预测
+func (d *document) decode(stream Stream) ([]byte, error) {
+	filter := d.resolve(stream.Dict["Filter"])
+	params := d.resolve(stream.Dict["DecodeParms"])
+	if filters, ok := filter.(Array); ok {
+		if len(filters) > 1 {
+			return nil, errors.New("unsupported filter chain")
+		}
+		if len(filters) == 1 {
+			filter = d.resolve(filters[0])
+		} else {
+			filter = nil
+		}
+		if array, ok := params.(Array); ok && len(array) > 0 {
+			params = d.resolve(array[0])
+		}
+	}
+	if filter == nil {
+		return stream.Data, nil
+	}
+	if filter != Name("FlateDecode") {
+		return nil, fmt.Errorf("unsupported filter %v", filter)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(stream.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	if dict, ok := params.(Dict); ok {
+		if predictor, _ := toInt(d.resolve(dict["Predictor"])); predictor >= 10 {
+			columns, ok := toInt(d.resolve(dict["Columns"]))
+			if !ok {
+				columns = 1
+			}
+			return unpredictPNG(data, columns)
+		} else if predictor > 1 {
+			return nil, fmt.Errorf("unsupported predictor %d", predictor)
+		}
+	}
+	return data, nil
+}
+
+// unpredictPNG 还原 PNG 预测（每行第一个字节为过滤类型，按每像素1字节计算）
+func unpredictPNG(data []byte, columns int) ([]byte, error) {
+	if columns <= 0 {
+		return nil, errors.New("invalid predictor columns")
+	}
+	rowLen := columns + 1
+	out := make([]byte, 0, len(data)/rowLen*columns)
+	prev := make([]byte, columns)
+	for start := 0; start+rowLen <= len(data); start += rowLen {
+		kind := data[start]
+		row := append([]byte(nil), data[start+1:start+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i > 0 {
+				left, upLeft = row[i-1], prev[i-1]
+			}
+			up := prev[i]
+			switch kind {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("invalid PNG filter %d", kind)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
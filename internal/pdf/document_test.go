@@ -0,0 +1,212 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// testPDF 构造测试用 PDF，记录每个对象的偏移
+type testPDF struct {
+	buf     bytes.Buffer
+	offsets map[int]int
+}
+
+func newTestPDF() *testPDF {
+	b := &testPDF{offsets: make(map[int]int)}
+	b.buf.WriteString("%PDF-1.5\n")
+	return b
+}
+
+func (b *testPDF) object(num int, body string) {
+	b.offsets[num] = b.buf.Len()
+	fmt.Fprintf(&b.buf, "%d 0 obj\n%s\nendobj\n", num, body)
+}
+
+func (b *testPDF) stream(num int, dict string, data []byte) {
+	b.offsets[num] = b.buf.Len()
+	fmt.Fprintf(&b.buf, "%d 0 obj\n<< %s /Length %d >>\nstream\n", num, dict, len(data))
+	b.buf.Write(data)
+	b.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// xrefTable 写入 nums 对应的交叉引用表（每个对象一个子段）和 trailer，返回其偏移
+func (b *testPDF) xrefTable(nums []int, trailer string) int {
+	offset := b.buf.Len()
+	b.buf.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for _, num := range nums {
+		fmt.Fprintf(&b.buf, "%d 1\n%010d 00000 n \n", num, b.offsets[num])
+	}
+	fmt.Fprintf(&b.buf, "trailer\n%s\n", trailer)
+	return offset
+}
+
+// xrefStream 写入编号为 num 的交叉引用流，compressed 为对象 → 所在对象流编号和序号，
+// 使用 PNG 预测（过滤类型0），返回其偏移
+func (b *testPDF) xrefStream(num int, nums []int, compressed map[int][2]int, dict string) int {
+	offset := b.buf.Len()
+	b.offsets[num] = offset
+	all := append(slices.Clone(nums), num)
+	for n := range compressed {
+		all = append(all, n)
+	}
+	slices.Sort(all)
+	var rows []byte
+	var index string
+	for _, n := range all {
+		index += fmt.Sprintf(" %d 1", n)
+		rows = append(rows, 0) // PNG 过滤类型
+		if entry, ok := compressed[n]; ok {
+			rows = append(rows, 2, 0, 0, 0, byte(entry[0]), 0, byte(entry[1]))
+		} else {
+			o := b.offsets[n]
+			rows = append(rows, 1, byte(o>>24), byte(o>>16), byte(o>>8), byte(o), 0, 0)
+		}
+	}
+	var data bytes.Buffer
+	zw := zlib.NewWriter(&data)
+	zw.Write(rows)
+	zw.Close()
+	b.stream(num, fmt.Sprintf("/Type /XRef /W [1 4 2] /Index [%s] /Filter /FlateDecode "+
+		"/DecodeParms << /Predictor 12 /Columns 7 >> %s", index, dict), data.Bytes())
+	return offset
+}
+
+func (b *testPDF) startxref(offset int) {
+	fmt.Fprintf(&b.buf, "startxref\n%d\n%%%%EOF\n", offset)
+}
+
+// open 写入临时目录并打开
+func (b *testPDF) open(t *testing.T) *document {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "a.pdf")
+	if err := os.WriteFile(path, b.buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := openDocument(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// resolveDict 读取对象 num 的字典
+func resolveDict(t *testing.T, doc *document, num int) Dict {
+	t.Helper()
+	obj, err := doc.resolveNum(num)
+	if err != nil {
+		t.Fatalf("object %d: %v", num, err)
+	}
+	dict, ok := obj.(Dict)
+	if !ok {
+		t.Fatalf("object %d = %T, want Dict", num, obj)
+	}
+	return dict
+}
+
+func TestReadXrefTable(t *testing.T) {
+	b := newTestPDF()
+	b.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	b.object(2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	b.object(3, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 100 200] >>")
+	b.startxref(b.xrefTable([]int{1, 2, 3}, "<< /Size 4 /Root 1 0 R >>"))
+
+	doc := b.open(t)
+	if doc.rebuilt {
+		t.Fatal("xref table should be read without rebuilding")
+	}
+	for _, num := range []int{1, 2, 3} {
+		if entry := doc.xref[num]; entry.compressed || entry.offset != int64(b.offsets[num]) {
+			t.Errorf("xref[%d] = %+v, want offset %d", num, entry, b.offsets[num])
+		}
+	}
+	if _, ok := doc.xref[0]; ok {
+		t.Error("free entry should not be added")
+	}
+	if root := doc.trailer["Root"]; root != (Ref{Num: 1}) {
+		t.Errorf("trailer Root = %v", root)
+	}
+	if page := resolveDict(t, doc, 3); page["Type"] != Name("Page") {
+		t.Errorf("object 3 = %v", page)
+	}
+}
+
+func TestReadXrefStream(t *testing.T) {
+	b := newTestPDF()
+	b.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	b.object(2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	// 页面位于对象流4中
+	objects := "3 0 << /Type /Page /Parent 2 0 R /MediaBox [0 0 100 200] >>"
+	b.stream(4, "/Type /ObjStm /N 1 /First 4", []byte(objects))
+	b.startxref(b.xrefStream(5, []int{1, 2, 4}, map[int][2]int{3: {4, 0}}, "/Size 6 /Root 1 0 R"))
+
+	doc := b.open(t)
+	if doc.rebuilt {
+		t.Fatal("xref stream should be read without rebuilding")
+	}
+	if entry := doc.xref[2]; entry.compressed || entry.offset != int64(b.offsets[2]) {
+		t.Errorf("xref[2] = %+v, want offset %d", entry, b.offsets[2])
+	}
+	if entry := doc.xref[3]; !entry.compressed || entry.stream != 4 || entry.index != 0 {
+		t.Errorf("xref[3] = %+v, want object stream 4 index 0", entry)
+	}
+	if page := resolveDict(t, doc, 3); page["Type"] != Name("Page") {
+		t.Errorf("object 3 = %v", page)
+	}
+	if root := resolveDict(t, doc, 1); root["Type"] != Name("Catalog") {
+		t.Errorf("root = %v", root)
+	}
+}
+
+// 增量更新：新的交叉引用表只含修改的对象，/Prev 指向原表，较新的项优先
+func TestReadXrefIncremental(t *testing.T) {
+	b := newTestPDF()
+	b.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	b.object(2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	b.object(3, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 100 200] >>")
+	prev := b.xrefTable([]int{1, 2, 3}, "<< /Size 4 /Root 1 0 R >>")
+	b.startxref(prev)
+
+	oldPage := b.offsets[3]
+	b.object(3, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 300 400] >>")
+	b.object(4, "<< /Producer (update) >>")
+	b.startxref(b.xrefTable([]int{3, 4}, fmt.Sprintf("<< /Size 5 /Root 1 0 R /Info 4 0 R /Prev %d >>", prev)))
+
+	doc := b.open(t)
+	if doc.rebuilt {
+		t.Fatal("incremental update should be read without rebuilding")
+	}
+	if doc.xref[3].offset == int64(oldPage) || doc.xref[3].offset != int64(b.offsets[3]) {
+		t.Errorf("xref[3] = %+v, want updated offset %d", doc.xref[3], b.offsets[3])
+	}
+	if doc.xref[1].offset != int64(b.offsets[1]) {
+		t.Errorf("xref[1] = %+v, want offset %d from previous section", doc.xref[1], b.offsets[1])
+	}
+	if doc.trailer["Info"] != (Ref{Num: 4}) {
+		t.Errorf("trailer should come from the newest section: %v", doc.trailer)
+	}
+	box, _ := resolveDict(t, doc, 3)["MediaBox"].(Array)
+	if len(box) != 4 || box[2] != Integer(300) {
+		t.Errorf("MediaBox = %v, want updated page", box)
+	}
+}
+
+func TestRebuildXref(t *testing.T) {
+	b := newTestPDF()
+	b.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	b.object(2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	b.object(3, "<< /Type /Page /Parent 2 0 R >>")
+	b.startxref(12345) // 偏移错误
+
+	doc := b.open(t)
+	if !doc.rebuilt {
+		t.Fatal("invalid startxref should rebuild xref")
+	}
+	if root := doc.trailer["Root"]; root != (Ref{Num: 1}) {
+		t.Errorf("trailer Root = %v, want catalog found by scanning", root)
+	}
+}
@@ -0,0 +1,278 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Source 要合并的文件，Title 为书签标题
+type Source struct {
+	Path  string
+	Title string
+}
+
+// 页面可从页面树继承的属性，合并后页面不再属于原页面树，需写入每个页面
+var inheritedKeys = []Name{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// 缺少页面大小时使用 A4
+var defaultMediaBox = Array{Integer(0), Integer(0), Integer(595), Integer(842)}
+
+// Merge 按顺序合并 sources 为 dstPath，每个文件添加一个指向其首页的书签，title 为文档标题；
+// 只保留页面及其引用的对象，原文件的书签、表单和命名目标不保留。失败时删除 dstPath
+func Merge(sources []Source, dstPath string, title string) (err error) {
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dstPath)
+		}
+	}()
+
+	pw := newWriter(dst)
+	pagesRef := pw.alloc()
+	var kids Array
+	type bookmark struct {
+		title string
+		page  Ref
+	}
+	var bookmarks []bookmark
+	for _, src := range sources {
+		pages, err := appendDocument(pw, src.Path, pagesRef)
+		if err != nil {
+			return fmt.Errorf("%s：%w", filepath.Base(src.Path), err)
+		}
+		if len(pages) == 0 {
+			continue
+		}
+		for _, page := range pages {
+			kids = append(kids, page)
+		}
+		bookmarks = append(bookmarks, bookmark{title: src.Title, page: pages[0]})
+	}
+	if len(kids) == 0 {
+		return errors.New("没有可合并的页面")
+	}
+	if err := pw.writeObject(pagesRef, Dict{"Type": Name("Pages"), "Kids": kids, "Count": Integer(len(kids))}); err != nil {
+		return err
+	}
+
+	// 每个文件一个书签
+	outlinesRef := pw.alloc()
+	items := make([]Ref, len(bookmarks))
+	for i := range items {
+		items[i] = pw.alloc()
+	}
+	for i, mark := range bookmarks {
+		item := Dict{
+			"Title":  textString(mark.title),
+			"Parent": outlinesRef,
+			"Dest":   Array{mark.page, Name("Fit")},
+		}
+		if i > 0 {
+			item["Prev"] = items[i-1]
+		}
+		if i < len(items)-1 {
+			item["Next"] = items[i+1]
+		}
+		if err := pw.writeObject(items[i], item); err != nil {
+			return err
+		}
+	}
+	outlines := Dict{"Type": Name("Outlines"), "Count": Integer(len(items))}
+	if len(items) > 0 {
+		outlines["First"], outlines["Last"] = items[0], items[len(items)-1]
+	}
+	if err := pw.writeObject(outlinesRef, outlines); err != nil {
+		return err
+	}
+
+	catalogRef := pw.alloc()
+	catalog := Dict{
+		"Type":     Name("Catalog"),
+		"Pages":    pagesRef,
+		"Outlines": outlinesRef,
+		"PageMode": Name("UseOutlines"),
+	}
+	if err := pw.writeObject(catalogRef, catalog); err != nil {
+		return err
+	}
+	infoRef := pw.alloc()
+	info := Dict{
+		"Title":        textString(title),
+		"Producer":     String("smartedudl"),
+		"CreationDate": String(time.Now().UTC().Format("D:20060102150405Z")),
+	}
+	if err := pw.writeObject(infoRef, info); err != nil {
+		return err
+	}
+	return pw.finish(catalogRef, infoRef)
+}
+
+// copier 将一个文件中页面引用的对象按新编号写入
+type copier struct {
+	doc     *document
+	pw      *writer
+	refs    map[int]Ref // 原编号 → 新编号
+	pending []int
+}
+
+// pageEntry 页面树中的一页，num 为原编号（直接对象为 -1）
+type pageEntry struct {
+	num  int
+	dict Dict
+}
+
+// appendDocument 写入 path 的全部页面及其引用的对象，页面的父节点改为 parent，返回新的页面引用
+func appendDocument(pw *writer, path string, parent Ref) ([]Ref, error) {
+	doc, err := openDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := doc.resolve(doc.trailer["Root"]).(Dict)
+	if !ok {
+		return nil, errors.New("找不到PDF文档目录")
+	}
+	c := &copier{doc: doc, pw: pw, refs: make(map[int]Ref)}
+	var pages []pageEntry
+	if err := c.collectPages(root["Pages"], Dict{}, make(map[int]bool), &pages); err != nil {
+		return nil, err
+	}
+
+	// 先为全部页面分配编号，注释等对象中的页面引用指向新页面
+	refs := make([]Ref, len(pages))
+	for i, page := range pages {
+		ref := pw.alloc()
+		if page.num >= 0 {
+			c.refs[page.num] = ref
+		}
+		refs[i] = ref
+	}
+	for i, page := range pages {
+		dict := make(Dict, len(page.dict))
+		for k, v := range page.dict {
+			if k != "Parent" {
+				dict[k] = c.convert(v)
+			}
+		}
+		dict["Parent"] = parent
+		if err := pw.writeObject(refs[i], dict); err != nil {
+			return nil, err
+		}
+	}
+	for len(c.pending) > 0 {
+		num := c.pending[0]
+		c.pending = c.pending[1:]
+		obj, _ := doc.resolveNum(num)
+		if err := pw.writeObject(c.refs[num], c.convert(obj)); err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+// collectPages 按顺序收集页面，补充从页面树继承的属性
+func (c *copier) collectPages(obj Object, inherited Dict, visited map[int]bool, pages *[]pageEntry) error {
+	num := -1
+	if ref, ok := obj.(Ref); ok {
+		if visited[ref.Num] {
+			return errors.New("页面树存在循环")
+		}
+		visited[ref.Num] = true
+		num = ref.Num
+	}
+	node, ok := c.doc.resolve(obj).(Dict)
+	if !ok {
+		return nil
+	}
+
+	if kids, ok := c.doc.resolve(node["Kids"]).(Array); ok && node["Type"] != Name("Page") {
+		next := make(Dict, len(inherited))
+		for k, v := range inherited {
+			next[k] = v
+		}
+		for _, key := range inheritedKeys {
+			if v, ok := node[key]; ok {
+				next[key] = v
+			}
+		}
+		for _, kid := range kids {
+			if err := c.collectPages(kid, next, visited, pages); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	page := make(Dict, len(node)+len(inherited))
+	for k, v := range node {
+		page[k] = v
+	}
+	for k, v := range inherited {
+		if _, ok := page[k]; !ok {
+			page[k] = v
+		}
+	}
+	if _, ok := page["MediaBox"]; !ok {
+		page["MediaBox"] = defaultMediaBox
+	}
+	*pages = append(*pages, pageEntry{num: num, dict: page})
+	return nil
+}
+
+// mapRef 引用改为新编号，首次遇到时加入待写入队列；不存在的对象和原页面树节点改为 null
+func (c *copier) mapRef(ref Ref) Object {
+	if newRef, ok := c.refs[ref.Num]; ok {
+		return newRef
+	}
+	obj, err := c.doc.resolveNum(ref.Num)
+	if err != nil || obj == nil {
+		return Null{}
+	}
+	if dict, ok := obj.(Dict); ok && dict["Type"] == Name("Pages") {
+		return Null{}
+	}
+	newRef := c.pw.alloc()
+	c.refs[ref.Num] = newRef
+	c.pending = append(c.pending, ref.Num)
+	return newRef
+}
+
+// convert 复制对象并替换其中的引用
+func (c *copier) convert(obj Object) Object {
+	switch v := obj.(type) {
+	case Ref:
+		return c.mapRef(v)
+	case Array:
+		array := make(Array, len(v))
+		for i, item := range v {
+			array[i] = c.convert(item)
+		}
+		return array
+	case Dict:
+		dict := make(Dict, len(v))
+		for k, item := range v {
+			dict[k] = c.convert(item)
+		}
+		return dict
+	case Stream:
+		dict := make(Dict, len(v.Dict))
+		for k, item := range v.Dict {
+			// 写入时按数据重新计算长度
+			if k != "Length" {
+				dict[k] = c.convert(item)
+			}
+		}
+		return Stream{Dict: dict, Data: v.Data}
+	case nil:
+		return Null{}
+	}
+	return obj
+}
@@ -0,0 +1,126 @@
+package pdf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestPDF 保存为 dir 中的 name
+func writeTestPDF(t *testing.T, b *testPDF, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, b.buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+
+	// 两页，页面大小从页面树继承
+	a := newTestPDF()
+	a.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	a.object(2, "<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 100 200] >>")
+	a.object(3, "<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>")
+	a.object(4, "<< /Type /Page /Parent 2 0 R >>")
+	a.stream(5, "", []byte("0 0 m 10 10 l S"))
+	a.startxref(a.xrefTable([]int{1, 2, 3, 4, 5}, "<< /Size 6 /Root 1 0 R >>"))
+
+	// 一页，使用交叉引用流和对象流
+	b := newTestPDF()
+	b.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	b.object(2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	b.stream(4, "/Type /ObjStm /N 1 /First 4", []byte("3 0 << /Type /Page /Parent 2 0 R /MediaBox [0 0 300 400] >>"))
+	b.startxref(b.xrefStream(5, []int{1, 2, 4}, map[int][2]int{3: {4, 0}}, "/Size 6 /Root 1 0 R"))
+
+	sources := []Source{
+		{Path: writeTestPDF(t, a, dir, "a.pdf"), Title: "第一课"},
+		{Path: writeTestPDF(t, b, dir, "b.pdf"), Title: "第二课"},
+	}
+	dstPath := filepath.Join(dir, "merged.pdf")
+	if err := Merge(sources, dstPath, "合并"); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := openDocument(dstPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.rebuilt {
+		t.Fatal("merged file should have a valid xref table")
+	}
+	root, _ := doc.resolve(doc.trailer["Root"]).(Dict)
+	pages, _ := doc.resolve(root["Pages"]).(Dict)
+	kids, _ := pages["Kids"].(Array)
+	if len(kids) != 3 || pages["Count"] != Integer(3) {
+		t.Fatalf("pages = %v, want 3 kids", pages)
+	}
+	wantBoxes := []Integer{200, 200, 400}
+	for i, kid := range kids {
+		page, _ := doc.resolve(kid).(Dict)
+		if page["Parent"] != root["Pages"] {
+			t.Errorf("page %d parent = %v, want %v", i, page["Parent"], root["Pages"])
+		}
+		if box, _ := page["MediaBox"].(Array); len(box) != 4 || box[3] != wantBoxes[i] {
+			t.Errorf("page %d MediaBox = %v, want height %d", i, page["MediaBox"], wantBoxes[i])
+		}
+	}
+	first, _ := doc.resolve(kids[0]).(Dict)
+	if contents, ok := doc.resolve(first["Contents"]).(Stream); !ok || string(contents.Data) != "0 0 m 10 10 l S" {
+		t.Errorf("page 1 contents = %v", first["Contents"])
+	}
+
+	// 每个文件一个书签，指向其首页
+	outlines, _ := doc.resolve(root["Outlines"]).(Dict)
+	if outlines["Count"] != Integer(2) {
+		t.Fatalf("outlines = %v, want 2 entries", outlines)
+	}
+	wantMarks := []struct {
+		title string
+		page  Object
+	}{
+		{"第一课", kids[0]},
+		{"第二课", kids[2]},
+	}
+	item, last := outlines["First"], Object(nil)
+	for i, want := range wantMarks {
+		mark, ok := doc.resolve(item).(Dict)
+		if !ok {
+			t.Fatalf("outline %d missing", i)
+		}
+		if mark["Title"] != textString(want.title) {
+			t.Errorf("outline %d title = %q, want %q", i, mark["Title"], want.title)
+		}
+		if dest, _ := mark["Dest"].(Array); len(dest) == 0 || dest[0] != want.page {
+			t.Errorf("outline %d dest = %v, want page %v", i, mark["Dest"], want.page)
+		}
+		last, item = item, mark["Next"]
+	}
+	if item != nil {
+		t.Errorf("unexpected outline after last entry: %v", item)
+	}
+	if outlines["Last"] != last {
+		t.Errorf("outlines Last = %v", outlines["Last"])
+	}
+	info, _ := doc.resolve(doc.trailer["Info"]).(Dict)
+	if info["Title"] != textString("合并") {
+		t.Errorf("info title = %q", info["Title"])
+	}
+}
+
+func TestMergeInvalidSource(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.pdf")
+	if err := os.WriteFile(bad, []byte("not a pdf"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dstPath := filepath.Join(dir, "merged.pdf")
+	if err := Merge([]Source{{Path: bad, Title: "bad"}}, dstPath, "合并"); err == nil {
+		t.Fatal("expected error for invalid source")
+	}
+	if _, err := os.Stat(dstPath); !os.IsNotExist(err) {
+		t.Fatalf("dst should be removed on failure, stat err = %v", err)
+	}
+}
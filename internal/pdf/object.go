@@ -0,0 +1,319 @@
+// Package pdf 按顺序合并多个 PDF 文件并为每个文件添加书签，不依赖外部工具
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// PDF 对象：Name、String、Integer、Real、Boolean、Null、Array、Dict、Ref、Stream
+type Object any
+
+type (
+	Name    string
+	String  string // 原始字节
+	Integer int64
+	Real    string // 保留原始写法
+	Boolean bool
+	Null    struct{}
+	Array   []Object
+	Dict    map[Name]Object
+)
+
+// Ref 间接对象引用
+type Ref struct {
+	Num int
+	Gen int
+}
+
+// Stream 流对象，Data 为未解码的原始数据
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+func isWhite(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isRegular(c byte) bool {
+	return !isWhite(c) && !isDelim(c)
+}
+
+// parser 读取 PDF 对象的词法分析
+type parser struct {
+	data []byte
+	pos  int
+}
+
+// skipSpace 跳过空白和注释
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if isWhite(c) {
+			p.pos++
+		} else if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// readKeyword 读取连续的普通字符，如 obj、stream、true
+func (p *parser) readKeyword() string {
+	start := p.pos
+	for p.pos < len(p.data) && isRegular(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// readInt 读取非负整数，不是整数时恢复位置
+func (p *parser) readInt() (int, bool) {
+	start := p.pos
+	p.skipSpace()
+	word := p.readKeyword()
+	n, err := strconv.Atoi(word)
+	if err != nil || n < 0 {
+		p.pos = start
+		return 0, false
+	}
+	return n, true
+}
+
+func (p *parser) readObject() (Object, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	c := p.data[p.pos]
+	switch {
+	case c == '/':
+		return p.readName(), nil
+	case c == '(':
+		return p.readLiteral()
+	case c == '<':
+		if p.pos+1 < len(p.data) && p.data[p.pos+1] == '<' {
+			return p.readDict()
+		}
+		return p.readHex()
+	case c == '[':
+		return p.readArray()
+	case c == '+' || c == '-' || c == '.' || c >= '0' && c <= '9':
+		return p.readNumber()
+	}
+	start := p.pos
+	switch word := p.readKeyword(); word {
+	case "true":
+		return Boolean(true), nil
+	case "false":
+		return Boolean(false), nil
+	case "null":
+		return Null{}, nil
+	case "":
+		p.pos++
+		return nil, fmt.Errorf("unexpected %q at %d", c, start)
+	default:
+		return nil, fmt.Errorf("unexpected keyword %q at %d", word, start)
+	}
+}
+
+func (p *parser) readName() Name {
+	p.pos++ // '/'
+	var buf []byte
+	for p.pos < len(p.data) && isRegular(p.data[p.pos]) {
+		c := p.data[p.pos]
+		if c == '#' && p.pos+2 < len(p.data) {
+			if v, err := strconv.ParseUint(string(p.data[p.pos+1:p.pos+3]), 16, 8); err == nil {
+				buf = append(buf, byte(v))
+				p.pos += 3
+				continue
+			}
+		}
+		buf = append(buf, c)
+		p.pos++
+	}
+	return Name(buf)
+}
+
+func (p *parser) readLiteral() (Object, error) {
+	start := p.pos
+	p.pos++ // '('
+	var buf []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return String(buf), nil
+			}
+		case '\\':
+			if p.pos >= len(p.data) {
+				break
+			}
+			c = p.data[p.pos]
+			p.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// 续行
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+	return nil, fmt.Errorf("unterminated string at %d", start)
+}
+
+func (p *parser) readHex() (Object, error) {
+	start := p.pos
+	p.pos++ // '<'
+	var digits []byte
+	for p.pos < len(p.data) && p.data[p.pos] != '>' {
+		if c := p.data[p.pos]; !isWhite(c) {
+			digits = append(digits, c)
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.data) {
+		return nil, fmt.Errorf("unterminated hex string at %d", start)
+	}
+	p.pos++ // '>'
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	buf := make([]byte, len(digits)/2)
+	for i := range buf {
+		v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex string at %d", start)
+		}
+		buf[i] = byte(v)
+	}
+	return String(buf), nil
+}
+
+func (p *parser) readArray() (Object, error) {
+	p.pos++ // '['
+	var array Array
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if p.data[p.pos] == ']' {
+			p.pos++
+			return array, nil
+		}
+		obj, err := p.readObject()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, obj)
+	}
+}
+
+func (p *parser) readDict() (Object, error) {
+	p.pos += 2 // '<<'
+	dict := make(Dict)
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if bytes.HasPrefix(p.data[p.pos:], []byte(">>")) {
+			p.pos += 2
+			return dict, nil
+		}
+		if p.data[p.pos] != '/' {
+			return nil, fmt.Errorf("dict key expected at %d", p.pos)
+		}
+		key := p.readName()
+		value, err := p.readObject()
+		if err != nil {
+			return nil, err
+		}
+		dict[key] = value
+	}
+}
+
+// readNumber 读取数字，整数后为“gen R”时返回引用
+func (p *parser) readNumber() (Object, error) {
+	start := p.pos
+	word := p.readKeyword()
+	if n, err := strconv.ParseInt(word, 10, 64); err == nil {
+		if n >= 0 {
+			after := p.pos
+			if gen, ok := p.readInt(); ok {
+				p.skipSpace()
+				if p.pos < len(p.data) && p.data[p.pos] == 'R' && (p.pos+1 == len(p.data) || !isRegular(p.data[p.pos+1])) {
+					p.pos++
+					return Ref{Num: int(n), Gen: gen}, nil
+				}
+			}
+			p.pos = after
+		}
+		return Integer(n), nil
+	}
+	if _, err := strconv.ParseFloat(word, 64); err != nil {
+		return nil, fmt.Errorf("invalid number %q at %d", word, start)
+	}
+	return Real(word), nil
+}
+
+// toInt 整数或实数取整
+func toInt(obj Object) (int, bool) {
+	switch v := obj.(type) {
+	case Integer:
+		return int(v), true
+	case Real:
+		f, err := strconv.ParseFloat(string(v), 64)
+		return int(f), err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,167 @@
+package pdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"unicode/utf16"
+)
+
+// writer 顺序写入间接对象，最后写入交叉引用表
+type writer struct {
+	w       *bufio.Writer
+	offset  int64
+	offsets []int64 // 对象编号 - 1 → 偏移，0 表示尚未写入
+	err     error
+}
+
+func newWriter(w io.Writer) *writer {
+	pw := &writer{w: bufio.NewWriterSize(w, 256*1024)}
+	// 第二行的二进制字符提示这是二进制文件
+	pw.writeString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	return pw
+}
+
+func (pw *writer) write(p []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(p)
+	pw.offset += int64(n)
+	pw.err = err
+}
+
+func (pw *writer) writeString(s string) {
+	pw.write([]byte(s))
+}
+
+// alloc 分配对象编号，之后用 writeObject 写入
+func (pw *writer) alloc() Ref {
+	pw.offsets = append(pw.offsets, 0)
+	return Ref{Num: len(pw.offsets)}
+}
+
+func (pw *writer) writeObject(ref Ref, obj Object) error {
+	pw.offsets[ref.Num-1] = pw.offset
+	buf := fmt.Appendf(nil, "%d 0 obj\n", ref.Num)
+	if stream, ok := obj.(Stream); ok {
+		dict := make(Dict, len(stream.Dict)+1)
+		for k, v := range stream.Dict {
+			dict[k] = v
+		}
+		dict["Length"] = Integer(len(stream.Data))
+		buf = appendObject(buf, dict)
+		buf = append(buf, "\nstream\n"...)
+		pw.write(buf)
+		pw.write(stream.Data)
+		pw.writeString("\nendstream\nendobj\n")
+	} else {
+		buf = appendObject(buf, obj)
+		buf = append(buf, "\nendobj\n"...)
+		pw.write(buf)
+	}
+	return pw.err
+}
+
+// finish 写入交叉引用表和文件尾
+func (pw *writer) finish(root Ref, info Ref) error {
+	xrefOffset := pw.offset
+	buf := fmt.Appendf(nil, "xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1)
+	for num, offset := range pw.offsets {
+		if offset == 0 {
+			return fmt.Errorf("object %d not written", num+1)
+		}
+		buf = fmt.Appendf(buf, "%010d 00000 n \n", offset)
+	}
+	trailer := Dict{"Size": Integer(len(pw.offsets) + 1), "Root": root, "Info": info}
+	buf = append(buf, "trailer\n"...)
+	buf = appendObject(buf, trailer)
+	buf = fmt.Appendf(buf, "\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	pw.write(buf)
+	if pw.err != nil {
+		return pw.err
+	}
+	return pw.w.Flush()
+}
+
+func appendObject(buf []byte, obj Object) []byte {
+	switch v := obj.(type) {
+	case nil, Null:
+		return append(buf, "null"...)
+	case Boolean:
+		return strconv.AppendBool(buf, bool(v))
+	case Integer:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case Real:
+		return append(buf, v...)
+	case Name:
+		return appendName(buf, v)
+	case String:
+		return appendString(buf, v)
+	case Ref:
+		return fmt.Appendf(buf, "%d %d R", v.Num, v.Gen)
+	case Array:
+		buf = append(buf, '[')
+		for i, item := range v {
+			if i > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = appendObject(buf, item)
+		}
+		return append(buf, ']')
+	case Dict:
+		// 按键排序，输出稳定
+		keys := make([]Name, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		buf = append(buf, "<<"...)
+		for _, k := range keys {
+			buf = appendName(buf, k)
+			buf = append(buf, ' ')
+			buf = appendObject(buf, v[k])
+		}
+		return append(buf, ">>"...)
+	}
+	return append(buf, "null"...)
+}
+
+func appendName(buf []byte, name Name) []byte {
+	buf = append(buf, '/')
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '#' || c < '!' || c > '~' || isDelim(c) {
+			buf = fmt.Appendf(buf, "#%02x", c)
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+func appendString(buf []byte, s String) []byte {
+	buf = append(buf, '(')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '(', ')', '\\':
+			buf = append(buf, '\\', c)
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, ')')
+}
+
+// textString 书签标题等文本：UTF-16BE 并以 BOM 开头
+func textString(s string) String {
+	buf := []byte{0xfe, 0xff}
+	for _, u := range utf16.Encode([]rune(s)) {
+		buf = append(buf, byte(u>>8), byte(u))
+	}
+	return String(buf)
+}
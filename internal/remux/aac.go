@@ -0,0 +1,57 @@
+package remux
+
+// AAC 每帧采样数
+const aacFrameSamples = 1024
+
+var aacSampleRates = []int{
+	96000, 88200, 64000, 48000, 44100, 32000,
+	24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// adtsFrame 一帧AAC数据（不含ADTS头）
+type adtsFrame struct {
+	objectType byte
+	rateIndex  byte
+	channels   byte
+	data       []byte
+}
+
+// parseADTS 拆分PES负载中的ADTS帧，不完整的帧丢弃
+func parseADTS(data []byte) []adtsFrame {
+	var frames []adtsFrame
+	for len(data) >= 7 {
+		if data[0] != 0xFF || data[1]&0xF0 != 0xF0 {
+			data = data[1:] // 重新同步
+			continue
+		}
+		headerLength := 7
+		if data[1]&0x01 == 0 {
+			headerLength = 9 // 带CRC
+		}
+		frameLength := int(data[3]&0x03)<<11 | int(data[4])<<3 | int(data[5]>>5)
+		if frameLength < headerLength || frameLength > len(data) {
+			break
+		}
+		frames = append(frames, adtsFrame{
+			objectType: data[2]>>6 + 1,
+			rateIndex:  data[2] >> 2 & 0x0F,
+			channels:   data[2]&0x01<<2 | data[3]>>6,
+			data:       data[headerLength:frameLength],
+		})
+		data = data[frameLength:]
+	}
+	return frames
+}
+
+// audioSpecificConfig 写入 esds 的 AudioSpecificConfig
+func (f adtsFrame) audioSpecificConfig() []byte {
+	config := uint16(f.objectType)<<11 | uint16(f.rateIndex)<<7 | uint16(f.channels)<<3
+	return []byte{byte(config >> 8), byte(config)}
+}
+
+func (f adtsFrame) sampleRate() int {
+	if int(f.rateIndex) < len(aacSampleRates) {
+		return aacSampleRates[f.rateIndex]
+	}
+	return 0
+}
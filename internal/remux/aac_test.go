@@ -0,0 +1,90 @@
+package remux
+
+import (
+	"bytes"
+	"testing"
+)
+
+// adtsHeader 构造 ADTS 头，crc 时为9字节
+func adtsHeader(objectType, rateIndex, channels byte, payloadLength int, crc bool) []byte {
+	headerLength := 7
+	protectionAbsent := byte(1)
+	if crc {
+		headerLength, protectionAbsent = 9, 0
+	}
+	frameLength := payloadLength + headerLength
+	header := []byte{
+		0xFF, 0xF0 | protectionAbsent,
+		(objectType-1)<<6 | rateIndex<<2 | channels>>2,
+		channels&0x03<<6 | byte(frameLength>>11),
+		byte(frameLength >> 3),
+		byte(frameLength)<<5 | 0x1F,
+		0xFC,
+	}
+	if crc {
+		header = append(header, 0, 0)
+	}
+	return header
+}
+
+func adtsFrameData(objectType, rateIndex, channels byte, payload []byte, crc bool) []byte {
+	return append(adtsHeader(objectType, rateIndex, channels, len(payload), crc), payload...)
+}
+
+func TestParseADTS(t *testing.T) {
+	a, b := bytes.Repeat([]byte{0xA1}, 10), bytes.Repeat([]byte{0xB2}, 300)
+	tests := []struct {
+		name string
+		data []byte
+		want [][]byte
+	}{
+		{"two frames", concat(adtsFrameData(2, 4, 2, a, false), adtsFrameData(2, 4, 2, b, false)), [][]byte{a, b}},
+		{"with crc", adtsFrameData(2, 4, 2, a, true), [][]byte{a}},
+		{"resync after garbage", concat([]byte{0x00, 0xFF, 0x12}, adtsFrameData(2, 4, 2, a, false)), [][]byte{a}},
+		{"truncated last frame", concat(adtsFrameData(2, 4, 2, a, false), adtsFrameData(2, 4, 2, b, false)[:100]), [][]byte{a}},
+		{"too short", []byte{0xFF, 0xF1, 0x50}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := parseADTS(tt.data)
+			if len(frames) != len(tt.want) {
+				t.Fatalf("got %d frames, want %d", len(frames), len(tt.want))
+			}
+			for i, frame := range frames {
+				if !bytes.Equal(frame.data, tt.want[i]) {
+					t.Errorf("frame %d = % x, want % x", i, frame.data, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestADTSConfig(t *testing.T) {
+	tests := []struct {
+		objectType, rateIndex, channels byte
+		sampleRate                      int
+		config                          []byte
+	}{
+		{2, 4, 2, 44100, []byte{0x12, 0x10}}, // AAC-LC 44.1kHz 立体声
+		{2, 3, 1, 48000, []byte{0x11, 0x88}}, // AAC-LC 48kHz 单声道
+		{1, 8, 2, 16000, []byte{0x0C, 0x10}}, // AAC Main 16kHz
+		{2, 13, 2, 0, []byte{0x16, 0x90}},    // 保留的采样率
+	}
+	for _, tt := range tests {
+		frames := parseADTS(adtsFrameData(tt.objectType, tt.rateIndex, tt.channels, []byte{1, 2, 3}, false))
+		if len(frames) != 1 {
+			t.Fatalf("got %d frames", len(frames))
+		}
+		frame := frames[0]
+		if frame.objectType != tt.objectType || frame.rateIndex != tt.rateIndex || frame.channels != tt.channels {
+			t.Errorf("frame = %d/%d/%d, want %d/%d/%d", frame.objectType, frame.rateIndex, frame.channels,
+				tt.objectType, tt.rateIndex, tt.channels)
+		}
+		if frame.sampleRate() != tt.sampleRate {
+			t.Errorf("sampleRate = %d, want %d", frame.sampleRate(), tt.sampleRate)
+		}
+		if config := frame.audioSpecificConfig(); !bytes.Equal(config, tt.config) {
+			t.Errorf("config = % x, want % x", config, tt.config)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package remux
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+)
+
+const (
+	nalTypeIDR = 5
+	nalTypeSPS = 7
+	nalTypePPS = 8
+	nalTypeAUD = 9
+)
+
+// splitNALUnits 按起始码 00 00 01 / 00 00 00 01 拆分 Annex-B 数据
+func splitNALUnits(data []byte) [][]byte {
+	var nalus [][]byte
+	appendNAL := func(nal []byte) {
+		for len(nal) > 0 && nal[len(nal)-1] == 0 {
+			nal = nal[:len(nal)-1] // 下一个4字节起始码的前导0
+		}
+		if len(nal) > 0 {
+			nalus = append(nalus, nal)
+		}
+	}
+
+	start := -1
+	for i := 0; i+2 < len(data); {
+		if data[i] == 0 && data[i+1] == 0 && data[i+2] == 1 {
+			if start >= 0 {
+				appendNAL(data[start:i])
+			}
+			i += 3
+			start = i
+			continue
+		}
+		i++
+	}
+	if start >= 0 {
+		appendNAL(data[start:])
+	}
+	return nalus
+}
+
+// avcSample 一帧视频：长度前缀格式的NAL，以及SPS/PPS
+type avcSample struct {
+	data []byte
+	key  bool
+	sps  []byte
+	pps  []byte
+}
+
+// annexBToAVC 转换为 MP4 使用的4字节长度前缀格式，去掉AUD、SPS、PPS（写入avcC）
+func annexBToAVC(payload []byte) avcSample {
+	var sample avcSample
+	for _, nal := range splitNALUnits(payload) {
+		switch nal[0] & 0x1F {
+		case nalTypeAUD:
+			continue
+		case nalTypeSPS:
+			sample.sps = nal
+			continue
+		case nalTypePPS:
+			sample.pps = nal
+			continue
+		case nalTypeIDR:
+			sample.key = true
+		}
+		sample.data = binary.BigEndian.AppendUint32(sample.data, uint32(len(nal)))
+		sample.data = append(sample.data, nal...)
+	}
+	return sample
+}
+
+// spsInfo SPS中的编码参数和画面尺寸
+type spsInfo struct {
+	profile       byte
+	compatibility byte
+	level         byte
+	width         int
+	height        int
+}
+
+// 带 chroma_format_idc 等扩展字段的 profile
+var highProfiles = []byte{100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135}
+
+// parseSPS 解析画面尺寸
+func parseSPS(nal []byte) (spsInfo, error) {
+	var info spsInfo
+	if len(nal) < 4 {
+		return info, fmt.Errorf("SPS 数据过短")
+	}
+	rbsp := removeEmulationPrevention(nal[1:])
+	info.profile, info.compatibility, info.level = rbsp[0], rbsp[1], rbsp[2]
+
+	br := &bitReader{data: rbsp[3:]}
+	br.ue() // seq_parameter_set_id
+	chromaFormat := uint(1)
+	if slices.Contains(highProfiles, info.profile) {
+		chromaFormat = br.ue()
+		if chromaFormat == 3 {
+			br.bit() // separate_colour_plane_flag
+		}
+		br.ue()  // bit_depth_luma_minus8
+		br.ue()  // bit_depth_chroma_minus8
+		br.bit() // qpprime_y_zero_transform_bypass_flag
+		if br.bit() == 1 {
+			count := 8
+			if chromaFormat == 3 {
+				count = 12
+			}
+			for i := range count {
+				if br.bit() == 1 {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					skipScalingList(br, size)
+				}
+			}
+		}
+	}
+
+	br.ue() // log2_max_frame_num_minus4
+	switch br.ue() {
+	case 0:
+		br.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		br.bit() // delta_pic_order_always_zero_flag
+		br.se()  // offset_for_non_ref_pic
+		br.se()  // offset_for_top_to_bottom_field
+		for range br.ue() {
+			br.se()
+		}
+	}
+	br.ue()  // max_num_ref_frames
+	br.bit() // gaps_in_frame_num_value_allowed_flag
+
+	widthMbs := br.ue() + 1
+	heightMapUnits := br.ue() + 1
+	frameMbsOnly := br.bit()
+	if frameMbsOnly == 0 {
+		br.bit() // mb_adaptive_frame_field_flag
+	}
+	br.bit() // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom uint
+	if br.bit() == 1 {
+		cropLeft, cropRight, cropTop, cropBottom = br.ue(), br.ue(), br.ue(), br.ue()
+	}
+	if br.err != nil {
+		return info, fmt.Errorf("解析 SPS 失败: %w", br.err)
+	}
+
+	cropUnitX, cropUnitY := uint(1), 2-frameMbsOnly
+	if chromaFormat != 0 {
+		subWidth, subHeight := uint(1), uint(1)
+		if chromaFormat == 1 || chromaFormat == 2 {
+			subWidth = 2
+		}
+		if chromaFormat == 1 {
+			subHeight = 2
+		}
+		cropUnitX, cropUnitY = subWidth, subHeight*(2-frameMbsOnly)
+	}
+	info.width = int(widthMbs*16 - (cropLeft+cropRight)*cropUnitX)
+	info.height = int((2-frameMbsOnly)*heightMapUnits*16 - (cropTop+cropBottom)*cropUnitY)
+	if info.width <= 0 || info.height <= 0 {
+		return info, fmt.Errorf("SPS 画面尺寸异常: %dx%d", info.width, info.height)
+	}
+	return info, nil
+}
+
+func skipScalingList(br *bitReader, size int) {
+	last, next := 8, 8
+	for range size {
+		if next != 0 {
+			next = (last + br.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// removeEmulationPrevention 去掉防竞争字节 00 00 03 中的 03
+func removeEmulationPrevention(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// bitReader 按位读取，越界后 err 非空并返回0
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (br *bitReader) bit() uint {
+	if br.pos >= len(br.data)*8 {
+		br.err = fmt.Errorf("数据不足")
+		return 0
+	}
+	b := br.data[br.pos/8] >> (7 - br.pos%8) & 1
+	br.pos++
+	return uint(b)
+}
+
+func (br *bitReader) bits(n int) uint {
+	var v uint
+	for range n {
+		v = v<<1 | br.bit()
+	}
+	return v
+}
+
+// ue 无符号指数哥伦布编码
+func (br *bitReader) ue() uint {
+	zeros := 0
+	for br.bit() == 0 {
+		if br.err != nil || zeros >= 31 {
+			br.err = fmt.Errorf("指数哥伦布编码异常")
+			return 0
+		}
+		zeros++
+	}
+	return 1<<zeros - 1 + br.bits(zeros)
+}
+
+// se 有符号指数哥伦布编码
+func (br *bitReader) se() int {
+	v := br.ue()
+	if v%2 == 1 {
+		return int(v+1) / 2
+	}
+	return -int(v / 2)
+}
@@ -0,0 +1,184 @@
+package remux
+
+import (
+	"bytes"
+	"testing"
+)
+
+// bitWriter 按位写入，用于构造 SPS
+type bitWriter struct {
+	buf  []byte
+	nbit int
+}
+
+func (w *bitWriter) bit(b uint) {
+	if w.nbit%8 == 0 {
+		w.buf = append(w.buf, 0)
+	}
+	if b != 0 {
+		w.buf[len(w.buf)-1] |= 1 << (7 - w.nbit%8)
+	}
+	w.nbit++
+}
+
+func (w *bitWriter) bits(v uint, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bit(v >> i & 1)
+	}
+}
+
+// ue 无符号指数哥伦布编码
+func (w *bitWriter) ue(v uint) {
+	v++
+	n := 0
+	for t := v; t > 1; t >>= 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(v, n+1)
+}
+
+// se 有符号指数哥伦布编码
+func (w *bitWriter) se(v int) {
+	if v > 0 {
+		w.ue(uint(2*v - 1))
+	} else {
+		w.ue(uint(-2 * v))
+	}
+}
+
+// spsFields 构造 SPS 的参数
+type spsFields struct {
+	profile      byte
+	widthMbs     uint
+	heightUnits  uint
+	frameMbsOnly bool
+	pocType      uint
+	crop         [4]uint // 左、右、上、下
+}
+
+// buildSPS 构造 SPS NAL（含 NAL 头），high profile 使用 4:2:0、8 位且没有缩放矩阵
+func buildSPS(f spsFields) []byte {
+	w := &bitWriter{}
+	w.ue(0) // seq_parameter_set_id
+	if f.profile == 100 {
+		w.ue(1)  // chroma_format_idc
+		w.ue(0)  // bit_depth_luma_minus8
+		w.ue(0)  // bit_depth_chroma_minus8
+		w.bit(0) // qpprime_y_zero_transform_bypass_flag
+		w.bit(0) // seq_scaling_matrix_present_flag
+	}
+	w.ue(0) // log2_max_frame_num_minus4
+	w.ue(f.pocType)
+	switch f.pocType {
+	case 0:
+		w.ue(2) // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		w.bit(0) // delta_pic_order_always_zero_flag
+		w.se(-1) // offset_for_non_ref_pic
+		w.se(2)  // offset_for_top_to_bottom_field
+		w.ue(2)  // num_ref_frames_in_pic_order_cnt_cycle
+		w.se(3)
+		w.se(-4)
+	}
+	w.ue(4)  // max_num_ref_frames
+	w.bit(0) // gaps_in_frame_num_value_allowed_flag
+	w.ue(f.widthMbs - 1)
+	w.ue(f.heightUnits - 1)
+	if f.frameMbsOnly {
+		w.bit(1)
+	} else {
+		w.bit(0)
+		w.bit(1) // mb_adaptive_frame_field_flag
+	}
+	w.bit(1) // direct_8x8_inference_flag
+	if f.crop != [4]uint{} {
+		w.bit(1)
+		for _, v := range f.crop {
+			w.ue(v)
+		}
+	} else {
+		w.bit(0)
+	}
+	w.bit(0) // vui_parameters_present_flag
+	w.bit(1) // rbsp_stop_one_bit
+	return append([]byte{0x67, f.profile, 0, 40}, w.buf...)
+}
+
+func TestParseSPS(t *testing.T) {
+	tests := []struct {
+		name          string
+		fields        spsFields
+		width, height int
+	}{
+		{"baseline 720p", spsFields{profile: 66, widthMbs: 80, heightUnits: 45, frameMbsOnly: true}, 1280, 720},
+		{"high 1080p cropped", spsFields{profile: 100, widthMbs: 120, heightUnits: 68, frameMbsOnly: true, crop: [4]uint{0, 0, 0, 4}}, 1920, 1080},
+		{"main interlaced poc type 1", spsFields{profile: 77, widthMbs: 45, heightUnits: 18, pocType: 1}, 720, 576},
+		{"interlaced cropped", spsFields{profile: 77, widthMbs: 45, heightUnits: 18, crop: [4]uint{4, 4, 0, 2}}, 704, 568},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseSPS(buildSPS(tt.fields))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.profile != tt.fields.profile || info.level != 40 {
+				t.Errorf("profile/level = %d/%d, want %d/40", info.profile, info.level, tt.fields.profile)
+			}
+			if info.width != tt.width || info.height != tt.height {
+				t.Errorf("size = %dx%d, want %dx%d", info.width, info.height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestParseSPSInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		nal  []byte
+	}{
+		{"too short", []byte{0x67, 66, 0}},
+		{"truncated", buildSPS(spsFields{profile: 66, widthMbs: 80, heightUnits: 45, frameMbsOnly: true})[:5]},
+	}
+	for _, tt := range tests {
+		if _, err := parseSPS(tt.nal); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestRemoveEmulationPrevention(t *testing.T) {
+	tests := []struct {
+		in, want []byte
+	}{
+		{[]byte{1, 0, 0, 3, 1}, []byte{1, 0, 0, 1}},
+		{[]byte{0, 0, 3, 0, 0, 3, 0}, []byte{0, 0, 0, 0, 0}},
+		{[]byte{0, 3, 0, 0, 3}, []byte{0, 3, 0, 0}},
+		{[]byte{0, 0, 4, 3}, []byte{0, 0, 4, 3}},
+	}
+	for _, tt := range tests {
+		if got := removeEmulationPrevention(tt.in); !bytes.Equal(got, tt.want) {
+			t.Errorf("removeEmulationPrevention(% x) = % x, want % x", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAnnexBToAVC(t *testing.T) {
+	sps := buildSPS(spsFields{profile: 66, widthMbs: 80, heightUnits: 45, frameMbsOnly: true})
+	pps := []byte{0x68, 0xCE, 0x3C, 0x80}
+	idr := []byte{0x65, 0x88, 0x84}
+	var payload []byte
+	for _, nal := range [][]byte{{0x09, 0xF0}, sps, pps, idr} {
+		payload = append(payload, 0, 0, 0, 1)
+		payload = append(payload, nal...)
+	}
+
+	sample := annexBToAVC(payload)
+	if !sample.key || !bytes.Equal(sample.sps, sps) || !bytes.Equal(sample.pps, pps) {
+		t.Fatalf("sample = %+v", sample)
+	}
+	want := append([]byte{0, 0, 0, byte(len(idr))}, idr...)
+	if !bytes.Equal(sample.data, want) {
+		t.Fatalf("data = % x, want % x", sample.data, want)
+	}
+}
@@ -0,0 +1,367 @@
+package remux
+
+import (
+	"bufio"
+	"encoding/binary"
+	"math"
+	"os"
+)
+
+const movieTimescale = 1000
+
+// mp4Track 一条音频或视频轨道的采样信息
+type mp4Track struct {
+	id        uint32
+	handler   string // vide / soun
+	timescale uint32
+
+	sizes      []uint32
+	dts        []int64
+	ctsOffsets []int64
+	keys       []bool
+	startTime  int64 // 首帧显示时间（90kHz），用于音视频对齐
+
+	chunkOffsets    []uint64
+	samplesPerChunk []uint32
+
+	// 视频
+	width, height int
+	sps, pps      []byte
+	spsInfo       spsInfo
+
+	// 音频
+	config     []byte
+	channels   int
+	sampleRate int
+}
+
+// mp4Writer 写入普通（非分片）MP4：ftyp + mdat + moov
+type mp4Writer struct {
+	file      *os.File
+	w         *bufio.Writer
+	offset    uint64
+	mdatStart uint64
+	lastTrack *mp4Track
+	tracks    []*mp4Track
+}
+
+func newMP4Writer(file *os.File) (*mp4Writer, error) {
+	mw := &mp4Writer{file: file, w: bufio.NewWriterSize(file, 1<<20)}
+	ftyp := box("ftyp", []byte("isom"), u32(512), []byte("isomiso2avc1mp41"))
+	if err := mw.write(ftyp); err != nil {
+		return nil, err
+	}
+	// mdat 使用64位大小，结束时回写
+	mw.mdatStart = mw.offset
+	if err := mw.write(u32(1), []byte("mdat"), u64(0)); err != nil {
+		return nil, err
+	}
+	return mw, nil
+}
+
+func (mw *mp4Writer) write(parts ...[]byte) error {
+	for _, part := range parts {
+		n, err := mw.w.Write(part)
+		mw.offset += uint64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mw *mp4Writer) addTrack(handler string, timescale uint32) *mp4Track {
+	track := &mp4Track{id: uint32(len(mw.tracks) + 1), handler: handler, timescale: timescale}
+	mw.tracks = append(mw.tracks, track)
+	return track
+}
+
+// writeSample 写入一帧数据，连续写入同一轨道的帧合并为一个 chunk
+func (mw *mp4Writer) writeSample(track *mp4Track, data []byte, dts int64, ctsOffset int64, key bool) error {
+	if mw.lastTrack != track {
+		track.chunkOffsets = append(track.chunkOffsets, mw.offset)
+		track.samplesPerChunk = append(track.samplesPerChunk, 0)
+		mw.lastTrack = track
+	}
+	track.samplesPerChunk[len(track.samplesPerChunk)-1]++
+	track.sizes = append(track.sizes, uint32(len(data)))
+	track.dts = append(track.dts, dts)
+	track.ctsOffsets = append(track.ctsOffsets, ctsOffset)
+	track.keys = append(track.keys, key)
+	return mw.write(data)
+}
+
+// finish 回写 mdat 大小并写入 moov
+func (mw *mp4Writer) finish() error {
+	if err := mw.w.Flush(); err != nil {
+		return err
+	}
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], mw.offset-mw.mdatStart)
+	if _, err := mw.file.WriteAt(size[:], int64(mw.mdatStart)+8); err != nil {
+		return err
+	}
+	if err := mw.write(mw.moov()); err != nil {
+		return err
+	}
+	return mw.w.Flush()
+}
+
+// durations 每帧时长，最后一帧沿用前一帧
+func (t *mp4Track) durations() []uint32 {
+	durations := make([]uint32, len(t.dts))
+	for i := range t.dts {
+		var d int64
+		if i+1 < len(t.dts) {
+			d = t.dts[i+1] - t.dts[i]
+		} else if i > 0 {
+			d = int64(durations[i-1])
+		}
+		if d <= 0 && t.handler == "soun" {
+			d = aacFrameSamples
+		}
+		durations[i] = uint32(max(d, 0))
+	}
+	return durations
+}
+
+func (t *mp4Track) mediaDuration() uint64 {
+	var total uint64
+	for _, d := range t.durations() {
+		total += uint64(d)
+	}
+	return total
+}
+
+// movieStart 所有轨道中最早的显示时间
+func (mw *mp4Writer) movieStart() int64 {
+	start := int64(math.MaxInt64)
+	for _, t := range mw.tracks {
+		start = min(start, t.startTime)
+	}
+	return start
+}
+
+func (mw *mp4Writer) moov() []byte {
+	start := mw.movieStart()
+	var traks [][]byte
+	var movieDuration uint64
+	for _, t := range mw.tracks {
+		// 晚于最早轨道开始的部分用空白编辑段补齐，保证音视频同步
+		delay := uint64(max(t.startTime-start, 0)) * movieTimescale / 90000
+		duration := t.mediaDuration() * movieTimescale / uint64(t.timescale)
+		movieDuration = max(movieDuration, delay+duration)
+		traks = append(traks, t.trak(delay, duration))
+	}
+
+	mvhd := fullBox("mvhd", 0, 0,
+		u32(0), u32(0), u32(movieTimescale), u32(uint32(movieDuration)),
+		u32(0x00010000), u16(0x0100), make([]byte, 10),
+		matrix(), make([]byte, 24),
+		u32(uint32(len(mw.tracks)+1)))
+	return box("moov", append([][]byte{mvhd}, traks...)...)
+}
+
+func (t *mp4Track) trak(delay uint64, duration uint64) []byte {
+	var volume uint16
+	var width, height uint32
+	if t.handler == "soun" {
+		volume = 0x0100
+	} else {
+		width, height = uint32(t.width)<<16, uint32(t.height)<<16
+	}
+	tkhd := fullBox("tkhd", 0, 0x000003,
+		u32(0), u32(0), u32(t.id), u32(0), u32(uint32(delay+duration)),
+		make([]byte, 8), u16(0), u16(0), u16(volume), u16(0),
+		matrix(), u32(width), u32(height))
+
+	// 编辑列表：空白段 + 从首帧显示时间开始播放
+	var entries [][]byte
+	if delay > 0 {
+		entries = append(entries, u32(uint32(delay)), u32(math.MaxUint32), u32(0x00010000))
+	}
+	mediaTime := int64(0)
+	if len(t.ctsOffsets) > 0 {
+		mediaTime = t.ctsOffsets[0]
+		for i, offset := range t.ctsOffsets {
+			mediaTime = min(mediaTime, t.dts[i]-t.dts[0]+offset)
+		}
+	}
+	entries = append(entries, u32(uint32(duration)), u32(uint32(mediaTime)), u32(0x00010000))
+	elst := fullBox("elst", 0, 0, append([][]byte{u32(uint32(len(entries) / 3))}, entries...)...)
+
+	handlerName := "SoundHandler"
+	mediaHeader := fullBox("smhd", 0, 0, u16(0), u16(0))
+	if t.handler == "vide" {
+		handlerName = "VideoHandler"
+		mediaHeader = fullBox("vmhd", 0, 1, u16(0), make([]byte, 6))
+	}
+
+	mdhd := fullBox("mdhd", 0, 0,
+		u32(0), u32(0), u32(t.timescale), u32(uint32(t.mediaDuration())),
+		u16(0x55C4), u16(0)) // und
+	hdlr := fullBox("hdlr", 0, 0, u32(0), []byte(t.handler), make([]byte, 12), append([]byte(handlerName), 0))
+	dinf := box("dinf", fullBox("dref", 0, 0, u32(1), fullBox("url ", 0, 1)))
+	minf := box("minf", mediaHeader, dinf, t.stbl())
+
+	return box("trak", tkhd, box("edts", elst), box("mdia", mdhd, hdlr, minf))
+}
+
+func (t *mp4Track) stbl() []byte {
+	boxes := [][]byte{fullBox("stsd", 0, 0, u32(1), t.sampleEntry())}
+
+	// stts：相同时长合并
+	var stts [][]byte
+	var count uint32
+	durations := t.durations()
+	for i, d := range durations {
+		count++
+		if i+1 == len(durations) || durations[i+1] != d {
+			stts = append(stts, u32(count), u32(d))
+			count = 0
+		}
+	}
+	boxes = append(boxes, fullBox("stts", 0, 0, append([][]byte{u32(uint32(len(stts) / 2))}, stts...)...))
+
+	// ctts：存在B帧时写入
+	hasCTS := false
+	for _, offset := range t.ctsOffsets {
+		if offset != 0 {
+			hasCTS = true
+			break
+		}
+	}
+	if hasCTS {
+		var ctts [][]byte
+		count = 0
+		for i, offset := range t.ctsOffsets {
+			count++
+			if i+1 == len(t.ctsOffsets) || t.ctsOffsets[i+1] != offset {
+				ctts = append(ctts, u32(count), u32(uint32(max(offset, 0))))
+				count = 0
+			}
+		}
+		boxes = append(boxes, fullBox("ctts", 0, 0, append([][]byte{u32(uint32(len(ctts) / 2))}, ctts...)...))
+	}
+
+	// stss：关键帧，全部为关键帧时省略
+	if t.handler == "vide" {
+		var stss [][]byte
+		for i, key := range t.keys {
+			if key {
+				stss = append(stss, u32(uint32(i+1)))
+			}
+		}
+		if len(stss) < len(t.keys) {
+			boxes = append(boxes, fullBox("stss", 0, 0, append([][]byte{u32(uint32(len(stss)))}, stss...)...))
+		}
+	}
+
+	// stsc：每个 chunk 的帧数，相同的合并
+	var stsc [][]byte
+	for i, n := range t.samplesPerChunk {
+		if i == 0 || t.samplesPerChunk[i-1] != n {
+			stsc = append(stsc, u32(uint32(i+1)), u32(n), u32(1))
+		}
+	}
+	boxes = append(boxes, fullBox("stsc", 0, 0, append([][]byte{u32(uint32(len(stsc) / 3))}, stsc...)...))
+
+	stsz := [][]byte{u32(0), u32(uint32(len(t.sizes)))}
+	for _, size := range t.sizes {
+		stsz = append(stsz, u32(size))
+	}
+	boxes = append(boxes, fullBox("stsz", 0, 0, stsz...))
+
+	// 文件超过4GB时使用 co64
+	use64 := len(t.chunkOffsets) > 0 && t.chunkOffsets[len(t.chunkOffsets)-1] > math.MaxUint32
+	offsets := [][]byte{u32(uint32(len(t.chunkOffsets)))}
+	for _, offset := range t.chunkOffsets {
+		if use64 {
+			offsets = append(offsets, u64(offset))
+		} else {
+			offsets = append(offsets, u32(uint32(offset)))
+		}
+	}
+	if use64 {
+		boxes = append(boxes, fullBox("co64", 0, 0, offsets...))
+	} else {
+		boxes = append(boxes, fullBox("stco", 0, 0, offsets...))
+	}
+
+	return box("stbl", boxes...)
+}
+
+func (t *mp4Track) sampleEntry() []byte {
+	if t.handler == "soun" {
+		return box("mp4a",
+			make([]byte, 6), u16(1), // data_reference_index
+			make([]byte, 8), u16(uint16(t.channels)), u16(16), u16(0), u16(0),
+			u32(uint32(t.sampleRate)<<16),
+			t.esds())
+	}
+
+	avcC := box("avcC",
+		[]byte{1, t.spsInfo.profile, t.spsInfo.compatibility, t.spsInfo.level, 0xFF, 0xE1},
+		u16(uint16(len(t.sps))), t.sps,
+		[]byte{1}, u16(uint16(len(t.pps))), t.pps)
+	compressorName := make([]byte, 32)
+	return box("avc1",
+		make([]byte, 6), u16(1), // data_reference_index
+		make([]byte, 16), u16(uint16(t.width)), u16(uint16(t.height)),
+		u32(0x00480000), u32(0x00480000), u32(0), u16(1),
+		compressorName, u16(0x0018), u16(0xFFFF),
+		avcC)
+}
+
+// esds MPEG-4 音频描述：ES_Descriptor > DecoderConfigDescriptor > DecoderSpecificInfo
+func (t *mp4Track) esds() []byte {
+	decoderSpecific := descriptor(0x05, t.config)
+	decoderConfig := descriptor(0x04, concat(
+		[]byte{0x40, 0x15}, // AAC，音频流
+		[]byte{0, 0, 0}, u32(0), u32(0),
+		decoderSpecific))
+	slConfig := descriptor(0x06, []byte{0x02})
+	es := descriptor(0x03, concat(u16(0), []byte{0}, decoderConfig, slConfig))
+	return fullBox("esds", 0, 0, es)
+}
+
+func descriptor(tag byte, payload []byte) []byte {
+	// 长度使用4字节可变长编码
+	n := len(payload)
+	return concat([]byte{tag, byte(n>>21) | 0x80, byte(n>>14) | 0x80, byte(n>>7) | 0x80, byte(n) & 0x7F}, payload)
+}
+
+func matrix() []byte {
+	return concat(u32(0x00010000), u32(0), u32(0), u32(0), u32(0x00010000), u32(0), u32(0), u32(0), u32(0x40000000))
+}
+
+func box(typ string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+	out := make([]byte, 0, size)
+	out = binary.BigEndian.AppendUint32(out, uint32(size))
+	out = append(out, typ...)
+	for _, p := range payloads {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func fullBox(typ string, version byte, flags uint32, payloads ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{header}, payloads...)...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func u64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
@@ -0,0 +1,143 @@
+// Package remux 将 HLS 下载得到的 MPEG-TS（H.264/AAC）转封装为 MP4，不重新编码
+package remux
+
+import (
+	"errors"
+	"os"
+)
+
+// 视频时间戳跳变超过该值（90kHz）视为不连续，例如 EXT-X-DISCONTINUITY
+const maxTimestampGap = 10 * 90000
+
+// remuxer 转封装状态：视频、音频轨道按出现顺序添加
+type remuxer struct {
+	mw    *mp4Writer
+	video *mp4Track
+	audio *mp4Track
+
+	// 视频时间戳
+	lastRawDTS int64
+	lastDTS    int64
+	dtsOffset  int64
+	lastDur    int64
+	hasDTS     bool
+
+	// 音频以帧数计时
+	audioFrames int64
+}
+
+// Remux 读取 srcPath 的 MPEG-TS 文件，写入 dstPath（MP4）；失败时删除 dstPath
+func Remux(srcPath string, dstPath string) (err error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dstPath)
+		}
+	}()
+
+	mw, err := newMP4Writer(dst)
+	if err != nil {
+		return err
+	}
+	r := &remuxer{mw: mw, lastRawDTS: noTimestamp}
+	if err := demuxTS(src, r.onPES); err != nil {
+		return err
+	}
+	if r.video == nil && r.audio == nil {
+		return errors.New("未找到 H.264 视频或 AAC 音频")
+	}
+	if r.video == nil && r.hasDTS {
+		return errors.New("未找到 H.264 SPS/PPS")
+	}
+	return mw.finish()
+}
+
+func (r *remuxer) onPES(pes pesPacket) error {
+	switch pes.streamType {
+	case streamTypeH264:
+		return r.onVideo(pes)
+	case streamTypeAAC:
+		return r.onAudio(pes)
+	}
+	return nil
+}
+
+func (r *remuxer) onVideo(pes pesPacket) error {
+	if pes.dts == noTimestamp {
+		return nil
+	}
+	sample := annexBToAVC(pes.payload)
+
+	// 处理回绕和不连续：保持解码时间递增
+	dts := unwrapTimestamp(pes.dts, r.lastRawDTS)
+	ctsOffset := unwrapTimestamp(pes.pts, pes.dts) - pes.dts
+	r.lastRawDTS = dts
+	dts += r.dtsOffset
+	if r.hasDTS {
+		if gap := dts - r.lastDTS; gap <= 0 || gap > maxTimestampGap {
+			step := max(r.lastDur, 1)
+			r.dtsOffset += r.lastDTS + step - dts
+			dts = r.lastDTS + step
+		} else {
+			r.lastDur = gap
+		}
+	}
+	r.lastDTS = dts
+	r.hasDTS = true
+
+	if r.video == nil {
+		if sample.sps == nil || sample.pps == nil || !sample.key {
+			// 从第一个带参数集的关键帧开始
+			return nil
+		}
+		info, err := parseSPS(sample.sps)
+		if err != nil {
+			return err
+		}
+		r.video = r.mw.addTrack("vide", 90000)
+		r.video.sps, r.video.pps, r.video.spsInfo = sample.sps, sample.pps, info
+		r.video.width, r.video.height = info.width, info.height
+		r.video.startTime = dts + ctsOffset
+	}
+	if len(sample.data) == 0 {
+		return nil
+	}
+	r.video.startTime = min(r.video.startTime, dts+ctsOffset)
+	return r.mw.writeSample(r.video, sample.data, dts, ctsOffset, sample.key)
+}
+
+func (r *remuxer) onAudio(pes pesPacket) error {
+	for _, frame := range parseADTS(pes.payload) {
+		if r.audio == nil {
+			if pes.pts == noTimestamp || frame.sampleRate() == 0 {
+				return nil
+			}
+			r.audio = r.mw.addTrack("soun", uint32(frame.sampleRate()))
+			r.audio.config = frame.audioSpecificConfig()
+			r.audio.channels = int(frame.channels)
+			r.audio.sampleRate = frame.sampleRate()
+			r.audio.startTime = pes.pts
+			if r.video != nil {
+				r.audio.startTime = unwrapTimestamp(pes.pts, r.video.startTime)
+			}
+		}
+		dts := r.audioFrames * aacFrameSamples
+		r.audioFrames++
+		if err := r.mw.writeSample(r.audio, frame.data, dts, 0, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package remux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mp4Box 测试中解析的 box，data 不含头部
+type mp4Box struct {
+	typ    string
+	offset int // box 在父级数据中的起始位置
+	data   []byte
+}
+
+// readBoxes 解析连续的 box，支持64位大小
+func readBoxes(t *testing.T, data []byte) []mp4Box {
+	t.Helper()
+	var boxes []mp4Box
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 8 {
+			t.Fatalf("box header truncated at %d", pos)
+		}
+		size := uint64(binary.BigEndian.Uint32(data[pos:]))
+		typ := string(data[pos+4 : pos+8])
+		header := 8
+		if size == 1 {
+			size = binary.BigEndian.Uint64(data[pos+8:])
+			header = 16
+		}
+		if size < uint64(header) || uint64(pos)+size > uint64(len(data)) {
+			t.Fatalf("box %q size %d out of range at %d", typ, size, pos)
+		}
+		boxes = append(boxes, mp4Box{typ: typ, offset: pos, data: data[pos+header : pos+int(size)]})
+		pos += int(size)
+	}
+	return boxes
+}
+
+// childBox 查找路径上的子 box；skip 为各级 box 数据中子 box 之前的字节数
+func childBox(t *testing.T, data []byte, path ...string) []byte {
+	t.Helper()
+	skip := map[string]int{"stsd": 8, "avc1": 78, "mp4a": 28}
+	parent := ""
+	for _, typ := range path {
+		found := false
+		for _, b := range readBoxes(t, data[skip[parent]:]) {
+			if b.typ == typ {
+				data, found = b.data, true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("box %q not found in %q", typ, parent)
+		}
+		parent = typ
+	}
+	return data
+}
+
+// tableEntries 解析 full box 中计数后的 uint32 表
+func tableEntries(data []byte, countOffset int) []uint32 {
+	n := binary.BigEndian.Uint32(data[countOffset:])
+	entries := make([]uint32, n)
+	for i := range entries {
+		entries[i] = binary.BigEndian.Uint32(data[countOffset+4+4*i:])
+	}
+	return entries
+}
+
+// sampleOffsets 根据 stsc、stco 和 stsz 计算每帧在文件中的位置
+func sampleOffsets(t *testing.T, stbl []byte) []int {
+	t.Helper()
+	stsc := childBox(t, stbl, "stsc")
+	entries := int(binary.BigEndian.Uint32(stsc[4:])) // 每项为 first_chunk、samples_per_chunk、sample_description_index
+	chunks := tableEntries(childBox(t, stbl, "stco"), 4)
+	sizes := tableEntries(childBox(t, stbl, "stsz"), 8)
+	var offsets []int
+	sample := 0
+	for i, chunk := range chunks {
+		perChunk := uint32(0)
+		for j := range entries {
+			if binary.BigEndian.Uint32(stsc[8+12*j:]) <= uint32(i+1) {
+				perChunk = binary.BigEndian.Uint32(stsc[12+12*j:])
+			}
+		}
+		offset := int(chunk)
+		for range perChunk {
+			offsets = append(offsets, offset)
+			offset += int(sizes[sample])
+			sample++
+		}
+	}
+	if sample != len(sizes) {
+		t.Fatalf("stsc covers %d samples, stsz has %d", sample, len(sizes))
+	}
+	return offsets
+}
+
+// buildTestTS 3帧 720p 视频（首帧为带参数集的 IDR）和 4帧 AAC 音频
+func buildTestTS(videoNALs, audioFrames [][]byte) []byte {
+	sps := buildSPS(spsFields{profile: 66, widthMbs: 80, heightUnits: 45, frameMbsOnly: true})
+	pps := []byte{0x68, 0xCE, 0x3C, 0x80}
+	startCode := []byte{0, 0, 0, 1}
+	aud := []byte{0, 0, 0, 1, 0x09, 0xF0}
+
+	ts := concat(
+		tsPacketize(0, patPayload(0x1000)),
+		tsPacketize(0x1000, pmtPayload(0x100, [2]uint16{streamTypeH264, 0x100}, [2]uint16{streamTypeAAC, 0x101})),
+	)
+	for i, nal := range videoNALs {
+		au := aud
+		if i == 0 {
+			au = concat(au, startCode, sps, startCode, pps)
+		}
+		au = concat(au, startCode, nal)
+		dts := int64(i) * 3600
+		ts = append(ts, tsPacketize(0x100, buildPES(0xE0, dts+3600, dts, au))...)
+
+		// 每帧视频后跟两帧音频
+		var audio []byte
+		for _, payload := range audioFrames[2*i : min(2*i+2, len(audioFrames))] {
+			audio = append(audio, adtsFrameData(2, 4, 2, payload, false)...)
+		}
+		if len(audio) > 0 {
+			ts = append(ts, tsPacketize(0x101, buildPES(0xC0, dts+3600, noTimestamp, audio))...)
+		}
+	}
+	return ts
+}
+
+func TestRemux(t *testing.T) {
+	videoNALs := [][]byte{
+		append([]byte{0x65}, bytes.Repeat([]byte{0x88}, 300)...),
+		append([]byte{0x41}, bytes.Repeat([]byte{0x9A}, 50)...),
+		append([]byte{0x41}, bytes.Repeat([]byte{0x9B}, 40)...),
+	}
+	audioFrames := [][]byte{
+		bytes.Repeat([]byte{0x21}, 20),
+		bytes.Repeat([]byte{0x22}, 21),
+		bytes.Repeat([]byte{0x23}, 22),
+		bytes.Repeat([]byte{0x24}, 23),
+	}
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "a.ts"), filepath.Join(dir, "a.mp4")
+	if err := os.WriteFile(src, buildTestTS(videoNALs, audioFrames), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remux(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	top := readBoxes(t, data)
+	if len(top) != 3 || top[0].typ != "ftyp" || top[1].typ != "mdat" || top[2].typ != "moov" {
+		t.Fatalf("top-level boxes = %v, want ftyp mdat moov", top)
+	}
+	moov := top[2].data
+	var traks [][]byte
+	for _, b := range readBoxes(t, moov) {
+		if b.typ == "trak" {
+			traks = append(traks, b.data)
+		}
+	}
+	if len(traks) != 2 {
+		t.Fatalf("got %d traks, want 2", len(traks))
+	}
+
+	// 视频轨道
+	video := traks[0]
+	if handler := string(childBox(t, video, "mdia", "hdlr")[8:12]); handler != "vide" {
+		t.Fatalf("first trak handler = %q, want vide", handler)
+	}
+	stbl := childBox(t, video, "mdia", "minf", "stbl")
+	avc1 := childBox(t, stbl, "stsd", "avc1")
+	if w, h := binary.BigEndian.Uint16(avc1[24:]), binary.BigEndian.Uint16(avc1[26:]); w != 1280 || h != 720 {
+		t.Errorf("avc1 size = %dx%d, want 1280x720", w, h)
+	}
+	childBox(t, stbl, "stsd", "avc1", "avcC")
+	sizes := tableEntries(childBox(t, stbl, "stsz"), 8)
+	if len(sizes) != len(videoNALs) {
+		t.Fatalf("video samples = %d, want %d", len(sizes), len(videoNALs))
+	}
+	for i, nal := range videoNALs {
+		if sizes[i] != uint32(4+len(nal)) {
+			t.Errorf("video sample %d size = %d, want %d", i, sizes[i], 4+len(nal))
+		}
+	}
+	if keys := tableEntries(childBox(t, stbl, "stss"), 4); len(keys) != 1 || keys[0] != 1 {
+		t.Errorf("stss = %v, want [1]", keys)
+	}
+	mdatStart, mdatEnd := top[1].offset+16, top[2].offset
+	for i, offset := range sampleOffsets(t, stbl) {
+		want := concat(u32(uint32(len(videoNALs[i]))), videoNALs[i])
+		if offset < mdatStart || offset+len(want) > mdatEnd {
+			t.Fatalf("video sample %d offset %d outside mdat [%d, %d)", i, offset, mdatStart, mdatEnd)
+		}
+		if !bytes.Equal(data[offset:offset+len(want)], want) {
+			t.Errorf("video sample %d data mismatch", i)
+		}
+	}
+
+	// 音频轨道
+	audio := traks[1]
+	if handler := string(childBox(t, audio, "mdia", "hdlr")[8:12]); handler != "soun" {
+		t.Fatalf("second trak handler = %q, want soun", handler)
+	}
+	stbl = childBox(t, audio, "mdia", "minf", "stbl")
+	mp4a := childBox(t, stbl, "stsd", "mp4a")
+	if channels, rate := binary.BigEndian.Uint16(mp4a[16:]), binary.BigEndian.Uint32(mp4a[24:])>>16; channels != 2 || rate != 44100 {
+		t.Errorf("mp4a = %d channels %d Hz, want 2 44100", channels, rate)
+	}
+	childBox(t, stbl, "stsd", "mp4a", "esds")
+	sizes = tableEntries(childBox(t, stbl, "stsz"), 8)
+	if len(sizes) != len(audioFrames) {
+		t.Fatalf("audio samples = %d, want %d", len(sizes), len(audioFrames))
+	}
+	for i, offset := range sampleOffsets(t, stbl) {
+		want := audioFrames[i]
+		if offset < mdatStart || offset+len(want) > mdatEnd || !bytes.Equal(data[offset:offset+len(want)], want) {
+			t.Errorf("audio sample %d data mismatch at offset %d", i, offset)
+		}
+	}
+}
+
+func TestRemuxNoStreams(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "a.ts"), filepath.Join(dir, "a.mp4")
+	ts := concat(
+		tsPacketize(0, patPayload(0x1000)),
+		tsPacketize(0x1000, pmtPayload(0x100, [2]uint16{streamTypeH264, 0x100})),
+	)
+	if err := os.WriteFile(src, ts, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remux(src, dst); err == nil {
+		t.Fatal("expected error for TS without samples")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("dst should be removed on failure, stat err = %v", err)
+	}
+}
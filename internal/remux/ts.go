@@ -0,0 +1,238 @@
+package remux
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	streamTypeH264 = 0x1B
+	streamTypeAAC  = 0x0F
+
+	noTimestamp int64 = -1
+)
+
+// 无法转封装的音视频编码（MPEG-1/2视频、MP3、HEVC、AC-3等）
+var unsupportedStreamTypes = []byte{0x01, 0x02, 0x03, 0x04, 0x10, 0x11, 0x24, 0x81, 0x87}
+
+// pesPacket 一个完整的PES包，时间戳单位为 90kHz
+type pesPacket struct {
+	streamType byte
+	pts        int64
+	dts        int64
+	payload    []byte
+}
+
+// demuxTS 读取 MPEG-TS 流，按PID组装PES后交给 onPES 处理
+func demuxTS(r io.Reader, onPES func(pes pesPacket) error) error {
+	br := bufio.NewReaderSize(r, 64*tsPacketSize)
+	packet := make([]byte, tsPacketSize)
+
+	pmtPID := -1
+	streams := make(map[uint16]byte) // pid -> stream_type
+	buffers := make(map[uint16][]byte)
+	var pids []uint16 // 按出现顺序，结束时依次输出
+
+	flush := func(pid uint16) error {
+		data := buffers[pid]
+		buffers[pid] = nil
+		if len(data) == 0 {
+			return nil
+		}
+		pes, err := parsePES(data)
+		if err != nil {
+			return nil // 丢弃损坏的PES
+		}
+		pes.streamType = streams[pid]
+		return onPES(pes)
+	}
+
+	for {
+		// 查找同步字节，跳过解密填充等无效数据
+		b, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if b != tsSyncByte {
+			continue
+		}
+		packet[0] = b
+		if _, err := io.ReadFull(br, packet[1:]); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+
+		pusi := packet[1]&0x40 != 0
+		pid := uint16(packet[1]&0x1F)<<8 | uint16(packet[2])
+		afc := (packet[3] >> 4) & 0x03
+		if afc&0x01 == 0 {
+			continue // 无负载
+		}
+		start := 4
+		if afc&0x02 != 0 {
+			start += 1 + int(packet[4])
+		}
+		if start >= tsPacketSize {
+			continue
+		}
+		payload := packet[start:]
+
+		switch {
+		case pid == 0:
+			if pusi {
+				if p, ok := parsePAT(payload); ok {
+					pmtPID = p
+				}
+			}
+		case int(pid) == pmtPID:
+			if pusi {
+				for esPID, streamType := range parsePMT(payload) {
+					if slices.Contains(unsupportedStreamTypes, streamType) {
+						return fmt.Errorf("不支持的音视频编码: 0x%02x", streamType)
+					}
+					if _, ok := streams[esPID]; !ok {
+						pids = append(pids, esPID)
+					}
+					streams[esPID] = streamType
+				}
+			}
+		default:
+			streamType, ok := streams[pid]
+			if !ok || (streamType != streamTypeH264 && streamType != streamTypeAAC) {
+				continue
+			}
+			if pusi {
+				if err := flush(pid); err != nil {
+					return err
+				}
+				buffers[pid] = append(buffers[pid], payload...)
+			} else if buffers[pid] != nil {
+				buffers[pid] = append(buffers[pid], payload...)
+			}
+		}
+	}
+
+	for _, pid := range pids {
+		if err := flush(pid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// psiSection 去掉 pointer_field，返回 section 数据
+func psiSection(payload []byte) []byte {
+	if len(payload) < 1 {
+		return nil
+	}
+	pointer := int(payload[0])
+	if 1+pointer >= len(payload) {
+		return nil
+	}
+	section := payload[1+pointer:]
+	if len(section) < 3 {
+		return nil
+	}
+	length := int(section[1]&0x0F)<<8 | int(section[2])
+	if 3+length > len(section) || length < 4 {
+		return nil
+	}
+	return section[:3+length-4] // 去掉 CRC
+}
+
+// parsePAT 返回第一个节目的 PMT PID
+func parsePAT(payload []byte) (int, bool) {
+	section := psiSection(payload)
+	if len(section) < 8 || section[0] != 0x00 {
+		return 0, false
+	}
+	for i := 8; i+4 <= len(section); i += 4 {
+		program := int(section[i])<<8 | int(section[i+1])
+		if program == 0 {
+			continue // 网络信息表
+		}
+		return int(section[i+2]&0x1F)<<8 | int(section[i+3]), true
+	}
+	return 0, false
+}
+
+// parsePMT 返回 PID -> stream_type
+func parsePMT(payload []byte) map[uint16]byte {
+	streams := make(map[uint16]byte)
+	section := psiSection(payload)
+	if len(section) < 12 || section[0] != 0x02 {
+		return streams
+	}
+	programInfoLength := int(section[10]&0x0F)<<8 | int(section[11])
+	for i := 12 + programInfoLength; i+5 <= len(section); {
+		streamType := section[i]
+		pid := uint16(section[i+1]&0x1F)<<8 | uint16(section[i+2])
+		esInfoLength := int(section[i+3]&0x0F)<<8 | int(section[i+4])
+		streams[pid] = streamType
+		i += 5 + esInfoLength
+	}
+	return streams
+}
+
+// parsePES 解析PES头，提取时间戳和负载
+func parsePES(data []byte) (pesPacket, error) {
+	pes := pesPacket{pts: noTimestamp, dts: noTimestamp}
+	if len(data) < 9 || data[0] != 0 || data[1] != 0 || data[2] != 1 {
+		return pes, fmt.Errorf("invalid PES start code")
+	}
+	if length := int(data[4])<<8 | int(data[5]); length > 0 && 6+length <= len(data) {
+		data = data[:6+length]
+	}
+
+	flags := data[7]
+	headerLength := int(data[8])
+	if 9+headerLength > len(data) {
+		return pes, fmt.Errorf("invalid PES header length")
+	}
+	if flags&0x80 != 0 && headerLength >= 5 {
+		pes.pts = readTimestamp(data[9:14])
+		pes.dts = pes.pts
+	}
+	if flags&0xC0 == 0xC0 && headerLength >= 10 {
+		pes.dts = readTimestamp(data[14:19])
+	}
+	pes.payload = data[9+headerLength:]
+	return pes, nil
+}
+
+// readTimestamp 解析 33 位 PTS/DTS
+func readTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 |
+		int64(b[1])<<22 |
+		int64(b[2]>>1)<<15 |
+		int64(b[3])<<7 |
+		int64(b[4]>>1)
+}
+
+// timestampWrap PTS/DTS 为 33 位，超过后回绕
+const timestampWrap int64 = 1 << 33
+
+// unwrapTimestamp 根据上一个时间戳处理回绕
+func unwrapTimestamp(ts int64, last int64) int64 {
+	if last == noTimestamp {
+		return ts
+	}
+	diff := (ts - last) % timestampWrap
+	if diff < -timestampWrap/2 {
+		diff += timestampWrap
+	} else if diff >= timestampWrap/2 {
+		diff -= timestampWrap
+	}
+	return last + diff
+}
@@ -0,0 +1,220 @@
+package remux
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// pesTimestamp 编码 33 位 PTS/DTS，prefix 为前4位标记
+func pesTimestamp(prefix byte, v int64) []byte {
+	return []byte{
+		prefix<<4 | byte(v>>29)&0x0E | 1,
+		byte(v >> 22),
+		byte(v>>14) | 1,
+		byte(v >> 7),
+		byte(v<<1) | 1,
+	}
+}
+
+// buildPES 构造PES包，dts 为 noTimestamp 时只写 PTS，视频包长度为0（不限）
+func buildPES(streamID byte, pts, dts int64, data []byte) []byte {
+	var header []byte
+	switch {
+	case pts == noTimestamp:
+		header = []byte{0x80, 0x00, 0}
+	case dts == noTimestamp:
+		header = append([]byte{0x80, 0x80, 5}, pesTimestamp(2, pts)...)
+	default:
+		header = append([]byte{0x80, 0xC0, 10}, pesTimestamp(3, pts)...)
+		header = append(header, pesTimestamp(1, dts)...)
+	}
+	pes := concat([]byte{0, 0, 1, streamID, 0, 0}, header, data)
+	if streamID != 0xE0 {
+		length := len(pes) - 6
+		pes[4], pes[5] = byte(length>>8), byte(length)
+	}
+	return pes
+}
+
+// psiPayload 构造带 pointer_field 的 PAT/PMT section，CRC 不校验
+func psiPayload(tableID byte, body []byte) []byte {
+	length := len(body) + 5 + 4
+	section := []byte{0, tableID, 0xB0 | byte(length>>8), byte(length), 0, 1, 0xC1, 0, 0}
+	section = append(section, body...)
+	return append(section, 0, 0, 0, 0)
+}
+
+// patPayload 节目1的 PMT PID
+func patPayload(pmtPID uint16) []byte {
+	return psiPayload(0x00, []byte{0, 1, 0xE0 | byte(pmtPID>>8), byte(pmtPID)})
+}
+
+// pmtPayload streams 依次为 stream_type 和 PID
+func pmtPayload(pcrPID uint16, streams ...[2]uint16) []byte {
+	body := []byte{0xE0 | byte(pcrPID>>8), byte(pcrPID), 0xF0, 0x00}
+	for _, s := range streams {
+		body = append(body, byte(s[0]), 0xE0|byte(s[1]>>8), byte(s[1]), 0xF0, 0x00)
+	}
+	return psiPayload(0x02, body)
+}
+
+// tsPacketize 将负载拆分为TS包，最后一个包用适配字段填充
+func tsPacketize(pid uint16, payload []byte) []byte {
+	var out []byte
+	cc := byte(0)
+	for first := true; first || len(payload) > 0; first = false {
+		packet := make([]byte, tsPacketSize)
+		packet[0] = tsSyncByte
+		packet[1] = byte(pid>>8) & 0x1F
+		if first {
+			packet[1] |= 0x40
+		}
+		packet[2] = byte(pid)
+		n := min(len(payload), tsPacketSize-4)
+		if n < tsPacketSize-4 {
+			packet[3] = 0x30 | cc
+			stuffing := tsPacketSize - 4 - n - 1
+			packet[4] = byte(stuffing)
+			if stuffing > 0 {
+				packet[5] = 0
+				for i := 6; i < 5+stuffing; i++ {
+					packet[i] = 0xFF
+				}
+			}
+			copy(packet[5+stuffing:], payload[:n])
+		} else {
+			packet[3] = 0x10 | cc
+			copy(packet[4:], payload[:n])
+		}
+		payload = payload[n:]
+		cc = (cc + 1) & 0x0F
+		out = append(out, packet...)
+	}
+	return out
+}
+
+func TestParsePES(t *testing.T) {
+	data := []byte{1, 2, 3, 4}
+	tests := []struct {
+		name     string
+		pes      []byte
+		pts, dts int64
+		payload  []byte
+	}{
+		{"pts only", buildPES(0xC0, 90000, noTimestamp, data), 90000, 90000, data},
+		{"pts and dts", buildPES(0xE0, 93600, 90000, data), 93600, 90000, data},
+		{"no timestamp", buildPES(0xC0, noTimestamp, noTimestamp, data), noTimestamp, noTimestamp, data},
+		{"max 33-bit timestamp", buildPES(0xC0, timestampWrap-1, noTimestamp, data), timestampWrap - 1, timestampWrap - 1, data},
+		{"trailing bytes beyond length", append(buildPES(0xC0, 0, noTimestamp, data), 0xFF, 0xFF), 0, 0, data},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pes, err := parsePES(tt.pes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pes.pts != tt.pts || pes.dts != tt.dts {
+				t.Errorf("pts/dts = %d/%d, want %d/%d", pes.pts, pes.dts, tt.pts, tt.dts)
+			}
+			if !bytes.Equal(pes.payload, tt.payload) {
+				t.Errorf("payload = % x, want % x", pes.payload, tt.payload)
+			}
+		})
+	}
+}
+
+func TestParsePESInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		pes  []byte
+	}{
+		{"bad start code", []byte{0, 0, 2, 0xE0, 0, 0, 0x80, 0x80, 5}},
+		{"too short", []byte{0, 0, 1, 0xE0}},
+		{"header length overflow", []byte{0, 0, 1, 0xE0, 0, 0, 0x80, 0x80, 10, 0x21}},
+	}
+	for _, tt := range tests {
+		if _, err := parsePES(tt.pes); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestUnwrapTimestamp(t *testing.T) {
+	tests := []struct {
+		ts, last, want int64
+	}{
+		{1000, noTimestamp, 1000},
+		{4600, 1000, 4600},
+		{100, timestampWrap - 3500, timestampWrap + 100},               // 回绕
+		{timestampWrap - 100, 3500, -100},                              // 回绕前的帧（B帧）
+		{2*timestampWrap + 50, timestampWrap - 50, timestampWrap + 50}, // 已展开的时间戳
+	}
+	for _, tt := range tests {
+		if got := unwrapTimestamp(tt.ts, tt.last); got != tt.want {
+			t.Errorf("unwrapTimestamp(%d, %d) = %d, want %d", tt.ts, tt.last, got, tt.want)
+		}
+	}
+}
+
+func TestDemuxTS(t *testing.T) {
+	audio := adtsFrameData(2, 4, 2, []byte{1, 2, 3}, false)
+	video := bytes.Repeat([]byte{0x41}, 400) // 跨多个TS包
+	ts := concat(
+		[]byte{0x00, 0x12}, // 同步前的无效数据
+		tsPacketize(0, patPayload(0x1000)),
+		tsPacketize(0x1000, pmtPayload(0x100, [2]uint16{streamTypeH264, 0x100}, [2]uint16{streamTypeAAC, 0x101})),
+		tsPacketize(0x100, buildPES(0xE0, 3600, 0, video)),
+		tsPacketize(0x101, buildPES(0xC0, 1800, noTimestamp, audio)),
+		tsPacketize(0x100, buildPES(0xE0, 7200, 3600, video[:10])),
+		tsPacketize(0x200, buildPES(0xE0, 0, noTimestamp, video)), // 不在 PMT 中
+	)
+
+	var got []pesPacket
+	err := demuxTS(bytes.NewReader(ts), func(pes pesPacket) error {
+		got = append(got, pes)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		streamType byte
+		pts        int64
+		size       int
+	}{
+		{streamTypeH264, 3600, len(video)},
+		{streamTypeAAC, 1800, len(audio)},
+		{streamTypeH264, 7200, 10},
+	}
+	// 文件结束时剩余的PES按PID输出，只比较同一PID内的顺序
+	for _, streamType := range []byte{streamTypeH264, streamTypeAAC} {
+		var gotType, wantType []string
+		for _, p := range got {
+			if p.streamType == streamType {
+				gotType = append(gotType, fmt.Sprintf("pts %d size %d", p.pts, len(p.payload)))
+			}
+		}
+		for _, w := range want {
+			if w.streamType == streamType {
+				wantType = append(wantType, fmt.Sprintf("pts %d size %d", w.pts, w.size))
+			}
+		}
+		if !slices.Equal(gotType, wantType) {
+			t.Errorf("stream 0x%02x = %v, want %v", streamType, gotType, wantType)
+		}
+	}
+}
+
+func TestDemuxTSUnsupported(t *testing.T) {
+	ts := concat(
+		tsPacketize(0, patPayload(0x1000)),
+		tsPacketize(0x1000, pmtPayload(0x100, [2]uint16{0x24, 0x100})), // HEVC
+	)
+	err := demuxTS(bytes.NewReader(ts), func(pesPacket) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "0x24") {
+		t.Fatalf("err = %v, want unsupported HEVC", err)
+	}
+}
@@ -1,10 +1,12 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 
 	"fyne.io/fyne/v2"
@@ -18,13 +20,11 @@ import (
 	"github.com/hantang/smartedudlgo/internal/util"
 )
 
-func createFormatCheckboxes(onlyAudio bool, enableText bool) []fyne.CanvasObject {
+func createFormatCheckboxes(onlyAudio bool, enableText bool, store *settingsStore) []fyne.CanvasObject {
 	// 资源类型复选框
 	var checkboxes []fyne.CanvasObject
 	for _, format := range dl.FORMAT_LIST {
-		checkbox := widget.NewCheck(format.Name, func(checked bool) {
-			// 处理复选框状态变化的逻辑
-		})
+		checkbox := widget.NewCheck(format.Name, nil)
 		if onlyAudio {
 			if strings.Contains(format.Name, "音频") {
 				checkbox.SetChecked(format.Suffix == "mp3")
@@ -35,7 +35,11 @@ func createFormatCheckboxes(onlyAudio bool, enableText bool) []fyne.CanvasObject
 			if !format.Status && !(enableText && format.Suffix == "txt") {
 				checkbox.Disable()
 			} else {
-				checkbox.SetChecked(format.Check)
+				checkbox.SetChecked(store.settings.HasFormat(format.Suffix))
+				// 勾选状态保存到设置
+				checkbox.OnChanged = func(checked bool) {
+					store.update(func(s *dl.Settings) { s.SetFormat(format.Suffix, checked) }, false)
+				}
 			}
 		}
 		checkboxes = append(checkboxes, checkbox)
@@ -57,16 +61,6 @@ func extractDownloadInfo(w fyne.Window, pathEntry *widget.Entry, defaultPath str
 	return downloadPath
 }
 
-func initHeaders(token string) map[string]string {
-	headers := map[string]string{}
-	authInfo := util.FulfillToken(token)
-	if authInfo != "" {
-		headers["x-nd-auth"] = authInfo
-	}
-	slog.Debug("headers initialized", "hasAuth", headers["x-nd-auth"] != "")
-	return headers
-}
-
 func extractDownloadLinks(w fyne.Window, tab *container.AppTabs, linkItemMaps map[string][]dl.LinkItem) []string {
 	// random := true
 	filteredURLs := []string{}
@@ -114,7 +108,7 @@ func extractDownloadLinks(w fyne.Window, tab *container.AppTabs, linkItemMaps ma
 	return filteredURLs
 }
 
-func CreateOperationArea(w fyne.Window, tab *container.AppTabs, linkItemMaps map[string][]dl.LinkItem, maxConcurrency int) *fyne.Container {
+func CreateOperationArea(w fyne.Window, tab *container.AppTabs, linkItemMaps map[string][]dl.LinkItem, store *settingsStore) *fyne.Container {
 	random := true
 	// Progress bar
 	progressBar := widget.NewProgressBar()
@@ -124,6 +118,64 @@ func CreateOperationArea(w fyne.Window, tab *container.AppTabs, linkItemMaps map
 	downloadButton := widget.NewButtonWithIcon("下载已选择资源", theme.DownloadIcon(), nil)
 	downloadVideoButton := widget.NewButtonWithIcon("仅下载视频", theme.FileVideoIcon(), nil)
 
+	// 暂停/继续、取消当前下载
+	var (
+		activeManager  *dl.DownloadManager
+		cancelDownload context.CancelFunc
+	)
+	pauseButton := widget.NewButtonWithIcon("暂停", theme.MediaPauseIcon(), nil)
+	cancelButton := widget.NewButtonWithIcon("取消", theme.CancelIcon(), nil)
+	pauseButton.Disable()
+	cancelButton.Disable()
+
+	// 下载列表：每个文件的进度和状态，可重试失败的文件
+	var lastQueue *dl.Queue
+	queueView := newQueueView(w)
+	var queueWindow fyne.Window
+	queueButton := widget.NewButtonWithIcon("下载列表", theme.ListIcon(), func() {
+		if queueWindow == nil {
+			queueWindow = fyne.CurrentApp().NewWindow("下载列表")
+			queueWindow.SetContent(queueView.content())
+			queueWindow.Resize(fyne.NewSize(900, 500))
+			queueWindow.SetCloseIntercept(queueWindow.Hide)
+			queueView.window = queueWindow
+		}
+		queueWindow.Show()
+		queueWindow.RequestFocus()
+	})
+	setPaused := func(paused bool) {
+		if paused {
+			pauseButton.SetText("继续")
+			pauseButton.SetIcon(theme.MediaPlayIcon())
+		} else {
+			pauseButton.SetText("暂停")
+			pauseButton.SetIcon(theme.MediaPauseIcon())
+		}
+	}
+	pauseButton.OnTapped = func() {
+		if activeManager == nil {
+			return
+		}
+		if activeManager.Paused() {
+			activeManager.Resume()
+		} else {
+			activeManager.Pause()
+		}
+		setPaused(activeManager.Paused())
+	}
+	cancelButton.OnTapped = func() {
+		if cancelDownload == nil {
+			return
+		}
+		dialog.NewConfirm("取消下载", "停止下载并删除未完成的文件？", func(ok bool) {
+			if ok && cancelDownload != nil {
+				cancelDownload()
+				pauseButton.Disable()
+				cancelButton.Disable()
+			}
+		}, w).Show()
+	}
+
 	// Resource type checkboxes
 	formatLabel := widget.NewLabelWithStyle("🔖 资源类型: ", fyne.TextAlign(fyne.TextAlignLeading), fyne.TextStyle{Bold: true})
 	formatContainer := container.NewHBox()
@@ -133,7 +185,7 @@ func CreateOperationArea(w fyne.Window, tab *container.AppTabs, linkItemMaps map
 
 		if tab.Selected() != nil {
 			onlyAudio := tab.Selected().Text == dl.TAB_NAMES[3]
-			checkboxes = createFormatCheckboxes(onlyAudio, tab.Selected().Text == dl.TAB_NAMES[0])
+			checkboxes = createFormatCheckboxes(onlyAudio, tab.Selected().Text == dl.TAB_NAMES[0], store)
 			if onlyAudio {
 				downloadVideoButton.Disable()
 			} else {
@@ -155,8 +207,10 @@ func CreateOperationArea(w fyne.Window, tab *container.AppTabs, linkItemMaps map
 	}
 
 	// backup links
-	backupCheckbox := widget.NewCheck("备用解析", func(checked bool) {})
-	logCheckbox := widget.NewCheck("记录日志", func(checked bool) {})
+	backupCheckbox := widget.NewCheck("备用解析", nil)
+	logCheckbox := widget.NewCheck("记录日志", nil)
+	metadataCheckbox := widget.NewCheck("元数据", nil)
+	mergeCheckbox := widget.NewCheck("合并PDF", nil)
 
 	// user log info
 	loginLabel := widget.NewLabelWithStyle("🍪 登录信息: ", fyne.TextAlign(fyne.TextAlignLeading), fyne.TextStyle{Bold: true})
@@ -180,6 +234,86 @@ func CreateOperationArea(w fyne.Window, tab *container.AppTabs, linkItemMaps map
 	// pathEntry.Disable()
 	pathComment := "更新为："
 
+	// 已存在文件处理方式
+	conflicts := conflictOptions()
+	conflictSelect := widget.NewSelect(conflicts.names, nil)
+
+	// 视频保存格式
+	containers := containerOptions()
+	containerSelect := widget.NewSelect(containers.names, nil)
+
+	// 视频清晰度
+	qualities := qualityOptions()
+	qualitySelect := widget.NewSelect(qualities.names, nil)
+
+	// 下载限速和每个服务器的并发数，下载过程中修改立即生效
+	limitLabel := widget.NewLabelWithStyle("⏱️ 下载限速: ", fyne.TextAlign(fyne.TextAlignLeading), fyne.TextStyle{Bold: true})
+	rates := rateOptions()
+	rateSelect := widget.NewSelect(rates.names, nil)
+	hostConnsLabel := widget.NewLabel("每个服务器并发数:")
+	hostConns := hostConnsOptions()
+	hostConnsSelect := widget.NewSelect(hostConns.names, nil)
+
+	// applySettings 按设置更新各选项，启动时和设置对话框保存后调用
+	applySettings := func() {
+		s := store.settings
+		backupCheckbox.SetChecked(s.UseBackup)
+		logCheckbox.SetChecked(s.EnableLog)
+		metadataCheckbox.SetChecked(s.WriteMetadata)
+		mergeCheckbox.SetChecked(s.MergePDF)
+		if s.DownloadsDir != "" {
+			pathEntry.SetText(pathComment + s.DownloadsDir)
+		} else {
+			pathEntry.SetText("")
+		}
+		selectValue(conflictSelect, conflicts, string(s.Conflict))
+		selectValue(containerSelect, containers, string(s.Container))
+		selectValue(qualitySelect, qualities, s.Quality)
+		selectValue(rateSelect, rates, s.RateLimit)
+		selectValue(hostConnsSelect, hostConns, strconv.Itoa(s.HostConns))
+		rate, _ := dl.ParseRate(s.RateLimit)
+		dl.SetRateLimit(rate)
+		dl.SetHostConcurrency(s.HostConns)
+		updateCheckboxes()
+	}
+	applySettings()
+	store.onChanged(applySettings)
+
+	// 修改后保存到设置
+	backupCheckbox.OnChanged = func(checked bool) {
+		store.update(func(s *dl.Settings) { s.UseBackup = checked }, false)
+	}
+	logCheckbox.OnChanged = func(checked bool) {
+		store.update(func(s *dl.Settings) { s.EnableLog = checked }, false)
+	}
+	metadataCheckbox.OnChanged = func(checked bool) {
+		store.update(func(s *dl.Settings) { s.WriteMetadata = checked }, false)
+	}
+	mergeCheckbox.OnChanged = func(checked bool) {
+		store.update(func(s *dl.Settings) { s.MergePDF = checked }, false)
+	}
+	conflictSelect.OnChanged = func(name string) {
+		store.update(func(s *dl.Settings) { s.Conflict = dl.ConflictPolicy(conflicts.value(name)) }, false)
+	}
+	containerSelect.OnChanged = func(name string) {
+		store.update(func(s *dl.Settings) { s.Container = dl.VideoContainer(containers.value(name)) }, false)
+	}
+	qualitySelect.OnChanged = func(name string) {
+		store.update(func(s *dl.Settings) { s.Quality = qualities.value(name) }, false)
+	}
+	rateSelect.OnChanged = func(name string) {
+		rate, _ := dl.ParseRate(rates.value(name))
+		dl.SetRateLimit(rate)
+		slog.Info(fmt.Sprintf("下载限速：%s", dl.FormatRate(rate)))
+		store.update(func(s *dl.Settings) { s.RateLimit = rates.value(name) }, false)
+	}
+	hostConnsSelect.OnChanged = func(name string) {
+		conns, _ := strconv.Atoi(hostConns.value(name))
+		dl.SetHostConcurrency(conns)
+		slog.Info(fmt.Sprintf("每个服务器并发数：%s", name))
+		store.update(func(s *dl.Settings) { s.HostConns = conns }, false)
+	}
+
 	selectPathButton := widget.NewButtonWithIcon("选择目录", theme.FolderIcon(), func() {
 		dialog.NewFolderOpen(func(dir fyne.ListableURI, err error) {
 			if err != nil {
@@ -191,9 +325,68 @@ func CreateOperationArea(w fyne.Window, tab *container.AppTabs, linkItemMaps map
 			}
 			// downloadPath = dir.Path()
 			pathEntry.SetText(pathComment + dir.Path())
+			store.update(func(s *dl.Settings) { s.DownloadsDir = dir.Path() }, false)
 		}, w).Show()
 	})
 
+	// runQueue 下载队列中的文件，需在界面线程调用
+	runQueue := func(queue *dl.Queue, opts dl.DownloadOptions) {
+		reporter := newUIReporter(w, progressBar, progressLabel,
+			[]*widget.Button{downloadButton, downloadVideoButton},
+			[]*widget.Button{pauseButton, cancelButton})
+		downloadManager := dl.NewDownloadManager(queue.DownloadsDir, queue.Links())
+		downloadManager.Subscribe(queue)
+		downloadManager.Subscribe(reporter)
+		downloadManager.Subscribe(queueView)
+		queueView.reset(queue.Links())
+		lastQueue = queue
+		ctx, cancel := context.WithCancel(context.Background())
+		activeManager, cancelDownload = downloadManager, cancel
+		setPaused(false)
+		go func() {
+			defer cancel()
+			downloadManager.StartDownload(ctx, opts)
+		}()
+	}
+
+	queueView.retryButton.OnTapped = func() {
+		if lastQueue == nil {
+			return
+		}
+		queue := lastQueue.RetryFailed()
+		if len(queue.Items) == 0 {
+			return
+		}
+		progressLabel.SetText(fmt.Sprintf("重试 %d 个失败的文件", len(queue.Items)))
+		runQueue(queue, queue.Options.DownloadOptions(dl.NewHeaders(loginEntry.Text)))
+	}
+
+	// 启动时提示继续上次未完成的下载
+	fyne.CurrentApp().Lifecycle().SetOnStarted(func() {
+		queue, err := dl.LoadQueue()
+		if err != nil {
+			slog.Warn(fmt.Sprintf("读取下载队列出错：%v", err))
+			return
+		}
+		if queue == nil || queue.Unfinished() == 0 {
+			return
+		}
+		message := fmt.Sprintf("上次有 %d 个文件未完成或下载失败（保存至 %s），是否继续？", queue.Unfinished(), queue.DownloadsDir)
+		fyne.Do(func() {
+			dialog.NewConfirm("继续下载", message, func(ok bool) {
+				if !ok {
+					if err := dl.DiscardQueue(); err != nil {
+						slog.Warn(fmt.Sprintf("删除下载队列出错：%v", err))
+					}
+					return
+				}
+				queue = queue.Remaining()
+				progressLabel.SetText(dl.SummarizeResources(queue.Links()))
+				runQueue(queue, queue.Options.DownloadOptions(dl.NewHeaders(loginEntry.Text)))
+			}, w).Show()
+		})
+	})
+
 	startDownload := func(isVideo bool) {
 		currentTab := tab.Selected().Text
 		isParse := currentTab != dl.TAB_NAMES[3]
@@ -205,9 +398,14 @@ func CreateOperationArea(w fyne.Window, tab *container.AppTabs, linkItemMaps map
 		}
 
 		downloadPath := extractDownloadInfo(w, pathEntry, defaultPath, pathComment)
-		headers := initHeaders(loginEntry.Text)
+		headers := dl.NewHeaders(loginEntry.Text)
 		enableLog := logCheckbox.Checked
+		writeMetadata := metadataCheckbox.Checked
+		mergePDF := mergeCheckbox.Checked && !isVideo
 		useBackup := backupCheckbox.Checked
+		conflict, _ := dl.ParseConflictPolicy(conflictSelect.Selected)
+		videoContainer, _ := dl.ParseVideoContainer(containerSelect.Selected)
+		quality, _ := dl.ParseQualityPolicy(qualitySelect.Selected)
 
 		// 下载进行中禁止再次点击
 		downloadButton.Disable()
@@ -238,7 +436,12 @@ func CreateOperationArea(w fyne.Window, tab *container.AppTabs, linkItemMaps map
 
 		progressLabel.SetText("正在解析资源...")
 		go func() {
-			resourceURLs := dl.ExtractResources(filteredURLs, formatList, random, useBackup, isParse)
+			ctx := dl.WithRetries(context.Background(), store.settings.Retries)
+			resourceURLs := dl.ExtractResources(ctx, filteredURLs, formatList, random, useBackup, isParse)
+			pending := 0
+			if queue, err := dl.LoadQueue(); err == nil && queue != nil {
+				pending = queue.Unfinished()
+			}
 			fyne.Do(func() {
 				if len(resourceURLs) == 0 {
 					dialog.NewError(fmt.Errorf("未解析到有效资源"), w).Show()
@@ -248,28 +451,38 @@ func CreateOperationArea(w fyne.Window, tab *container.AppTabs, linkItemMaps map
 					return
 				}
 
-				resourceStats := make(map[string]int)
-				formatDict := make(map[string]string)
-				for _, item := range dl.FORMAT_LIST {
-					formatDict[item.Suffix] = item.Name
-				}
-				for _, item := range resourceURLs {
-					resourceStats[item.Format]++
-				}
-				var resultStrBuilder strings.Builder
-				for key, value := range resourceStats {
-					name := formatDict[key]
-					if name == "" {
-						name = key
-					}
-					resultStrBuilder.WriteString(fmt.Sprintf("%s=%d ", name, value))
-				}
-				infoStr := fmt.Sprintf("共解析到%d个资源：%s", len(resourceURLs), resultStrBuilder.String())
+				infoStr := dl.SummarizeResources(resourceURLs)
 				progressLabel.SetText(infoStr)
 				slog.Info(infoStr)
 
-				downloadManager := dl.NewDownloadManager(w, progressBar, progressLabel, downloadPath, resourceURLs)
-				downloadManager.StartDownload(downloadButton, downloadVideoButton, headers, enableLog, isVideo, maxConcurrency)
+				opts := dl.DownloadOptions{
+					Headers:        headers,
+					EnableLog:      enableLog,
+					IsVideo:        isVideo,
+					MaxConcurrency: store.maxConcurrency(),
+					Conflict:       conflict,
+					Container:      videoContainer,
+					Quality:        quality,
+					NameTemplate:   store.settings.NameTemplate,
+					WriteMetadata:  writeMetadata,
+					MergePDF:       mergePDF,
+					RemoveMerged:   store.settings.RemoveMerged,
+					Retries:        store.settings.Retries,
+				}
+				if pending == 0 {
+					runQueue(dl.NewQueue(downloadPath, resourceURLs, opts), opts)
+					return
+				}
+				// 新的队列会替换上次的队列
+				message := fmt.Sprintf("上次有 %d 个文件未完成或下载失败，开始新的下载将放弃这些文件，是否继续？", pending)
+				dialog.NewConfirm("开始下载", message, func(ok bool) {
+					if !ok {
+						downloadButton.Enable()
+						downloadVideoButton.Enable()
+						return
+					}
+					runQueue(dl.NewQueue(downloadPath, resourceURLs, opts), opts)
+				}, w).Show()
 			})
 		}()
 	}
@@ -283,16 +496,21 @@ func CreateOperationArea(w fyne.Window, tab *container.AppTabs, linkItemMaps map
 	}
 
 	downloadPart := container.NewCenter(
-		container.New(layout.NewCustomPaddedHBoxLayout(20), downloadButton, downloadVideoButton),
+		container.New(layout.NewCustomPaddedHBoxLayout(20),
+			downloadButton,
+			container.NewHBox(downloadVideoButton, qualitySelect, containerSelect),
+			container.NewHBox(pauseButton, cancelButton, queueButton),
+		),
 	)
 	return container.NewVBox(
 		widget.NewSeparator(),
 		container.NewPadded(),
-		container.NewBorder(nil, nil, nil, logCheckbox, downloadPart),
+		container.NewBorder(nil, nil, nil, container.NewVBox(logCheckbox, metadataCheckbox, mergeCheckbox), downloadPart),
 		container.NewPadded(),
 		container.NewHBox(formatLabel, formatContainer),
-		container.NewBorder(nil, nil, pathLabel, container.NewHBox(selectPathButton), pathEntry),
+		container.NewBorder(nil, nil, pathLabel, container.NewHBox(selectPathButton, conflictSelect), pathEntry),
 		container.NewBorder(nil, nil, loginLabel, backupCheckbox, loginEntry),
+		container.NewHBox(limitLabel, rateSelect, hostConnsLabel, hostConnsSelect),
 		container.NewPadded(),
 		progressBar,
 		progressLabel,
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"slices"
@@ -223,7 +224,7 @@ func initRightPart(w fyne.Window, linkItemMaps map[string][]dl.LinkItem, tabData
 		}
 
 		go func() {
-			bookBase := dl.FetchRawData2(name, isLocal, saveFetchedData)
+			bookBase := dl.FetchRawData2(context.Background(), name, isLocal, saveFetchedData)
 			fyne.Do(func() {
 				if name != dl.TAB_NAMES[1] {
 					if bookBase.Name != "" {
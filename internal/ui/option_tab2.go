@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 
@@ -40,7 +41,7 @@ func radioCallback(w fyne.Window, name string, tabData OptionTabData, linkItemMa
 			courseToc, ok = tabData.CourseDict[courseID]
 			if !ok {
 				tabData.CheckText.Set("查询课程单元中")
-				courseToc = dl.ParseCourseID(courseID)
+				courseToc = dl.ParseCourseID(context.Background(), courseID)
 			}
 		}
 
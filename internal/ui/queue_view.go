@@ -0,0 +1,444 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/hantang/smartedudlgo/internal/dl"
+)
+
+var queueColumns = []struct {
+	title string
+	width float32
+}{
+	{"标题", 260},
+	{"格式", 50},
+	{"目录", 160},
+	{"大小", 80},
+	{"已下载", 80},
+	{"速度", 90},
+	{"状态", 80},
+	{"错误", 300},
+}
+
+// queueRow 下载列表中的一个文件
+type queueRow struct {
+	link   dl.LinkData
+	status string
+	bytes  int64
+	speed  float64
+	path   string
+	err    string
+}
+
+// queueView 订阅下载事件，以表格展示每个文件的进度和状态
+type queueView struct {
+	window fyne.Window
+	table  *widget.Table
+
+	mu       sync.Mutex
+	rows     []queueRow
+	dirty    bool
+	selected int
+
+	openFolderButton *widget.Button
+	retryButton      *widget.Button
+	verifyButton     *widget.Button
+	bundleButton     *widget.Button
+}
+
+func newQueueView(window fyne.Window) *queueView {
+	v := &queueView{window: window, selected: -1}
+	v.table = widget.NewTable(
+		func() (int, int) {
+			v.mu.Lock()
+			defer v.mu.Unlock()
+			return len(v.rows), len(queueColumns)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(id widget.TableCellID, obj fyne.CanvasObject) {
+			obj.(*widget.Label).SetText(v.cell(id.Row, id.Col))
+		},
+	)
+	v.table.ShowHeaderRow = true
+	v.table.CreateHeader = func() fyne.CanvasObject {
+		return widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	}
+	v.table.UpdateHeader = func(id widget.TableCellID, obj fyne.CanvasObject) {
+		if id.Col >= 0 {
+			obj.(*widget.Label).SetText(queueColumns[id.Col].title)
+		}
+	}
+	for i, column := range queueColumns {
+		v.table.SetColumnWidth(i, column.width)
+	}
+	v.table.OnSelected = func(id widget.TableCellID) {
+		v.mu.Lock()
+		v.selected = id.Row
+		v.mu.Unlock()
+	}
+
+	v.openFolderButton = widget.NewButtonWithIcon("打开目录", theme.FolderOpenIcon(), v.openFolder)
+	v.retryButton = widget.NewButtonWithIcon("重试失败", theme.ViewRefreshIcon(), nil)
+	v.retryButton.Disable()
+	v.verifyButton = widget.NewButtonWithIcon("校验目录", theme.ConfirmIcon(), v.verifyFolder)
+	v.bundleButton = widget.NewButtonWithIcon("打包课程", theme.DownloadIcon(), v.bundleFolder)
+	return v
+}
+
+func (v *queueView) content() fyne.CanvasObject {
+	buttons := container.NewHBox(v.retryButton, v.openFolderButton, v.verifyButton, v.bundleButton)
+	return container.NewBorder(nil, container.NewCenter(buttons), nil, nil, v.table)
+}
+
+// reset 开始新的一批下载
+func (v *queueView) reset(links []dl.LinkData) {
+	v.mu.Lock()
+	v.rows = make([]queueRow, len(links))
+	for i, link := range links {
+		v.rows[i] = queueRow{link: link, status: "等待"}
+	}
+	v.selected = -1
+	v.mu.Unlock()
+	v.table.UnselectAll()
+	v.table.Refresh()
+}
+
+func (v *queueView) cell(row int, col int) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if row < 0 || row >= len(v.rows) {
+		return ""
+	}
+	r := v.rows[row]
+	switch col {
+	case 0:
+		return r.link.Title
+	case 1:
+		return r.link.Format
+	case 2:
+		return r.link.Folder
+	case 3:
+		return dl.FormatBytes(r.link.Size)
+	case 4:
+		return dl.FormatBytes(r.bytes)
+	case 5:
+		if r.speed > 0 {
+			return dl.FormatBytes(int64(r.speed)) + "/s"
+		}
+		return ""
+	case 6:
+		return r.status
+	case 7:
+		return r.err
+	}
+	return ""
+}
+
+func (v *queueView) update(index int, fn func(r *queueRow)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if index >= 0 && index < len(v.rows) {
+		fn(&v.rows[index])
+		v.dirty = true
+	}
+}
+
+func (v *queueView) OnEvent(e dl.Event) {
+	switch e := e.(type) {
+	case dl.BatchStarted:
+		fyne.Do(v.retryButton.Disable)
+	case dl.JobStarted:
+		v.update(e.Index, func(r *queueRow) {
+			r.status = "下载中"
+			r.err = ""
+		})
+	case dl.JobProgress:
+		v.update(e.Index, func(r *queueRow) {
+			r.bytes = e.Bytes
+			r.speed = e.Speed
+		})
+	case dl.JobRetry:
+		v.update(e.Index, func(r *queueRow) {
+			r.status = "重试中"
+			r.err = e.Err.Error()
+		})
+	case dl.JobFinished:
+		v.update(e.Index, func(r *queueRow) {
+			// 下载时可能按实际内容修正了格式
+			r.link.Format = e.Link.Format
+			r.speed = 0
+			r.path = e.Path
+			r.err = ""
+			switch e.Status {
+			case dl.JobSucceeded:
+				r.status = "完成"
+				r.bytes = max(r.bytes, e.Bytes)
+			case dl.JobSkipped:
+				r.status = "跳过"
+			case dl.JobCanceled:
+				r.status = "已取消"
+			default:
+				r.status = "失败"
+				if e.Err != nil {
+					r.err = e.Err.Error()
+				}
+			}
+		})
+	case dl.BatchProgress:
+		// 随整体进度定时刷新表格
+		v.refresh()
+	case dl.BatchFinished:
+		v.refresh()
+		if e.Result.Failed > 0 {
+			fyne.Do(v.retryButton.Enable)
+		}
+	}
+}
+
+func (v *queueView) refresh() {
+	v.mu.Lock()
+	dirty := v.dirty
+	v.dirty = false
+	v.mu.Unlock()
+	if dirty {
+		fyne.Do(v.table.Refresh)
+	}
+}
+
+// openFolder 打开选中文件（默认第一个）所在目录
+func (v *queueView) openFolder() {
+	v.mu.Lock()
+	var path string
+	if v.selected >= 0 && v.selected < len(v.rows) {
+		path = v.rows[v.selected].path
+	}
+	for _, r := range v.rows {
+		if path != "" {
+			break
+		}
+		path = r.path
+	}
+	v.mu.Unlock()
+
+	if path == "" {
+		dialog.NewInformation("提示", "还没有已保存的文件", v.window).Show()
+		return
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err == nil {
+		var folderURL *url.URL
+		if folderURL, err = url.Parse(storage.NewFileURI(dir).String()); err == nil {
+			err = fyne.CurrentApp().OpenURL(folderURL)
+		}
+	}
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("打开目录 %s 出错：%w", dir, err), v.window)
+	}
+}
+
+// 校验结果中最多列出的文件数
+const maxVerifyProblems = 200
+
+// verifyFolder 选择目录，按其中的索引文件重新校验已下载的文件
+func (v *queueView) verifyFolder() {
+	dialog.NewFolderOpen(func(dir fyne.ListableURI, err error) {
+		if err != nil {
+			dialog.ShowError(err, v.window)
+			return
+		}
+		if dir == nil {
+			return
+		}
+		path := dir.Path()
+		progress := dialog.NewCustomWithoutButtons("校验目录", widget.NewProgressBarInfinite(), v.window)
+		progress.Show()
+		v.verifyButton.Disable()
+		go func() {
+			var problems []string
+			summary, err := dl.VerifyFolder(context.Background(), path, func(r dl.VerifyResult) {
+				if r.Status == dl.VerifyOK || len(problems) >= maxVerifyProblems {
+					return
+				}
+				line := fmt.Sprintf("%s  %s", verifyStatusText(r.Status), r.Path)
+				if r.Detail != "" {
+					line += "：" + r.Detail
+				}
+				problems = append(problems, line)
+			})
+			fyne.Do(func() {
+				progress.Hide()
+				v.verifyButton.Enable()
+				if err != nil && summary.Indexes == 0 {
+					dialog.ShowError(err, v.window)
+					return
+				}
+				text := summary.String()
+				if err != nil {
+					text += "\n" + err.Error()
+				}
+				if len(problems) > 0 {
+					text += "\n\n" + strings.Join(problems, "\n")
+				}
+				label := widget.NewLabel(text)
+				label.Wrapping = fyne.TextWrapWord
+				scroll := container.NewVScroll(label)
+				scroll.SetMinSize(fyne.NewSize(560, 240))
+				title := "✅ 校验通过"
+				if err != nil || !summary.Passed() {
+					title = "⚠️ 校验未通过"
+				}
+				dialog.NewCustom(title, "关闭", scroll, v.window).Show()
+			})
+		}()
+	}, v.window).Show()
+}
+
+// bundleFolder 选择目录，打包为同级的 目录名.zip（含 index.html），便于离线使用；
+// 元数据中有教材信息时可选择只打包某一课程的某一章节
+func (v *queueView) bundleFolder() {
+	dialog.NewFolderOpen(func(dir fyne.ListableURI, err error) {
+		if err != nil {
+			dialog.ShowError(err, v.window)
+			return
+		}
+		if dir == nil {
+			return
+		}
+		path := dir.Path()
+		books, err := dl.BundleBooks(path)
+		if err != nil {
+			dialog.ShowError(err, v.window)
+			return
+		}
+		if len(books) == 0 {
+			v.runBundle(path, dl.BundleOptions{})
+			return
+		}
+		v.showBundleOptions(path, books)
+	}, v.window).Show()
+}
+
+// showBundleOptions 选择课程（教材）和章节，章节目录在选择课程后查询
+func (v *queueView) showBundleOptions(path string, books []dl.BundleBook) {
+	const allBooks, allChapters = "全部课程", "全部章节"
+	bookOptions := []string{allBooks}
+	bookMap := make(map[string]dl.BundleBook)
+	for i, book := range books {
+		name := fmt.Sprintf("%d. %s", i+1, book.Title)
+		bookOptions = append(bookOptions, name)
+		bookMap[name] = book
+	}
+
+	var chapters []dl.CourseToc // 与章节选项顺序一致（第一项为全部章节），章节标题可能重复
+	chapterSelect := widget.NewSelect([]string{allChapters}, nil)
+	chapterSelect.SetSelected(allChapters)
+	chapterSelect.Disable()
+	statusLabel := widget.NewLabel("")
+	var bookSelect *widget.Select
+	bookSelect = widget.NewSelect(bookOptions, func(selected string) {
+		chapters = nil
+		chapterSelect.SetOptions([]string{allChapters})
+		chapterSelect.SetSelected(allChapters)
+		chapterSelect.Disable()
+		book, ok := bookMap[selected]
+		if !ok {
+			statusLabel.SetText("")
+			return
+		}
+		statusLabel.SetText("查询课程单元中")
+		go func() {
+			courseToc := dl.ParseCourseID(context.Background(), book.ID)
+			fyne.Do(func() {
+				// 查询期间已选择其他课程
+				if bookSelect.Selected != selected {
+					return
+				}
+				if len(courseToc) == 0 {
+					statusLabel.SetText("课程单元为空，将打包目录中全部文件")
+					return
+				}
+				options := []string{allChapters}
+				for i, toc := range courseToc {
+					options = append(options, fmt.Sprintf("%d. %s", i+1, toc.Title))
+				}
+				chapters = courseToc
+				chapterSelect.SetOptions(options)
+				chapterSelect.Enable()
+				statusLabel.SetText(fmt.Sprintf("课程单元（共%d章）", len(courseToc)))
+			})
+		}()
+	})
+	bookSelect.SetSelected(allBooks)
+	if len(books) == 1 {
+		bookSelect.SetSelected(bookOptions[1])
+	}
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("课程", bookSelect),
+		widget.NewFormItem("章节", container.NewVBox(chapterSelect, statusLabel)),
+	}
+	form := dialog.NewForm("打包课程", "打包", "取消", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		var opts dl.BundleOptions
+		if i := chapterSelect.SelectedIndex(); i > 0 && i <= len(chapters) {
+			opts.Chapters = []dl.CourseToc{chapters[i-1]}
+		} else if book, ok := bookMap[bookSelect.Selected]; ok && len(chapters) > 0 {
+			// 只选择课程时打包该课程全部章节中的课程
+			opts.Chapters = chapters
+			opts.Title = book.Title
+		}
+		v.runBundle(path, opts)
+	}, v.window)
+	form.Resize(fyne.NewSize(480, 0))
+	form.Show()
+}
+
+// runBundle 在后台打包，结束后显示结果
+func (v *queueView) runBundle(path string, opts dl.BundleOptions) {
+	zipPath := dl.DefaultBundlePath(path, opts)
+	progress := dialog.NewCustomWithoutButtons("打包课程", widget.NewProgressBarInfinite(), v.window)
+	progress.Show()
+	v.bundleButton.Disable()
+	go func() {
+		summary, err := dl.BundleFolder(context.Background(), path, zipPath, opts)
+		fyne.Do(func() {
+			progress.Hide()
+			v.bundleButton.Enable()
+			if err != nil {
+				dialog.ShowError(err, v.window)
+				return
+			}
+			dialog.NewInformation("✅ 打包完成", fmt.Sprintf("%s\n已保存至 %s\n解压后打开 index.html 即可离线使用", summary, zipPath), v.window).Show()
+		})
+	}()
+}
+
+func verifyStatusText(status dl.VerifyStatus) string {
+	switch status {
+	case dl.VerifyMissing:
+		return "缺失"
+	case dl.VerifyMismatch:
+		return "不一致"
+	case dl.VerifyError:
+		return "出错"
+	}
+	return "通过"
+}
@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/hantang/smartedudlgo/internal/dl"
+)
+
+// uiReporter 订阅下载事件，在操作区域展示下载进度
+type uiReporter struct {
+	window      fyne.Window
+	progressBar *widget.ProgressBar
+	statusLabel *widget.Label
+	buttons     []*widget.Button // 下载按钮，下载中禁用
+	controls    []*widget.Button // 暂停、取消按钮，仅下载中可用
+}
+
+func newUIReporter(window fyne.Window, progressBar *widget.ProgressBar, statusLabel *widget.Label, buttons []*widget.Button, controls []*widget.Button) *uiReporter {
+	return &uiReporter{
+		window:      window,
+		progressBar: progressBar,
+		statusLabel: statusLabel,
+		buttons:     buttons,
+		controls:    controls,
+	}
+}
+
+func (r *uiReporter) OnEvent(e dl.Event) {
+	switch e := e.(type) {
+	case dl.BatchStarted:
+		fyne.Do(func() {
+			// 初始化：禁用下载按钮
+			for _, button := range r.buttons {
+				button.Disable()
+			}
+			for _, button := range r.controls {
+				button.Enable()
+			}
+			r.statusLabel.SetText("正在准备下载...")
+			r.progressBar.SetValue(0)
+		})
+	case dl.BatchProgress:
+		fyne.Do(func() {
+			r.progressBar.SetValue(e.Progress)
+			statusText := fmt.Sprintf("下载中... %d/%d 个文件", e.FilesDone, e.Total)
+			if e.Paused {
+				statusText = fmt.Sprintf("已暂停（进行中的文件继续完成）... %d/%d 个文件", e.FilesDone, e.Total)
+			}
+			if e.Retries > 0 {
+				statusText += fmt.Sprintf(" (重试: %d次)", e.Retries)
+			}
+			r.statusLabel.SetText(statusText)
+		})
+	case dl.BatchFinished:
+		fyne.Do(func() {
+			r.finish(e.Result)
+		})
+	}
+}
+
+func (r *uiReporter) finish(result dl.DownloadResult) {
+	defer func() {
+		for _, button := range r.buttons {
+			button.Enable()
+		}
+		for _, button := range r.controls {
+			button.Disable()
+		}
+	}()
+	if result.Err != nil {
+		dialog.ShowError(result.Err, r.window)
+		r.statusLabel.SetText("创建下载目录失败")
+		return
+	}
+
+	statsInfo := result.Summary()
+	if result.Canceled > 0 {
+		r.statusLabel.SetText(fmt.Sprintf("下载已取消：成功/失败 = %d/%d，取消：%d", result.Success, result.Failed, result.Canceled))
+		dialog.NewInformation("结果", "下载已取消：\n"+statsInfo, r.window).Show()
+		return
+	}
+	statusText := fmt.Sprintf("下载完成：成功/失败 = %d/%d", result.Success, result.Failed)
+	if result.Skipped > 0 {
+		statusText += fmt.Sprintf("，跳过：%d", result.Skipped)
+	}
+	r.statusLabel.SetText(statusText)
+	if !result.TokenInvalid && result.Success+result.Skipped > 0 {
+		dialog.NewInformation("结果", "文件下载完成：\n"+statsInfo, r.window).Show()
+	} else {
+		dialog.ShowError(fmt.Errorf("⚠️  【登录信息】可能错误或者失效\n\n文件下载结果：\n%s", statsInfo), r.window)
+	}
+}
@@ -0,0 +1,346 @@
+package ui
+
+import (
+	"fmt"
+	"image/color"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/hantang/smartedudlgo/internal/dl"
+)
+
+// settingsStore 界面共用的设置，修改后保存并通知各区域更新，需在界面线程使用
+type settingsStore struct {
+	settings  *dl.Settings
+	threads   int // 命令行指定的并发数，只在本次运行有效，0 表示使用设置
+	listeners []func()
+}
+
+func newSettingsStore(settings *dl.Settings) *settingsStore {
+	return &settingsStore{settings: settings}
+}
+
+// onChanged 设置对话框保存后调用
+func (s *settingsStore) onChanged(fn func()) {
+	s.listeners = append(s.listeners, fn)
+}
+
+// save 保存设置文件，保存失败只记录日志
+func (s *settingsStore) save() {
+	if err := s.settings.Save(); err != nil {
+		slog.Warn(fmt.Sprintf("保存设置出错：%v", err))
+	}
+}
+
+// maxConcurrency 下载并发数，命令行指定时优先
+func (s *settingsStore) maxConcurrency() int {
+	if s.threads > 0 {
+		return s.threads
+	}
+	return s.settings.MaxConcurrency
+}
+
+// update 修改设置并保存，notify 时通知各区域更新
+func (s *settingsStore) update(fn func(settings *dl.Settings), notify bool) {
+	fn(s.settings)
+	s.save()
+	if notify {
+		for _, listener := range s.listeners {
+			listener()
+		}
+	}
+}
+
+// parseHexColor 解析 #RRGGBB 或 #RRGGBBAA
+func parseHexColor(value string) (color.Color, bool) {
+	var r, g, b, a uint8 = 0, 0, 0, 0xff
+	switch len(value) {
+	case 7:
+		if _, err := fmt.Sscanf(value, "#%02x%02x%02x", &r, &g, &b); err != nil {
+			return nil, false
+		}
+	case 9:
+		if _, err := fmt.Sscanf(value, "#%02x%02x%02x%02x", &r, &g, &b, &a); err != nil {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	return color.NRGBA{R: r, G: g, B: b, A: a}, true
+}
+
+func formatHexColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
+
+// optionNames 下拉框选项及对应的设置值
+type optionNames struct {
+	names  []string
+	values []string
+}
+
+func (o *optionNames) add(name string, value string) {
+	o.names = append(o.names, name)
+	o.values = append(o.values, value)
+}
+
+func (o *optionNames) name(value string) string {
+	for i, v := range o.values {
+		if v == value {
+			return o.names[i]
+		}
+	}
+	return value
+}
+
+func (o *optionNames) value(name string) string {
+	for i, n := range o.names {
+		if n == name {
+			return o.values[i]
+		}
+	}
+	return name
+}
+
+func conflictOptions() *optionNames {
+	o := &optionNames{}
+	for _, item := range dl.CONFLICT_POLICY_LIST {
+		o.add(item.Name, string(item.Policy))
+	}
+	return o
+}
+
+func containerOptions() *optionNames {
+	o := &optionNames{}
+	for _, item := range dl.VIDEO_CONTAINER_LIST {
+		o.add(item.Name, string(item.Container))
+	}
+	return o
+}
+
+func qualityOptions() *optionNames {
+	o := &optionNames{}
+	for _, item := range dl.QUALITY_LIST {
+		o.add(item.Name, item.Value)
+	}
+	return o
+}
+
+func rateOptions() *optionNames {
+	o := &optionNames{}
+	for _, item := range dl.RATE_LIMIT_LIST {
+		o.add(item.Name, item.Value)
+	}
+	return o
+}
+
+func hostConnsOptions() *optionNames {
+	o := &optionNames{}
+	for _, conns := range dl.HOST_CONCURRENCY_LIST {
+		if conns <= 0 {
+			o.add("不限制", "0")
+		} else {
+			o.add(strconv.Itoa(conns), strconv.Itoa(conns))
+		}
+	}
+	return o
+}
+
+// selectValue 选中设置值对应的选项，不在列表中（如手动修改设置文件）时添加
+func selectValue(s *widget.Select, options *optionNames, value string) {
+	name := options.name(value)
+	found := false
+	for _, option := range s.Options {
+		if option == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		s.Options = append(s.Options, name)
+	}
+	s.SetSelected(name)
+}
+
+// showSettingsDialog 编辑全部设置，保存后立即生效（本地数据、保存数据需重启）
+func showSettingsDialog(w fyne.Window, store *settingsStore, customTheme *CustomTheme) {
+	s := store.settings
+
+	pathEntry := widget.NewEntry()
+	pathEntry.SetText(s.DownloadsDir)
+	pathEntry.SetPlaceHolder("默认【用户下载目录】")
+	pathButton := widget.NewButtonWithIcon("", theme.FolderIcon(), func() {
+		dialog.NewFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			if dir != nil {
+				pathEntry.SetText(dir.Path())
+			}
+		}, w).Show()
+	})
+
+	// 保存路径模板，输入时预览示例资源的保存路径
+	var fieldNames []string
+	for _, field := range dl.NAME_TEMPLATE_FIELDS {
+		fieldNames = append(fieldNames, fmt.Sprintf("{%s} %s", field.Name, field.Desc))
+	}
+	templatePreview := widget.NewLabel("")
+	templatePreview.Wrapping = fyne.TextWrapWord
+	templateEntry := widget.NewEntry()
+	templateEntry.SetPlaceHolder(dl.DefaultNameTemplate)
+	templateEntry.Validator = func(text string) error {
+		_, err := dl.ParseNameTemplate(text)
+		return err
+	}
+	templateEntry.OnChanged = func(text string) {
+		tmpl, err := dl.ParseNameTemplate(text)
+		if err != nil {
+			templatePreview.SetText(err.Error())
+			return
+		}
+		templatePreview.SetText("预览：" + tmpl.Preview(dl.SampleLinkData))
+	}
+	templateEntry.SetText(s.NameTemplate)
+	templateFields := widget.NewLabel("字段：" + strings.Join(fieldNames, "、"))
+	templateFields.Wrapping = fyne.TextWrapWord
+
+	var formatNames []string
+	var selectedFormats []string
+	for _, format := range dl.FORMAT_LIST {
+		if !format.Status {
+			continue
+		}
+		formatNames = append(formatNames, format.Name)
+		if s.HasFormat(format.Suffix) {
+			selectedFormats = append(selectedFormats, format.Name)
+		}
+	}
+	formatGroup := widget.NewCheckGroup(formatNames, nil)
+	formatGroup.Horizontal = true
+	formatGroup.SetSelected(selectedFormats)
+
+	backupCheck := widget.NewCheck("备用解析", nil)
+	backupCheck.SetChecked(s.UseBackup)
+	logCheck := widget.NewCheck("记录日志", nil)
+	logCheck.SetChecked(s.EnableLog)
+	metadataCheck := widget.NewCheck("元数据", nil)
+	metadataCheck.SetChecked(s.WriteMetadata)
+	mergeCheck := widget.NewCheck("合并同一本书的PDF", nil)
+	mergeCheck.SetChecked(s.MergePDF)
+	removeMergedCheck := widget.NewCheck("合并后删除原文件", nil)
+	removeMergedCheck.SetChecked(s.RemoveMerged)
+
+	positiveInt := func(text string) error {
+		if n, err := strconv.Atoi(text); err != nil || n < 1 {
+			return fmt.Errorf("请输入正整数")
+		}
+		return nil
+	}
+	threadsEntry := widget.NewEntry()
+	threadsEntry.SetText(strconv.Itoa(s.MaxConcurrency))
+	threadsEntry.Validator = positiveInt
+	retriesEntry := widget.NewEntry()
+	retriesEntry.SetText(strconv.Itoa(s.Retries))
+	retriesEntry.Validator = positiveInt
+
+	conflicts, containers, qualities := conflictOptions(), containerOptions(), qualityOptions()
+	rates, hostConns := rateOptions(), hostConnsOptions()
+	conflictSelect := widget.NewSelect(conflicts.names, nil)
+	selectValue(conflictSelect, conflicts, string(s.Conflict))
+	containerSelect := widget.NewSelect(containers.names, nil)
+	selectValue(containerSelect, containers, string(s.Container))
+	qualitySelect := widget.NewSelect(qualities.names, nil)
+	selectValue(qualitySelect, qualities, s.Quality)
+	rateSelect := widget.NewSelect(rates.names, nil)
+	selectValue(rateSelect, rates, s.RateLimit)
+	hostConnsSelect := widget.NewSelect(hostConns.names, nil)
+	selectValue(hostConnsSelect, hostConns, strconv.Itoa(s.HostConns))
+
+	themeColor := s.ThemeColor
+	colorButton := widget.NewButtonWithIcon("选择颜色", theme.ColorPaletteIcon(), func() {
+		dialog.NewColorPicker("🎨 主题", "选择主题颜色", func(c color.Color) {
+			themeColor = formatHexColor(c)
+			customTheme.setPrimaryColor(themeColor)
+		}, w).Show()
+	})
+	resetColorButton := widget.NewButton("默认", func() {
+		themeColor = ""
+		customTheme.setPrimaryColor(themeColor)
+	})
+
+	localCheck := widget.NewCheck("本地数据（重启后生效）", nil)
+	localCheck.SetChecked(s.Local)
+	saveDataCheck := widget.NewCheck("保存获取的数据（需 -debug，重启后生效）", nil)
+	saveDataCheck.SetChecked(s.SaveData)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("保存目录", container.NewBorder(nil, nil, nil, pathButton, pathEntry)),
+		widget.NewFormItem("保存路径模板", container.NewVBox(templateEntry, templatePreview, templateFields)),
+		widget.NewFormItem("资源类型", formatGroup),
+		widget.NewFormItem("", container.NewHBox(backupCheck, logCheck, metadataCheck)),
+		widget.NewFormItem("合并PDF", container.NewHBox(mergeCheck, removeMergedCheck)),
+		widget.NewFormItem("并发数", threadsEntry),
+		widget.NewFormItem("重试次数", retriesEntry),
+		widget.NewFormItem("已存在文件", conflictSelect),
+		widget.NewFormItem("视频格式", containerSelect),
+		widget.NewFormItem("视频清晰度", qualitySelect),
+		widget.NewFormItem("下载限速", rateSelect),
+		widget.NewFormItem("每个服务器并发数", hostConnsSelect),
+		widget.NewFormItem("主题颜色", container.NewHBox(colorButton, resetColorButton)),
+		widget.NewFormItem("数据", container.NewVBox(localCheck, saveDataCheck)),
+	}
+	originalColor := s.ThemeColor
+	form := dialog.NewForm("⚙️ 设置", "保存", "取消", items, func(ok bool) {
+		if !ok {
+			customTheme.setPrimaryColor(originalColor)
+			return
+		}
+		store.update(func(s *dl.Settings) {
+			s.DownloadsDir = pathEntry.Text
+			s.NameTemplate = templateEntry.Text
+			s.Formats = nil
+			for _, format := range dl.FORMAT_LIST {
+				for _, name := range formatGroup.Selected {
+					if format.Name == name {
+						s.Formats = append(s.Formats, format.Suffix)
+					}
+				}
+			}
+			s.UseBackup = backupCheck.Checked
+			s.EnableLog = logCheck.Checked
+			s.WriteMetadata = metadataCheck.Checked
+			s.MergePDF = mergeCheck.Checked
+			s.RemoveMerged = removeMergedCheck.Checked
+			threads, _ := strconv.Atoi(threadsEntry.Text)
+			if threads != s.MaxConcurrency {
+				// 在设置中修改后不再使用命令行指定的并发数
+				store.threads = 0
+			}
+			s.MaxConcurrency = threads
+			s.Retries, _ = strconv.Atoi(retriesEntry.Text)
+			s.Conflict = dl.ConflictPolicy(conflicts.value(conflictSelect.Selected))
+			s.Container = dl.VideoContainer(containers.value(containerSelect.Selected))
+			s.Quality = qualities.value(qualitySelect.Selected)
+			s.RateLimit = rates.value(rateSelect.Selected)
+			s.HostConns, _ = strconv.Atoi(hostConns.value(hostConnsSelect.Selected))
+			s.ThemeColor = themeColor
+			s.Local = localCheck.Checked
+			s.SaveData = saveDataCheck.Checked
+		}, true)
+	}, w)
+	form.Resize(fyne.NewSize(560, 0))
+	form.Show()
+}
@@ -12,11 +12,24 @@ type CustomTheme struct {
 	defaultTheme fyne.Theme
 }
 
-func NewCustomTheme() *CustomTheme {
-	return &CustomTheme{
-		primaryColor: theme.DefaultTheme().Color(theme.ColorNamePrimary, theme.VariantLight),
-		defaultTheme: theme.DefaultTheme(),
+func NewCustomTheme(themeColor string) *CustomTheme {
+	t := &CustomTheme{defaultTheme: theme.DefaultTheme()}
+	t.primaryColor = t.parseColor(themeColor)
+	return t
+}
+
+// parseColor 设置中的主题颜色，为空或无效时使用默认颜色
+func (t *CustomTheme) parseColor(themeColor string) color.Color {
+	if c, ok := parseHexColor(themeColor); ok {
+		return c
 	}
+	return t.defaultTheme.Color(theme.ColorNamePrimary, theme.VariantLight)
+}
+
+// setPrimaryColor 修改主题颜色并立即应用
+func (t *CustomTheme) setPrimaryColor(themeColor string) {
+	t.primaryColor = t.parseColor(themeColor)
+	fyne.CurrentApp().Settings().SetTheme(t)
 }
 
 func (t *CustomTheme) Color(name fyne.ThemeColorName, variant fyne.ThemeVariant) color.Color {
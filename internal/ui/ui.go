@@ -2,7 +2,6 @@ package ui
 
 import (
 	"fmt"
-	"image/color"
 
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
@@ -13,10 +12,13 @@ import (
 	"github.com/hantang/smartedudlgo/internal/dl"
 )
 
-func InitUI(isLocal bool, maxConcurrency int, saveFetchedData bool) {
+// InitUI 启动图形界面；threads 为命令行指定的并发数（0 表示使用设置），不保存到设置文件
+func InitUI(settings *dl.Settings, isLocal bool, saveFetchedData bool, threads int) {
 	a := app.New()
+	store := newSettingsStore(settings)
+	store.threads = threads
 
-	customTheme := NewCustomTheme()
+	customTheme := NewCustomTheme(settings.ThemeColor)
 	a.Settings().SetTheme(customTheme)
 
 	metadata := a.Metadata()
@@ -24,11 +26,7 @@ func InitUI(isLocal bool, maxConcurrency int, saveFetchedData bool) {
 	// Menu and title
 	toolbar := widget.NewToolbar(
 		widget.NewToolbarAction(theme.SettingsIcon(), func() {
-			picker := dialog.NewColorPicker("🎨 主题", "选择主题颜色", func(c color.Color) {
-				customTheme.primaryColor = c
-				a.Settings().SetTheme(customTheme)
-			}, w)
-			picker.Show()
+			showSettingsDialog(w, store, customTheme)
 		}),
 		widget.NewToolbarAction(theme.InfoIcon(), func() {
 			dialog.NewInformation("💬 关于", fmt.Sprintf("%s\n🎉 当前版本：%s", dl.APP_DESC, metadata.Version), w).Show()
@@ -59,7 +57,7 @@ func InitUI(isLocal bool, maxConcurrency int, saveFetchedData bool) {
 	)
 
 	// Bottom operation area
-	operationArea := CreateOperationArea(w, tabContainer, linkItemMaps, maxConcurrency)
+	operationArea := CreateOperationArea(w, tabContainer, linkItemMaps, store)
 
 	content := container.NewBorder(toolbar, operationArea, nil, nil, tabContainer)
 	w.SetContent(content)
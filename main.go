@@ -3,20 +3,40 @@ package main
 import (
 	"flag"
 	"log/slog"
+	"os"
 
+	"github.com/hantang/smartedudlgo/internal/cli"
+	"github.com/hantang/smartedudlgo/internal/dl"
 	"github.com/hantang/smartedudlgo/internal/ui"
 )
 
 func main() {
+	// 子命令：命令行模式，不启动图形界面
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
+	// 设置文件中的值作为参数默认值，命令行参数优先
+	settings, err := dl.LoadSettings()
 	isDebug := flag.Bool("debug", false, "Enable debug logging")
-	isLocal := flag.Bool("local", false, "Enable local file mode")
-	isSave := flag.Bool("save", false, "Save fetched JSON data to data/ directory; only active with --debug")
-	threads := flag.Int("threads", 10, "Max concurrency for video download")
+	isLocal := flag.Bool("local", settings.Local, "Enable local file mode")
+	isSave := flag.Bool("save", settings.SaveData, "Save fetched JSON data to data/ directory; only active with --debug")
+	threads := flag.Int("threads", settings.MaxConcurrency, "Max concurrency for video download")
 	flag.Parse()
 	if *isDebug {
 		slog.SetLogLoggerLevel(slog.LevelDebug)
 		slog.Debug("Debug mode enabled")
 	}
+	if err != nil {
+		slog.Warn(err.Error())
+	}
+	// 命令行指定的并发数只在本次运行有效，不写入设置文件
+	var threadsOverride int
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "threads" {
+			threadsOverride = max(*threads, 1)
+		}
+	})
 	if *isLocal {
 		slog.Debug("Local file mode enabled")
 	}
@@ -29,5 +49,5 @@ func main() {
 	}
 
 	// os.Setenv("FYNE_FONT", "./assets/DouyinSansBold.ttf")
-	ui.InitUI(*isLocal, *threads, saveFetchedData)
+	ui.InitUI(settings, *isLocal, saveFetchedData, threadsOverride)
 }